@@ -0,0 +1,304 @@
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+	"github.com/spf13/viper"
+	"github.com/ThiagoAVicente/sfs-cli/internal/api"
+	"github.com/ThiagoAVicente/sfs-cli/internal/api/apitest"
+	"github.com/ThiagoAVicente/sfs-cli/internal/config"
+	"github.com/ThiagoAVicente/sfs-cli/internal/history"
+	"github.com/ThiagoAVicente/sfs-cli/internal/state"
+)
+
+// newTestServer points commands at a fake API server, with HOME in a
+// temporary directory
+func newTestServer(t *testing.T) *apitest.Server {
+	t.Helper()
+	viper.Reset()
+	home := os.Getenv("HOME")
+	os.Setenv("HOME", t.TempDir())
+
+	server := apitest.NewServer()
+	config.Set("api_url", server.URL)
+	config.Set("api_key", apitest.APIKey)
+	client, err := api.NewClient()
+	if err != nil {
+		t.Fatalf("Failed to create client: %v", err)
+	}
+
+	factory := newClient
+	newClient = func() (api.Service, error) {
+		return client, nil
+	}
+	t.Cleanup(func() {
+		newClient = factory
+		server.Close()
+		os.Setenv("HOME", home)
+		viper.Reset()
+	})
+	return server
+}
+
+// run executes sfs with args and returns what it printed to stdout
+func run(t *testing.T, args ...string) (string, error) {
+	t.Helper()
+	resetFlags(rootCmd)
+
+	stdout := os.Stdout
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatalf("Failed to create pipe: %v", err)
+	}
+	os.Stdout = w
+	printed := make(chan []byte)
+	go func() {
+		data, _ := io.ReadAll(r)
+		printed <- data
+	}()
+
+	rootCmd.SetArgs(args)
+	err = rootCmd.ExecuteContext(context.Background())
+
+	w.Close()
+	os.Stdout = stdout
+	return string(<-printed), err
+}
+
+// resetFlags puts every flag of cmd and its subcommands back to its default,
+// since commands keep them in package variables between runs
+func resetFlags(cmd *cobra.Command) {
+	reset := func(f *pflag.Flag) {
+		if slice, ok := f.Value.(pflag.SliceValue); ok {
+			slice.Replace(nil)
+		} else {
+			f.Value.Set(f.DefValue)
+		}
+		f.Changed = false
+	}
+	cmd.Flags().VisitAll(reset)
+	cmd.PersistentFlags().VisitAll(reset)
+	for _, sub := range cmd.Commands() {
+		resetFlags(sub)
+	}
+}
+
+func TestUploadCommand(t *testing.T) {
+	server := newTestServer(t)
+
+	dir := t.TempDir()
+	path := filepath.Join(dir, "notes.txt")
+	os.WriteFile(path, []byte("meeting notes"), 0644)
+	os.WriteFile(filepath.Join(dir, "debug.log"), []byte("noise"), 0644)
+
+	out, err := run(t, "upload", dir, "--exclude", ".log", "--output", "json")
+	if err != nil {
+		t.Fatalf("Upload failed: %v", err)
+	}
+
+	var r uploadReport
+	if err := json.Unmarshal([]byte(out), &r); err != nil {
+		t.Fatalf("Failed to parse output %q: %v", out, err)
+	}
+	if len(r.Uploaded) != 1 || r.Uploaded[0].Path != path || r.Uploaded[0].JobID == "" {
+		t.Errorf("Expected %s to be reported uploaded with a job, got %+v", path, r.Uploaded)
+	}
+	if len(r.Failed) != 0 {
+		t.Errorf("Expected no failures, got %+v", r.Failed)
+	}
+
+	if data, ok := server.File(api.RemoteName(path)); !ok || string(data) != "meeting notes" {
+		t.Errorf("Expected the server to hold %s, got %q (found %v)", path, data, ok)
+	}
+	if files := server.Files(); len(files) != 1 {
+		t.Errorf("Expected only the excluded file to be left out, server has %v", files)
+	}
+}
+
+func TestUploadCommandFailure(t *testing.T) {
+	server := newTestServer(t)
+	server.FailNext(1, 500)
+
+	path := filepath.Join(t.TempDir(), "notes.txt")
+	os.WriteFile(path, []byte("meeting notes"), 0644)
+
+	out, err := run(t, "upload", path, "--output", "json")
+	if err == nil {
+		t.Fatal("Expected upload to fail")
+	}
+	if code := exitCode(err); code != exitAPIError {
+		t.Errorf("Expected exit code %d, got %d", exitAPIError, code)
+	}
+
+	var r uploadReport
+	if err := json.Unmarshal([]byte(out), &r); err != nil {
+		t.Fatalf("Failed to parse output %q: %v", out, err)
+	}
+	if len(r.Failed) != 1 || r.Failed[0].Path != path {
+		t.Errorf("Expected %s to be reported failed, got %+v", path, r.Failed)
+	}
+}
+
+func TestSearchCommand(t *testing.T) {
+	server := newTestServer(t)
+	server.PutFile("fox.txt", []byte("the quick brown fox"))
+	server.PutFile("lorem.txt", []byte("lorem ipsum dolor"))
+
+	tests := []struct {
+		name  string
+		args  []string
+		files []string
+	}{
+		{"match", []string{"search", "brown", "fox"}, []string{"fox.txt"}},
+		{"no match", []string{"search", "kubernetes"}, nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			out, err := run(t, append(tt.args, "--output", "json")...)
+			if err != nil {
+				t.Fatalf("Search failed: %v", err)
+			}
+
+			var r searchReport
+			if err := json.Unmarshal([]byte(out), &r); err != nil {
+				t.Fatalf("Failed to parse output %q: %v", out, err)
+			}
+			var files []string
+			for _, match := range r.Results {
+				files = append(files, match.FilePath)
+			}
+			if len(files) != len(tt.files) || (len(files) > 0 && files[0] != tt.files[0]) {
+				t.Errorf("Expected results in %v, got %v", tt.files, files)
+			}
+		})
+	}
+}
+
+func TestDownloadCommand(t *testing.T) {
+	server := newTestServer(t)
+	server.PutFile("report.txt", []byte("quarterly numbers"))
+
+	dest := filepath.Join(t.TempDir(), "out.txt")
+	out, err := run(t, "download", "report.txt", "--dest", dest, "--output", "json")
+	if err != nil {
+		t.Fatalf("Download failed: %v", err)
+	}
+
+	var r downloadReport
+	if err := json.Unmarshal([]byte(out), &r); err != nil {
+		t.Fatalf("Failed to parse output %q: %v", out, err)
+	}
+	if r.File != "report.txt" || r.Path != dest {
+		t.Errorf("Expected report.txt -> %s, got %+v", dest, r)
+	}
+	if data, err := os.ReadFile(dest); err != nil || string(data) != "quarterly numbers" {
+		t.Errorf("Expected the file to be downloaded, got %q (%v)", data, err)
+	}
+
+	// An existing file is kept unless --force is given
+	if _, err := run(t, "download", "report.txt", "--dest", dest); err == nil {
+		t.Error("Expected download over an existing file to fail")
+	}
+
+	out, err = run(t, "download", "report.txt", "--dest", "-")
+	if err != nil {
+		t.Fatalf("Download to stdout failed: %v", err)
+	}
+	if out != "quarterly numbers" {
+		t.Errorf("Expected the file on stdout, got %q", out)
+	}
+
+	if _, err := run(t, "download", "missing.txt", "--dest", dest, "--force"); exitCode(err) != exitNotFound {
+		t.Errorf("Expected exit code %d for a missing file, got %v", exitNotFound, err)
+	}
+}
+
+func TestDeleteCommand(t *testing.T) {
+	server := newTestServer(t)
+
+	path := filepath.Join(t.TempDir(), "notes.txt")
+	os.WriteFile(path, []byte("meeting notes"), 0644)
+	name := api.RemoteName(path)
+	server.PutFile(name, []byte("meeting notes"))
+
+	store, err := state.OpenDefault()
+	if err != nil {
+		t.Fatalf("Failed to open sync state: %v", err)
+	}
+	if err := store.Put(state.Entry{Path: path, RemoteName: name, Hash: "abc"}); err != nil {
+		t.Fatalf("Failed to record entry: %v", err)
+	}
+
+	if _, err := run(t, "delete", path); err != nil {
+		t.Fatalf("Delete failed: %v", err)
+	}
+	if _, ok := server.File(name); ok {
+		t.Errorf("Expected %s to be deleted from the server", name)
+	}
+
+	// Sync must see the file as never uploaded, not as unchanged
+	store, err = state.OpenDefault()
+	if err != nil {
+		t.Fatalf("Failed to reopen sync state: %v", err)
+	}
+	if entry, ok := store.Get(path); ok {
+		t.Errorf("Expected the sync state to forget %s, got %+v", path, entry)
+	}
+}
+
+func TestJobListCommand(t *testing.T) {
+	server := newTestServer(t)
+	server.SetJobStatus(apitest.StatusProcessing)
+
+	dir := t.TempDir()
+	var ids []string
+	for _, name := range []string{"a.txt", "b.txt", "c.txt"} {
+		path := filepath.Join(dir, name)
+		os.WriteFile(path, []byte(name), 0644)
+		out, err := run(t, "upload", path, "--output", "json")
+		if err != nil {
+			t.Fatalf("Upload failed: %v", err)
+		}
+		var r uploadReport
+		if err := json.Unmarshal([]byte(out), &r); err != nil || len(r.Uploaded) != 1 {
+			t.Fatalf("Failed to parse output %q: %v", out, err)
+		}
+		ids = append(ids, r.Uploaded[0].JobID)
+	}
+
+	list := func(args ...string) []history.Job {
+		t.Helper()
+		out, err := run(t, append([]string{"job", "list", "--output", "json"}, args...)...)
+		if err != nil {
+			t.Fatalf("Job list failed: %v", err)
+		}
+		var r jobListReport
+		if err := json.Unmarshal([]byte(out), &r); err != nil {
+			t.Fatalf("Failed to parse output %q: %v", out, err)
+		}
+		return r.Jobs
+	}
+
+	// Only the listed job is refreshed
+	requests := server.Requests()
+	if jobs := list("--limit", "1"); len(jobs) != 1 || jobs[0].ID != ids[2] {
+		t.Errorf("Expected only the newest job, got %+v", jobs)
+	}
+	if n := server.Requests() - requests; n != 1 {
+		t.Errorf("Expected one job to be refreshed, got %d requests", n)
+	}
+
+	// A pending job that has since failed is found by --failed
+	server.FinishJob(ids[0], apitest.StatusFailed)
+	if jobs := list("--failed"); len(jobs) != 1 || jobs[0].ID != ids[0] || jobs[0].Status != apitest.StatusFailed {
+		t.Errorf("Expected the failed job, got %+v", jobs)
+	}
+}
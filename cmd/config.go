@@ -6,10 +6,15 @@ package cmd
 
 import (
 	"fmt"
+	"os"
+	"strconv"
+	"strings"
 	"syscall"
+	"text/tabwriter"
 
 	"github.com/spf13/cobra"
 	"github.com/ThiagoAVicente/sfs-cli/internal/config"
+	"github.com/ThiagoAVicente/sfs-cli/internal/secrets"
 	"golang.org/x/term"
 )
 
@@ -19,25 +24,61 @@ var configCmd = &cobra.Command{
 	Short: "Manage sfs-cli configuration",
 	Long: `Manage configuration for sfs-cli including API URL and API key.
 
-Configuration is stored in ~/.config/sfs/config.yaml
+Configuration is stored in ~/.config/sfs/config.yaml, or the file given with
+--config or SFS_CONFIG. Any key can be overridden for a single run with an
+SFS_<KEY> environment variable, such as SFS_API_URL.
 
 Available commands:
-  set <key> [value]  Set a configuration value
-  get <key>          Get a configuration value
-  list               List all configuration`,
+  set <key> [value]     Set a configuration value
+  unset <key>           Remove a value, falling back to the default
+  add <key> <value>...  Add items to a list such as watch_dirs or ignore
+  remove <key> <value>...
+                        Remove items from a list
+  get <key>             Get a configuration value
+  list                  List all configuration
+  profile               Manage named profiles
+
+Connection settings (api_url, api_key, watch_dirs, timeouts, retries and TLS)
+are read and written in the active profile; see 'sfs config profile'.`,
 }
 
+var (
+	// encryptFlag makes config set store the API key in the encrypted secrets file
+	encryptFlag bool
+
+	// forceFlag makes config set accept keys sfs doesn't know about
+	forceFlag bool
+)
+
 var configSetCmd = &cobra.Command{
 	Use:   "set <key> [value]",
 	Short: "Set a configuration value",
 	Long: `Set a configuration value. Available keys:
   api_url  - The base URL of the SFS API (default: https://localhost)
-  api_key  - Your API key for authentication (will prompt securely)`,
+  api_key  - Your API key for authentication (will prompt securely)
+  api_key_command - Command whose first line of output is the API key
+  api_key_file    - File holding the API key
+
+With --encrypt, the API key is stored in a passphrase-encrypted secrets file
+next to the config file instead of in plain text. Commands unlock it with the
+SFS_SECRETS_PASSPHRASE environment variable, the file named by the
+secrets_passphrase_file setting, or by prompting for the passphrase.
+
+Values are checked before they are saved: URLs must parse, files and
+directories must exist and numbers must be in range. Unknown keys are
+rejected unless --force is given.`,
 	Args: cobra.RangeArgs(1, 2),
 	RunE: func(cmd *cobra.Command, args []string) error {
 		key := args[0]
 		var value string
 
+		if encryptFlag && key != "api_key" {
+			return fmt.Errorf("--encrypt only applies to api_key")
+		}
+		if err := checkKey(key); err != nil && !forceFlag {
+			return err
+		}
+
 		// For api_key, always prompt securely
 		if key == "api_key" {
 			if len(args) == 2 {
@@ -64,16 +105,15 @@ var configSetCmd = &cobra.Command{
 			value = args[1]
 		}
 
+		if key == "api_key" {
+			return setAPIKey(value, encryptFlag)
+		}
+
 		if err := config.Set(key, value); err != nil {
 			return fmt.Errorf("failed to set config: %w", err)
 		}
 
-		// Don't print the value for api_key
-		if key == "api_key" {
-			fmt.Println("Configuration updated: api_key = ********")
-		} else {
-			fmt.Printf("Configuration updated: %s = %s\n", key, value)
-		}
+		fmt.Printf("Configuration updated: %s = %s\n", key, value)
 		return nil
 	},
 }
@@ -85,41 +125,411 @@ var configGetCmd = &cobra.Command{
 	RunE: func(cmd *cobra.Command, args []string) error {
 		key := args[0]
 		value := config.GetValue(key)
+		encrypted := key == "api_key" && value == "" && hasEncryptedAPIKey()
 
-		if value == "" {
-			fmt.Printf("%s is not set\n", key)
-		} else {
-			// Mask api_key for security
-			if key == "api_key" {
-				fmt.Printf("%s = ********\n", key)
+		// Mask api_key for security
+		r := configValueReport{Key: key, Value: value}
+		if key == "api_key" && (value != "" || encrypted) {
+			r.Value = "********"
+		}
+
+		return printReport(r, func() {
+			if encrypted {
+				fmt.Printf("%s = ******** (encrypted)\n", key)
+			} else if value == "" {
+				fmt.Printf("%s is not set\n", key)
 			} else {
-				fmt.Printf("%s = %s\n", key, value)
+				fmt.Printf("%s = %s\n", key, r.Value)
 			}
+		})
+	},
+}
+
+// configValueReport is the output of sfs config get
+type configValueReport struct {
+	Key   string `json:"key"`
+	Value string `json:"value"`
+}
+
+func (r configValueReport) columns() []string {
+	return []string{"key", "value"}
+}
+
+func (r configValueReport) rows() [][]string {
+	return [][]string{{r.Key, r.Value}}
+}
+
+var configUnsetCmd = &cobra.Command{
+	Use:   "unset <key>",
+	Short: "Remove a configuration value",
+	Long: `Remove a configuration value from the active profile, so it falls back to
+the top-level value, or from the top level, so it falls back to the built-in
+default.`,
+	Args: cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		key := args[0]
+		if err := config.Unset(key); err != nil {
+			return fmt.Errorf("failed to unset config: %w", err)
 		}
+
+		fmt.Printf("Configuration updated: %s unset\n", key)
 		return nil
 	},
 }
 
+var configAddCmd = &cobra.Command{
+	Use:   "add <key> <value>...",
+	Short: "Add items to a list",
+	Long: `Add items to a list such as watch_dirs or ignore, in the active profile.
+Items already in the list are skipped.
+
+Examples:
+  sfs config add ignore "*.log" node_modules/
+  sfs config add watch_dirs ~/documents`,
+	Args: cobra.MinimumNArgs(2),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return updateList(args[0], args[1:], true)
+	},
+}
+
+var configRemoveCmd = &cobra.Command{
+	Use:   "remove <key> <value>...",
+	Short: "Remove items from a list",
+	Args:  cobra.MinimumNArgs(2),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return updateList(args[0], args[1:], false)
+	},
+}
+
+// updateList adds items to or removes them from a list key
+func updateList(key string, values []string, add bool) error {
+	if err := checkKey(key); err != nil {
+		return err
+	}
+
+	update, verb := config.RemoveValues, "Removed from"
+	if add {
+		update, verb = config.AddValues, "Added to"
+	}
+	changed, err := update(key, values...)
+	if err != nil {
+		return fmt.Errorf("failed to update %s: %w", key, err)
+	}
+
+	if len(changed) == 0 {
+		fmt.Printf("%s unchanged\n", key)
+	}
+	for _, value := range changed {
+		fmt.Printf("%s %s: %s\n", verb, key, value)
+	}
+	return nil
+}
+
+// checkKey rejects keys sfs doesn't know about, suggesting the closest
+// known key to catch typos
+func checkKey(key string) error {
+	if config.KnownKey(key) {
+		return nil
+	}
+
+	best, distance := "", 3
+	for _, known := range config.Keys() {
+		if d := editDistance(key, known); d < distance {
+			best, distance = known, d
+		}
+	}
+	if best != "" {
+		return fmt.Errorf("unknown config key %q, did you mean %q? Use --force to set it anyway", key, best)
+	}
+	return fmt.Errorf("unknown config key %q. Use --force to set it anyway", key)
+}
+
+// editDistance returns the Levenshtein distance between a and b
+func editDistance(a, b string) int {
+	prev := make([]int, len(b)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(a); i++ {
+		cur := make([]int, len(b)+1)
+		cur[0] = i
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			cur[j] = min(prev[j]+1, cur[j-1]+1, prev[j-1]+cost)
+		}
+		prev = cur
+	}
+	return prev[len(b)]
+}
+
+// showOriginFlag makes config list show where each value came from
+var showOriginFlag bool
+
 var configListCmd = &cobra.Command{
 	Use:   "list",
 	Short: "List all configuration",
+	Long: `List the effective configuration of the active profile, after flags and
+SFS_<KEY> environment variables are applied. With --show-origin, each value is
+followed by where it came from: a flag, an environment variable, the active
+profile, the config file or the built-in default.`,
+	Args: cobra.NoArgs,
 	RunE: func(cmd *cobra.Command, args []string) error {
-		all := config.GetAll()
+		configPath, err := config.GetConfigPath()
+		if err != nil {
+			return err
+		}
 
-		if len(all) == 0 {
-			fmt.Println("No configuration set")
-			return nil
+		r := configListReport{
+			Profile:  config.ActiveProfile(),
+			File:     configPath,
+			Settings: []configSetting{},
+		}
+		for _, setting := range config.Settings() {
+			value := setting.Value
+			// Mask API keys for security
+			if setting.Key == "api_key" && fmt.Sprint(value) != "" {
+				value = "********"
+			}
+			r.Settings = append(r.Settings, configSetting{Key: setting.Key, Value: value, Origin: setting.Origin})
 		}
 
-		fmt.Println("Current configuration:")
-		for key, value := range all {
-			// Mask api_key for security
-			if key == "api_key" {
-				fmt.Printf("  %s = ********\n", key)
-			} else {
-				fmt.Printf("  %s = %v\n", key, value)
+		return printReport(r, func() {
+			fmt.Printf("Current configuration (profile: %s, file: %s):\n", r.Profile, r.File)
+			w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+			for _, setting := range r.Settings {
+				if showOriginFlag {
+					fmt.Fprintf(w, "  %s = %v\t(%s)\n", setting.Key, setting.Value, setting.Origin)
+				} else {
+					fmt.Fprintf(w, "  %s = %v\n", setting.Key, setting.Value)
+				}
 			}
+			w.Flush()
+		})
+	},
+}
+
+// configListReport is the output of sfs config list
+type configListReport struct {
+	Profile  string          `json:"profile"`
+	File     string          `json:"file"`
+	Settings []configSetting `json:"settings"`
+}
+
+// configSetting is a setting and where its value came from
+type configSetting struct {
+	Key    string      `json:"key"`
+	Value  interface{} `json:"value"`
+	Origin string      `json:"origin"`
+}
+
+func (r configListReport) columns() []string {
+	return []string{"key", "value", "origin"}
+}
+
+func (r configListReport) rows() [][]string {
+	rows := make([][]string, len(r.Settings))
+	for i, setting := range r.Settings {
+		rows[i] = []string{setting.Key, settingText(setting.Value), setting.Origin}
+	}
+	return rows
+}
+
+// settingText formats a setting value for a table cell, joining lists with
+// commas as they are written on the command line
+func settingText(value interface{}) string {
+	switch v := value.(type) {
+	case []string:
+		return strings.Join(v, ",")
+	case []interface{}:
+		items := make([]string, len(v))
+		for i, item := range v {
+			items[i] = fmt.Sprint(item)
+		}
+		return strings.Join(items, ",")
+	}
+	return fmt.Sprint(value)
+}
+
+// setAPIKey saves the API key of the active profile, either in the config
+// file or in the encrypted secrets file. Only one copy is kept, so a stale
+// key can't shadow the new one.
+func setAPIKey(value string, encrypt bool) error {
+	store, err := secrets.OpenDefault()
+	if err != nil {
+		return err
+	}
+	profile := config.ActiveProfile()
+
+	if !encrypt {
+		if err := config.Set("api_key", value); err != nil {
+			return fmt.Errorf("failed to set config: %w", err)
+		}
+		if err := store.Delete(profile); err != nil {
+			return fmt.Errorf("failed to remove encrypted API key: %w", err)
+		}
+		fmt.Println("Configuration updated: api_key = ********")
+		return nil
+	}
+
+	// A new secrets file gets its passphrase confirmed
+	passphraseFunc := secrets.Passphrase
+	if store.Empty() {
+		passphraseFunc = secrets.NewPassphrase
+	}
+	passphrase, err := passphraseFunc()
+	if err != nil {
+		return err
+	}
+	if err := store.Set(profile, value, passphrase); err != nil {
+		return fmt.Errorf("failed to encrypt API key: %w", err)
+	}
+	if err := config.Set("api_key", ""); err != nil {
+		return fmt.Errorf("failed to remove plain-text API key: %w", err)
+	}
+
+	fmt.Printf("Configuration updated: api_key = ******** (encrypted in %s)\n", store.Path())
+	return nil
+}
+
+// hasEncryptedAPIKey reports whether the active profile's API key is in the
+// encrypted secrets file
+func hasEncryptedAPIKey() bool {
+	store, err := secrets.OpenDefault()
+	return err == nil && store.Has(config.ActiveProfile())
+}
+
+var profileAPIURLFlag string
+
+var configProfileCmd = &cobra.Command{
+	Use:   "profile",
+	Short: "Manage named profiles",
+	Long: `Manage named profiles, each with its own API URL, API key, watched
+directories and connection settings. Settings a profile doesn't set fall back
+to the top-level ones, which make up the "default" profile.
+
+The active profile is, in order of precedence, the one given with --profile,
+the SFS_PROFILE environment variable, or the one saved with 'profile use'.
+
+Examples:
+  sfs config profile add staging --api-url https://staging.example.com
+  sfs --profile staging config set api_key
+  sfs config profile use staging
+  SFS_PROFILE=default sfs list`,
+}
+
+var configProfileAddCmd = &cobra.Command{
+	Use:   "add <name>",
+	Short: "Add a profile",
+	Args:  cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		name := args[0]
+		if profileAPIURLFlag == "" {
+			return fmt.Errorf("--api-url is required")
+		}
+
+		if err := config.AddProfile(name, profileAPIURLFlag); err != nil {
+			return fmt.Errorf("failed to add profile: %w", err)
+		}
+
+		fmt.Printf("Added profile: %s (%s)\n", name, profileAPIURLFlag)
+		fmt.Printf("Set its API key with: sfs --profile %s config set api_key\n", name)
+		return nil
+	},
+}
+
+var configProfileUseCmd = &cobra.Command{
+	Use:   "use <name>",
+	Short: "Use a profile by default",
+	Args:  cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		name := args[0]
+		if err := config.UseProfile(name); err != nil {
+			return fmt.Errorf("failed to switch profile: %w", err)
+		}
+
+		fmt.Printf("Using profile: %s\n", name)
+		if env := os.Getenv(config.ProfileEnv); env != "" && env != name {
+			fmt.Fprintf(os.Stderr, "Note: %s=%s overrides this in the current shell\n", config.ProfileEnv, env)
+		}
+		return nil
+	},
+}
+
+var configProfileListCmd = &cobra.Command{
+	Use:   "list",
+	Short: "List profiles",
+	Args:  cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		active := config.ActiveProfile()
+
+		r := profileListReport{Profiles: []profileInfo{}}
+		for _, name := range append([]string{config.DefaultProfile}, config.Profiles()...) {
+			cfg, err := config.GetProfile(name)
+			if err != nil {
+				return err
+			}
+			r.Profiles = append(r.Profiles, profileInfo{
+				Name:      name,
+				Active:    name == active,
+				APIURL:    cfg.APIURL,
+				WatchDirs: append([]string{}, cfg.WatchDirs...),
+			})
+		}
+
+		return printReport(r, func() {
+			w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+			fmt.Fprintln(w, "\tPROFILE\tAPI URL\tWATCHED DIRS")
+			for _, profile := range r.Profiles {
+				marker := ""
+				if profile.Active {
+					marker = "*"
+				}
+				fmt.Fprintf(w, "%s\t%s\t%s\t%d\n", marker, profile.Name, profile.APIURL, len(profile.WatchDirs))
+			}
+			w.Flush()
+		})
+	},
+}
+
+// profileListReport is the output of sfs config profile list
+type profileListReport struct {
+	Profiles []profileInfo `json:"profiles"`
+}
+
+// profileInfo summarises a profile
+type profileInfo struct {
+	Name      string   `json:"name"`
+	Active    bool     `json:"active"`
+	APIURL    string   `json:"api_url"`
+	WatchDirs []string `json:"watch_dirs"`
+}
+
+func (r profileListReport) columns() []string {
+	return []string{"name", "active", "api_url", "watch_dirs"}
+}
+
+func (r profileListReport) rows() [][]string {
+	rows := make([][]string, len(r.Profiles))
+	for i, profile := range r.Profiles {
+		rows[i] = []string{profile.Name, strconv.FormatBool(profile.Active), profile.APIURL, strings.Join(profile.WatchDirs, ",")}
+	}
+	return rows
+}
+
+var configProfileRemoveCmd = &cobra.Command{
+	Use:   "remove <name>",
+	Short: "Remove a profile",
+	Args:  cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		name := args[0]
+		if err := config.RemoveProfile(name); err != nil {
+			return fmt.Errorf("failed to remove profile: %w", err)
 		}
+
+		fmt.Printf("Removed profile: %s\n", name)
 		return nil
 	},
 }
@@ -127,6 +537,19 @@ var configListCmd = &cobra.Command{
 func init() {
 	rootCmd.AddCommand(configCmd)
 	configCmd.AddCommand(configSetCmd)
+	configCmd.AddCommand(configUnsetCmd)
+	configCmd.AddCommand(configAddCmd)
+	configCmd.AddCommand(configRemoveCmd)
 	configCmd.AddCommand(configGetCmd)
 	configCmd.AddCommand(configListCmd)
+	configCmd.AddCommand(configProfileCmd)
+
+	configProfileCmd.AddCommand(configProfileAddCmd)
+	configProfileCmd.AddCommand(configProfileUseCmd)
+	configProfileCmd.AddCommand(configProfileListCmd)
+	configProfileCmd.AddCommand(configProfileRemoveCmd)
+	configSetCmd.Flags().BoolVar(&forceFlag, "force", false, "Set keys sfs doesn't know about")
+	configSetCmd.Flags().BoolVar(&encryptFlag, "encrypt", false, "Store api_key in the passphrase-encrypted secrets file")
+	configListCmd.Flags().BoolVar(&showOriginFlag, "show-origin", false, "Show where each value came from")
+	configProfileAddCmd.Flags().StringVar(&profileAPIURLFlag, "api-url", "", "Base URL of the SFS API for this profile")
 }
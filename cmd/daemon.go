@@ -264,7 +264,7 @@ var daemonRunCmd = &cobra.Command{
 	Short: "Run the daemon (used by systemd)",
 	Long:  `This command is called by systemd to run the daemon. Do not call this directly.`,
 	Run: func(cmd *cobra.Command, args []string) {
-		if err := daemon.Run(); err != nil {
+		if err := daemon.Run(cmd.Context()); err != nil {
 			fmt.Fprintf(os.Stderr, "Daemon error: %v\n", err)
 			os.Exit(1)
 		}
@@ -6,43 +6,107 @@ package cmd
 
 import (
 	"fmt"
+	"os"
 
 	"github.com/spf13/cobra"
-	"github.com/ThiagoAVicente/sfs-cli/internal/api"
+	"github.com/ThiagoAVicente/sfs-cli/internal/history"
 )
 
+var deleteWaitFlag bool
+
 // deleteCmd represents the delete command
 var deleteCmd = &cobra.Command{
-	Use:   "delete <filename>",
+	Use:   "delete <filename|path>",
 	Short: "Delete an indexed file",
 	Long: `Delete a file from the SFS system.
 
-This will remove both the file and its index data.
+This will remove both the file and its index data. The file is given by its
+server-side name or by the local path it was uploaded from (see sfs resolve).
+With --wait, the command blocks until the deletion job has finished.
 
 Examples:
   sfs delete document.pdf
-  sfs delete home_user_docs_notes.txt`,
+  sfs delete home_user_docs_notes.txt
+  sfs delete ./notes.txt
+  sfs delete --wait home_user_docs_notes.txt`,
 	Args: cobra.ExactArgs(1),
 	RunE: func(cmd *cobra.Command, args []string) error {
-		fileName := args[0]
+		m, err := loadNames().Resolve(args[0])
+		if err != nil {
+			return err
+		}
+		fileName := m.Name
 
-		client, err := api.NewClient()
+		client, err := newClient()
 		if err != nil {
 			return err
 		}
 
-		result, err := client.DeleteFile(fileName)
+		result, err := client.DeleteFile(cmd.Context(), fileName)
 		if err != nil {
 			return err
 		}
 
-		fmt.Printf("File deleted: %s\n", fileName)
-		fmt.Printf("Job ID: %s\n", result.JobID)
+		if m.Path != "" {
+			fmt.Fprintf(humanOut(), "File deleted: %s (%s)\n", fileName, m.Path)
+		} else {
+			fmt.Fprintf(humanOut(), "File deleted: %s\n", fileName)
+		}
+		fmt.Fprintf(humanOut(), "Job ID: %s\n", result.JobID)
+		recordJob(openHistory(), history.Job{ID: result.JobID, Op: history.OpDelete, Path: m.Path, Name: fileName})
+		forgetSynced(fileName)
 
-		return nil
+		r := deleteReport{File: fileName, Path: m.Path, JobID: result.JobID}
+		var waitErr error
+		if deleteWaitFlag {
+			var outcomes []jobOutcome
+			outcomes, waitErr = waitForJobs(cmd.Context(), client, []job{{ID: result.JobID, Label: fileName}})
+			if len(outcomes) == 1 {
+				r.Status = outcomes[0].Status
+			}
+		}
+
+		if err := printReport(r, nil); err != nil {
+			return err
+		}
+		return waitErr
 	},
 }
 
+// forgetSynced drops the sync state entry of a file deleted from the index,
+// so sync and the daemon treat it as never uploaded
+func forgetSynced(name string) {
+	store := openState()
+	if store == nil {
+		return
+	}
+	entry, ok := store.FindRemote(name)
+	if !ok {
+		return
+	}
+	if err := store.Delete(entry.Path); err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: Could not update the sync state: %v\n", err)
+	}
+}
+
+// deleteReport is the output of sfs delete
+type deleteReport struct {
+	File   string `json:"file"`
+	Path   string `json:"path,omitempty"`
+	JobID  string `json:"job_id"`
+	Status string `json:"status,omitempty"`
+}
+
+func (r deleteReport) columns() []string {
+	return []string{"file", "path", "job_id", "status"}
+}
+
+func (r deleteReport) rows() [][]string {
+	return [][]string{{r.File, r.Path, r.JobID, r.Status}}
+}
+
 func init() {
 	rootCmd.AddCommand(deleteCmd)
+	deleteCmd.Flags().BoolVarP(&deleteWaitFlag, "wait", "w", false, "Wait until the file is removed from the index")
+	addWaitFlags(deleteCmd, "wait-timeout")
 }
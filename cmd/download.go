@@ -5,55 +5,370 @@ Copyright © 2026 T. Vicente<thiagoaureliovicente@gmail.com>
 package cmd
 
 import (
+	"errors"
 	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
 
 	"github.com/spf13/cobra"
-	"github.com/ThiagoAVicente/sfs-cli/internal/api"
+	"github.com/ThiagoAVicente/sfs-cli/internal/config"
+	"github.com/ThiagoAVicente/sfs-cli/internal/names"
+	"github.com/ThiagoAVicente/sfs-cli/internal/pool"
+	"github.com/ThiagoAVicente/sfs-cli/internal/state"
 )
 
-var outputPath string
+var (
+	destFlag      string
+	overwriteFlag bool
+	allFlag       bool
+	restorePrefix string
+	dryRunFlag    bool
+)
 
 // downloadCmd represents the download command
 var downloadCmd = &cobra.Command{
-	Use:   "download <filename> [output]",
+	Use:   "download <filename|path> [output]",
 	Short: "Download a file from the SFS system",
 	Long: `Download a file that has been stored in the SFS system.
 
-If output path is not specified, the file will be downloaded with its original name.
+The file is given by its server-side name or by the local path it was
+uploaded from (see sfs resolve). If output path is not specified, the file will
+be downloaded with its original name, or to the local path it was given by.
+Use - as the output path to write the file to stdout instead.
+
+The file is saved under a temporary .sfs-part name and only renamed once it is
+complete. If a download is interrupted, the partial file is kept and running
+the same command again resumes it, as long as the server supports it and the
+file hasn't changed. Existing files are not overwritten without --force.
+
+With --all, every stored file (or those starting with --prefix) is downloaded
+into the --dest directory (the current one by default), several at a time
+(upload_concurrency). Files uploaded from a
+known local path (see sfs resolve) are put back at that path under --dest;
+other files are saved under their server-side name. Files already
+present with the contents recorded in the sync state are skipped, as are
+other existing files unless --force is given. Use --dry-run to list what
+would be downloaded.
 
 Examples:
   sfs download document.pdf
   sfs download home_user_docs_notes.txt ./notes.txt
-  sfs download file.txt --output ./downloaded.txt`,
-	Args: cobra.RangeArgs(1, 2),
+  sfs download ~/docs/notes.txt --force   # Put back the uploaded version
+  sfs download file.txt --dest ./downloaded.txt
+  sfs download notes.txt - | less
+  sfs download file.txt --force
+  sfs download --all --dest ~/restore
+  sfs download --all --prefix home_user_docs --dest ~/restore --dry-run`,
+	Args: func(cmd *cobra.Command, args []string) error {
+		if allFlag {
+			return cobra.NoArgs(cmd, args)
+		}
+		return cobra.RangeArgs(1, 2)(cmd, args)
+	},
 	RunE: func(cmd *cobra.Command, args []string) error {
-		fileName := args[0]
+		if allFlag {
+			return downloadAll(cmd)
+		}
+		if cmd.Flags().Changed("prefix") || dryRunFlag {
+			return fmt.Errorf("--prefix and --dry-run only apply to --all")
+		}
+		m, err := loadNames().Resolve(args[0])
+		if err != nil {
+			return err
+		}
+		fileName := m.Name
 
 		// Determine output path
-		dest := outputPath
+		dest := destFlag
 		if dest == "" && len(args) > 1 {
 			dest = args[1]
 		}
 		if dest == "" {
 			dest = fileName
+			if m.Name != args[0] {
+				// Given a local path, download to it
+				dest = m.Path
+			}
 		}
 
-		client, err := api.NewClient()
+		client, err := newClient()
 		if err != nil {
 			return err
 		}
 
-		if err := client.DownloadFile(fileName, dest); err != nil {
+		if dest == "-" {
+			if structured() {
+				return fmt.Errorf("--output %s can't be used when downloading to stdout", outputFlag)
+			}
+			return client.Download(cmd.Context(), fileName, os.Stdout)
+		}
+
+		if err := client.DownloadFile(cmd.Context(), fileName, dest, overwriteFlag); err != nil {
+			if errors.Is(err, fs.ErrExist) {
+				return fmt.Errorf("%w (use --force to overwrite it)", err)
+			}
 			return err
 		}
 
-		fmt.Printf("File downloaded: %s -> %s\n", fileName, dest)
+		r := downloadReport{File: fileName, Path: dest}
+		return printReport(r, func() {
+			fmt.Printf("File downloaded: %s -> %s\n", r.File, r.Path)
+		})
+	},
+}
+
+// downloadReport is the output of sfs download for a single file
+type downloadReport struct {
+	File string `json:"file"`
+	Path string `json:"path"`
+}
+
+func (r downloadReport) columns() []string {
+	return []string{"file", "path"}
+}
+
+func (r downloadReport) rows() [][]string {
+	return [][]string{{r.File, r.Path}}
+}
+
+// restoreReport is the output of sfs download --all
+type restoreReport struct {
+	DryRun bool `json:"dry_run"`
+	// Downloaded lists the files downloaded, or with --dry-run those that
+	// would be
+	Downloaded []restoredFile   `json:"downloaded"`
+	Skipped    []skippedFile    `json:"skipped"`
+	Failed     []failedDownload `json:"failed"`
+	NotStarted int              `json:"not_started"`
+}
+
+// restoredFile is a stored file and where it was downloaded to
+type restoredFile struct {
+	Name string `json:"name"`
+	Path string `json:"path"`
+}
+
+// failedDownload is a stored file that couldn't be downloaded
+type failedDownload struct {
+	Name  string `json:"name"`
+	Error string `json:"error"`
+}
+
+func (r restoreReport) columns() []string {
+	return []string{"result", "name", "path", "detail"}
+}
+
+// rows lists every file with the skip reason or error as its detail
+func (r restoreReport) rows() [][]string {
+	downloaded := "downloaded"
+	if r.DryRun {
+		downloaded = "planned"
+	}
+
+	var rows [][]string
+	for _, file := range r.Downloaded {
+		rows = append(rows, []string{downloaded, file.Name, file.Path, ""})
+	}
+	for _, file := range r.Skipped {
+		rows = append(rows, []string{"skipped", "", file.Path, file.Reason})
+	}
+	for _, file := range r.Failed {
+		rows = append(rows, []string{"failed", file.Name, "", file.Error})
+	}
+	return rows
+}
+
+// restoreItem is a stored file to download with --all
+type restoreItem struct {
+	Name  string
+	Path  string
+	Entry state.Entry
+	// Synced is set when the sync state knows the file
+	Synced bool
+}
 
+// downloadAll downloads every stored file matching --prefix into --dest
+func downloadAll(cmd *cobra.Command) error {
+	ctx := cmd.Context()
+
+	client, err := newClient()
+	if err != nil {
+		return err
+	}
+	list, err := client.ListFiles(ctx, restorePrefix)
+	if err != nil {
+		return err
+	}
+
+	if destFlag == "" {
+		destFlag = "."
+	}
+	dest, err := filepath.Abs(destFlag)
+	if err != nil {
+		return fmt.Errorf("failed to resolve path: %w", err)
+	}
+	known := loadNames()
+	synced := syncedByName()
+
+	r := restoreReport{
+		DryRun:     dryRunFlag,
+		Downloaded: []restoredFile{},
+		Skipped:    []skippedFile{},
+		Failed:     []failedDownload{},
+	}
+	var items []restoreItem
+	planned := make(map[string]string)
+	for _, name := range list.Files {
+		item, err := planRestore(dest, name, known, synced)
+		if other, ok := planned[item.Path]; ok && err == nil {
+			err = fmt.Errorf("%s goes to the same path", other)
+		}
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Failed: %s: %v\n", name, err)
+			r.Failed = append(r.Failed, failedDownload{Name: name, Error: err.Error()})
+			continue
+		}
+		planned[item.Path] = name
+
+		if reason := restoreSkipReason(item); reason != "" {
+			fmt.Fprintf(humanOut(), "Skipped: %s (%s)\n", item.Path, reason)
+			r.Skipped = append(r.Skipped, skippedFile{Path: item.Path, Reason: reason})
+			continue
+		}
+		items = append(items, item)
+	}
+
+	if dryRunFlag {
+		for _, item := range items {
+			fmt.Fprintf(humanOut(), "Would download: %s -> %s\n", item.Name, item.Path)
+			r.Downloaded = append(r.Downloaded, restoredFile{Name: item.Name, Path: item.Path})
+		}
+		fmt.Fprintf(humanOut(), "\nWould download: %d, skipped: %d, failed: %d\n", len(items), len(r.Skipped), len(r.Failed))
+		if err := printReport(r, nil); err != nil {
+			return err
+		}
+		if len(r.Failed) > 0 {
+			return fmt.Errorf("%d of %d files can't be downloaded", len(r.Failed), len(list.Files))
+		}
 		return nil
-	},
+	}
+
+	poolOpts := pool.Options{
+		Workers: config.GetUploadConcurrency(),
+		Limiter: pool.NewLimiter(config.GetUploadRateLimit()),
+	}
+	errs := pool.Run(ctx, poolOpts, items, func(item restoreItem) error {
+		if err := os.MkdirAll(filepath.Dir(item.Path), 0755); err != nil {
+			return fmt.Errorf("failed to create directory: %w", err)
+		}
+		if err := client.DownloadFile(ctx, item.Name, item.Path, true); err != nil {
+			return err
+		}
+		fmt.Fprintf(humanOut(), "File downloaded: %s -> %s\n", item.Name, item.Path)
+		return nil
+	})
+
+	var firstErr error
+	for i, err := range errs {
+		item := items[i]
+		switch {
+		case err == nil:
+			r.Downloaded = append(r.Downloaded, restoredFile{Name: item.Name, Path: item.Path})
+		case errors.Is(err, pool.ErrNotStarted):
+			r.NotStarted++
+		default:
+			fmt.Fprintf(os.Stderr, "Failed: %s: %v\n", item.Name, err)
+			r.Failed = append(r.Failed, failedDownload{Name: item.Name, Error: err.Error()})
+			if firstErr == nil {
+				firstErr = err
+			}
+		}
+	}
+	downloaded, failed, cancelled := len(r.Downloaded), len(r.Failed), r.NotStarted
+
+	fmt.Fprintf(humanOut(), "\nDownloaded: %d, skipped: %d, failed: %d", downloaded, len(r.Skipped), failed)
+	if cancelled > 0 {
+		fmt.Fprintf(humanOut(), ", not started: %d", cancelled)
+	}
+	fmt.Fprintln(humanOut())
+
+	if err := printReport(r, nil); err != nil {
+		return err
+	}
+
+	switch {
+	case failed > 0 && downloaded == 0 && cancelled == 0 && firstErr != nil:
+		// Nothing got through, so the exit code follows the first failure
+		return fmt.Errorf("%d of %d files failed to download: %w", failed, len(list.Files), firstErr)
+	case failed > 0:
+		return fmt.Errorf("%d of %d files failed to download", failed, len(list.Files))
+	case cancelled > 0:
+		return fmt.Errorf("download interrupted, %d files not downloaded", cancelled)
+	}
+	return nil
+}
+
+// syncedByName returns the sync state entries by server-side name, or none
+// if the state can't be read
+func syncedByName() map[string]state.Entry {
+	entries := make(map[string]state.Entry)
+	store, err := state.OpenDefault()
+	if err != nil {
+		return entries
+	}
+	for _, entry := range store.List() {
+		entries[entry.RemoteName] = entry
+	}
+	return entries
+}
+
+// planRestore works out where the stored file called name goes under dest:
+// the local path it was uploaded from re-rooted at dest if that is known,
+// else its server-side name directly inside dest
+func planRestore(dest, name string, known *names.Map, synced map[string]state.Entry) (restoreItem, error) {
+	item := restoreItem{Name: name}
+	if m := known.Path(name); m.Path != "" {
+		path := strings.TrimPrefix(m.Path, filepath.VolumeName(m.Path))
+		item.Path = filepath.Join(dest, path)
+		if entry, ok := synced[name]; ok && entry.Path == m.Path {
+			item.Entry, item.Synced = entry, true
+		}
+		return item, nil
+	}
+
+	// Names come from the server, so don't let one escape dest
+	if !filepath.IsLocal(name) || strings.ContainsAny(name, `/\`) {
+		return item, fmt.Errorf("unsafe file name")
+	}
+	item.Path = filepath.Join(dest, name)
+	return item, nil
+}
+
+// restoreSkipReason returns why item shouldn't be downloaded, or "" if it
+// should
+func restoreSkipReason(item restoreItem) string {
+	info, err := os.Stat(item.Path)
+	if err != nil {
+		return ""
+	}
+	if item.Synced && item.Entry.Synced() && !info.IsDir() && item.Entry.Matches(item.Path, info) {
+		return "identical"
+	}
+	if !overwriteFlag {
+		return "already exists, use --force to replace it"
+	}
+	return ""
 }
 
 func init() {
 	rootCmd.AddCommand(downloadCmd)
-	downloadCmd.Flags().StringVarP(&outputPath, "output", "o", "", "Output file path")
+	downloadCmd.Flags().StringVarP(&destFlag, "dest", "o", "", "Output file path, or - for stdout; with --all, the directory to download into (default .)")
+	// -o was short for the old --output, which is now the output format
+	downloadCmd.Flags().MarkShorthandDeprecated("dest", "use --dest instead")
+	downloadCmd.Flags().BoolVar(&overwriteFlag, "force", false, "Overwrite the output file if it exists")
+	downloadCmd.Flags().BoolVar(&allFlag, "all", false, "Download every stored file")
+	downloadCmd.Flags().StringVarP(&restorePrefix, "prefix", "p", "", "With --all, only download files starting with this prefix")
+	downloadCmd.Flags().BoolVar(&dryRunFlag, "dry-run", false, "With --all, list what would be downloaded without downloading")
 }
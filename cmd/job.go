@@ -0,0 +1,597 @@
+/*
+Copyright © 2026 T. Vicente<thiagoaureliovicente@gmail.com>
+
+*/
+package cmd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"slices"
+	"text/tabwriter"
+	"time"
+
+	"github.com/spf13/cobra"
+	"github.com/ThiagoAVicente/sfs-cli/internal/api"
+	"github.com/ThiagoAVicente/sfs-cli/internal/config"
+	"github.com/ThiagoAVicente/sfs-cli/internal/history"
+	"github.com/ThiagoAVicente/sfs-cli/internal/pool"
+	"github.com/ThiagoAVicente/sfs-cli/internal/state"
+)
+
+const (
+	defaultJobTimeout  = 10 * time.Minute
+	defaultJobInterval = 2 * time.Second
+)
+
+var (
+	jobTimeout  time.Duration
+	jobInterval time.Duration
+
+	jobFailedFlag   bool
+	jobPendingFlag  bool
+	jobLimitFlag    int
+	jobNoRefresh    bool
+	jobResubmitWait bool
+)
+
+// jobCmd represents the job command
+var jobCmd = &cobra.Command{
+	Use:   "job",
+	Short: "Inspect indexing jobs",
+	Long: `Inspect the indexing jobs started by uploads and deletes.
+
+Every upload or delete returns a job ID. The file only becomes searchable (or
+disappears from search results) once its job has completed.
+
+Every job submitted by the CLI or the daemon is recorded in
+~/.config/sfs/history.jsonl, so past jobs can be listed and failed ones
+resubmitted. Listing and resubmitting only cover the jobs of the active
+profile.`,
+}
+
+var jobStatusCmd = &cobra.Command{
+	Use:   "status <job-id>",
+	Short: "Show the status of a job",
+	Args:  cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		client, err := newClient()
+		if err != nil {
+			return err
+		}
+
+		status, err := client.GetJobStatus(cmd.Context(), args[0])
+		if err != nil {
+			return err
+		}
+		recordStatus(openHistory(), openState(), args[0], status.Status)
+
+		r := jobStatusReport{JobID: status.JobID, Status: status.Status}
+		return printReport(r, func() {
+			fmt.Printf("Job ID: %s\n", r.JobID)
+			fmt.Printf("Status: %s\n", r.Status)
+		})
+	},
+}
+
+var jobWaitCmd = &cobra.Command{
+	Use:   "wait <job-id>...",
+	Short: "Wait for jobs to finish",
+	Long: `Poll jobs until each of them completes or fails.
+
+The command fails if any job failed or didn't finish within the timeout.
+
+Examples:
+  sfs job wait 3f2a9c
+  sfs job wait 3f2a9c 8d41e0 --timeout 30m`,
+	Args: cobra.MinimumNArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		client, err := newClient()
+		if err != nil {
+			return err
+		}
+
+		jobs := make([]job, len(args))
+		for i, id := range args {
+			jobs[i] = job{ID: id}
+		}
+		outcomes, err := waitForJobs(cmd.Context(), client, jobs)
+		if err := printReport(waitReport{Jobs: outcomes}, nil); err != nil {
+			return err
+		}
+		return err
+	},
+}
+
+var jobListCmd = &cobra.Command{
+	Use:   "list",
+	Short: "List recorded jobs",
+	Long: `List the jobs submitted by the CLI and the daemon, most recent last.
+
+The status of listed jobs that haven't finished yet is refreshed from the API
+first, unless --no-refresh is given.
+
+Examples:
+  sfs job list
+  sfs job list --failed
+  sfs job list --pending --limit 0`,
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		jobLog, err := history.OpenDefault()
+		if err != nil {
+			return err
+		}
+
+		jobs, err := jobLog.List()
+		if err != nil {
+			return err
+		}
+		jobs = profileJobs(jobs)
+
+		listed := func(j history.Job) bool {
+			return (!jobFailedFlag || (j.Failed() && j.ResubmittedAs == "")) &&
+				(!jobPendingFlag || j.Pending())
+		}
+
+		// Only the jobs that are listed get refreshed. Pending ones may turn
+		// out to have failed, so they are only dropped once refreshed.
+		jobs = slices.DeleteFunc(jobs, func(j history.Job) bool {
+			return !listed(j) && (jobNoRefresh || !j.Pending())
+		})
+		if jobLimitFlag > 0 && len(jobs) > jobLimitFlag {
+			jobs = jobs[len(jobs)-jobLimitFlag:]
+		}
+		if !jobNoRefresh {
+			jobs = refreshJobs(cmd.Context(), jobLog, jobs)
+			jobs = slices.DeleteFunc(jobs, func(j history.Job) bool { return !listed(j) })
+		}
+
+		r := jobListReport{Jobs: jobs}
+		if r.Jobs == nil {
+			r.Jobs = []history.Job{}
+		}
+		return printReport(r, func() {
+			if len(r.Jobs) == 0 {
+				fmt.Println("No jobs found")
+				return
+			}
+
+			w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+			fmt.Fprintln(w, "SUBMITTED\tOP\tSTATUS\tSOURCE\tJOB ID\tFILE")
+			for _, j := range r.Jobs {
+				fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\n",
+					j.SubmittedAt.Local().Format("2006-01-02 15:04"), j.Op, jobListStatus(j), j.Source, j.ID, jobFile(j))
+			}
+			w.Flush()
+		})
+	},
+}
+
+// jobStatusReport is the output of sfs job status
+type jobStatusReport struct {
+	JobID  string `json:"job_id"`
+	Status string `json:"status"`
+}
+
+func (r jobStatusReport) columns() []string {
+	return []string{"job_id", "status"}
+}
+
+func (r jobStatusReport) rows() [][]string {
+	return [][]string{{r.JobID, r.Status}}
+}
+
+// jobListReport is the output of sfs job list, oldest job first
+type jobListReport struct {
+	Jobs []history.Job `json:"jobs"`
+}
+
+func (r jobListReport) columns() []string {
+	return []string{"submitted_at", "op", "status", "source", "job_id", "file"}
+}
+
+func (r jobListReport) rows() [][]string {
+	rows := make([][]string, len(r.Jobs))
+	for i, j := range r.Jobs {
+		rows[i] = []string{j.SubmittedAt.Format(time.RFC3339), j.Op, jobListStatus(j), j.Source, j.ID, jobFile(j)}
+	}
+	return rows
+}
+
+// jobListStatus returns the status of a listed job, noting resubmissions
+func jobListStatus(j history.Job) string {
+	if j.ResubmittedAs != "" {
+		return j.Status + " (resubmitted)"
+	}
+	return j.Status
+}
+
+// jobFile returns the local path of a job's file, or its server name if the
+// path isn't known
+func jobFile(j history.Job) string {
+	if j.Path == "" {
+		return j.Name
+	}
+	return j.Path
+}
+
+var jobResubmitCmd = &cobra.Command{
+	Use:   "resubmit [job-id...]",
+	Short: "Submit failed jobs again",
+	Long: `Submit recorded jobs again: uploads re-upload the local file (replacing
+any existing copy) and deletes delete the server file again.
+
+Examples:
+  sfs job resubmit 3f2a9c
+  sfs job resubmit --failed --wait`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if len(args) == 0 && !jobFailedFlag {
+			return fmt.Errorf("specify job IDs or --failed")
+		}
+
+		jobLog, err := history.OpenDefault()
+		if err != nil {
+			return err
+		}
+
+		all, err := jobLog.List()
+		if err != nil {
+			return err
+		}
+
+		var jobs []history.Job
+		for _, j := range profileJobs(all) {
+			if slices.Contains(args, j.ID) || (jobFailedFlag && j.Failed() && j.ResubmittedAs == "") {
+				jobs = append(jobs, j)
+			}
+		}
+		for _, id := range args {
+			if slices.ContainsFunc(jobs, func(j history.Job) bool { return j.ID == id }) {
+				continue
+			}
+			// Jobs of other profiles have to be resubmitted to their own server
+			if i := slices.IndexFunc(all, func(j history.Job) bool { return j.ID == id }); i >= 0 {
+				profile := all[i].ProfileName()
+				return fmt.Errorf("job %s belongs to profile %s. Run: sfs --profile %s job resubmit %s", id, profile, profile, id)
+			}
+			return fmt.Errorf("no recorded job: %s", id)
+		}
+
+		if len(jobs) == 0 {
+			fmt.Fprintln(humanOut(), "No failed jobs to resubmit")
+			return printReport(resubmitReport{Jobs: []resubmission{}}, nil)
+		}
+
+		client, err := newClient()
+		if err != nil {
+			return err
+		}
+
+		r := resubmitReport{Jobs: make([]resubmission, len(jobs))}
+		indexes := make([]int, len(jobs))
+		for i, old := range jobs {
+			indexes[i] = i
+			r.Jobs[i] = resubmission{OldJobID: old.ID, Op: old.Op, File: jobFile(old)}
+		}
+
+		opts := pool.Options{Workers: config.GetUploadConcurrency()}
+		errs := pool.Run(cmd.Context(), opts, indexes, func(i int) error {
+			old := jobs[i]
+			newJob, err := resubmit(cmd.Context(), client, old)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "Failed to resubmit %s: %v\n", old.ID, err)
+				r.Jobs[i].Error = err.Error()
+				return err
+			}
+
+			if err := jobLog.Add(newJob); err != nil {
+				fmt.Fprintf(os.Stderr, "Warning: Could not record job %s: %v\n", newJob.ID, err)
+			}
+			if err := jobLog.Update(history.Job{ID: old.ID, ResubmittedAs: newJob.ID}); err != nil {
+				fmt.Fprintf(os.Stderr, "Warning: Could not record job %s: %v\n", old.ID, err)
+			}
+
+			fmt.Fprintf(humanOut(), "Resubmitted %s of %s as job %s\n", newJob.Op, jobFile(newJob), newJob.ID)
+			r.Jobs[i].JobID = newJob.ID
+			return nil
+		})
+
+		failed := 0
+		var submitted []job
+		var submittedIndexes []int
+		for i, err := range errs {
+			if err != nil {
+				failed++
+				continue
+			}
+			submitted = append(submitted, job{ID: r.Jobs[i].JobID, Label: r.Jobs[i].File})
+			submittedIndexes = append(submittedIndexes, i)
+		}
+
+		var waitErr error
+		if jobResubmitWait {
+			var outcomes []jobOutcome
+			outcomes, waitErr = waitForJobs(cmd.Context(), client, submitted)
+			for k, outcome := range outcomes {
+				r.Jobs[submittedIndexes[k]].Status = outcome.Status
+			}
+		}
+
+		if err := printReport(r, nil); err != nil {
+			return err
+		}
+		if failed > 0 {
+			return fmt.Errorf("%d of %d jobs could not be resubmitted", failed, len(jobs))
+		}
+		return waitErr
+	},
+}
+
+// resubmitReport is the output of sfs job resubmit
+type resubmitReport struct {
+	Jobs []resubmission `json:"jobs"`
+}
+
+// resubmission is a job submitted again, and the job that replaced it
+type resubmission struct {
+	OldJobID string `json:"old_job_id"`
+	JobID    string `json:"job_id,omitempty"`
+	Op       string `json:"op"`
+	File     string `json:"file"`
+	Status   string `json:"status,omitempty"`
+	Error    string `json:"error,omitempty"`
+}
+
+func (r resubmitReport) columns() []string {
+	return []string{"old_job_id", "job_id", "op", "status", "error", "file"}
+}
+
+func (r resubmitReport) rows() [][]string {
+	rows := make([][]string, len(r.Jobs))
+	for i, j := range r.Jobs {
+		rows[i] = []string{j.OldJobID, j.JobID, j.Op, j.Status, j.Error, j.File}
+	}
+	return rows
+}
+
+// resubmit repeats the operation of a recorded job and returns the new job
+func resubmit(ctx context.Context, client api.Service, old history.Job) (history.Job, error) {
+	newJob := history.Job{Op: old.Op, Path: old.Path, Name: old.Name, Source: history.SourceCLI, Profile: old.Profile}
+
+	switch old.Op {
+	case history.OpUpload:
+		if old.Path == "" {
+			return newJob, errors.New("local path unknown")
+		}
+		result, err := client.UploadFile(ctx, old.Path, true)
+		if err != nil {
+			return newJob, err
+		}
+		newJob.ID = result.JobID
+
+	case history.OpDelete:
+		result, err := client.DeleteFile(ctx, old.Name)
+		if err != nil {
+			return newJob, err
+		}
+		newJob.ID = result.JobID
+
+	default:
+		return newJob, fmt.Errorf("unknown operation: %s", old.Op)
+	}
+	return newJob, nil
+}
+
+// refreshJobs fetches the current status of pending jobs from the API and
+// records any change. Jobs are returned unchanged if the API is unreachable.
+func refreshJobs(ctx context.Context, jobLog *history.Log, jobs []history.Job) []history.Job {
+	var pending []int
+	for i, j := range jobs {
+		if j.Pending() {
+			pending = append(pending, i)
+		}
+	}
+	if len(pending) == 0 {
+		return jobs
+	}
+
+	client, err := newClient()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: Could not refresh job status: %v\n", err)
+		return jobs
+	}
+
+	store := openState()
+	opts := pool.Options{Workers: config.GetUploadConcurrency()}
+	errs := pool.Run(ctx, opts, pending, func(i int) error {
+		status, err := client.GetJobStatus(ctx, jobs[i].ID)
+		if err != nil {
+			return err
+		}
+		if status.Status != jobs[i].Status {
+			jobs[i].Status = status.Status
+			recordStatus(jobLog, store, jobs[i].ID, status.Status)
+		}
+		return nil
+	})
+
+	for _, err := range errs {
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Warning: Could not refresh job status: %v\n", err)
+			break
+		}
+	}
+	return jobs
+}
+
+// openHistory opens the job history, warning instead of failing if it can't
+// be opened. The returned log may be nil, which records nothing.
+func openHistory() *history.Log {
+	jobLog, err := history.OpenDefault()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: Could not open job history: %v\n", err)
+		return nil
+	}
+	return jobLog
+}
+
+// openState opens the sync state, warning instead of failing if it can't be
+// read. The returned store may be nil.
+func openState() *state.Store {
+	store, err := state.OpenDefault()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: Could not read the sync state: %v\n", err)
+		return nil
+	}
+	return store
+}
+
+// profileJobs returns the jobs submitted to the active profile
+func profileJobs(jobs []history.Job) []history.Job {
+	active := config.ActiveProfile()
+	var matching []history.Job
+	for _, j := range jobs {
+		if j.ProfileName() == active {
+			matching = append(matching, j)
+		}
+	}
+	return matching
+}
+
+// recordJob adds a job submitted by the CLI to the history
+func recordJob(jobLog *history.Log, j history.Job) {
+	j.Source = history.SourceCLI
+	j.Profile = config.ActiveProfile()
+	if err := jobLog.Add(j); err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: Could not record job %s: %v\n", j.ID, err)
+	}
+}
+
+// recordStatus records the latest known status of a job, and its outcome
+// on the sync state entry of the file it was submitted for. store may be nil.
+func recordStatus(jobLog *history.Log, store *state.Store, id, status string) {
+	if err := jobLog.Update(history.Job{ID: id, Status: status}); err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: Could not record job %s: %v\n", id, err)
+	}
+	if store == nil || !api.IsTerminalStatus(status) {
+		return
+	}
+	if err := store.FinishJob(id, api.IsFailedStatus(status)); err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: Could not record sync state for job %s: %v\n", id, err)
+	}
+}
+
+// job is an indexing job to wait for, with an optional description
+type job struct {
+	ID    string
+	Label string
+}
+
+func (j job) String() string {
+	if j.Label == "" {
+		return j.ID
+	}
+	return fmt.Sprintf("%s (%s)", j.ID, j.Label)
+}
+
+// jobOutcome is how a job that was waited for ended
+type jobOutcome struct {
+	JobID  string `json:"job_id"`
+	Label  string `json:"label,omitempty"`
+	Status string `json:"status,omitempty"`
+	Error  string `json:"error,omitempty"`
+}
+
+// waitReport is the output of sfs job wait
+type waitReport struct {
+	Jobs []jobOutcome `json:"jobs"`
+}
+
+func (r waitReport) columns() []string {
+	return []string{"job_id", "status", "error", "label"}
+}
+
+func (r waitReport) rows() [][]string {
+	rows := make([][]string, len(r.Jobs))
+	for i, outcome := range r.Jobs {
+		rows[i] = []string{outcome.JobID, outcome.Status, outcome.Error, outcome.Label}
+	}
+	return rows
+}
+
+// waitForJobs waits for all jobs to finish, printing the outcome of each, and
+// returns the outcomes in the order of jobs, with an error if any of them
+// failed or timed out
+func waitForJobs(ctx context.Context, client api.Service, jobs []job) ([]jobOutcome, error) {
+	if len(jobs) == 0 {
+		return nil, nil
+	}
+
+	fmt.Fprintf(humanOut(), "Waiting for %d job(s) to finish...\n", len(jobs))
+
+	outcomes := make([]jobOutcome, len(jobs))
+	for i, j := range jobs {
+		outcomes[i] = jobOutcome{JobID: j.ID, Label: j.Label}
+	}
+
+	jobLog, store := openHistory(), openState()
+	opts := pool.Options{Workers: config.GetUploadConcurrency()}
+	indexes := make([]int, len(jobs))
+	for i := range indexes {
+		indexes[i] = i
+	}
+	errs := pool.Run(ctx, opts, indexes, func(i int) error {
+		j := jobs[i]
+		status, err := client.WaitForJob(ctx, j.ID, jobInterval, jobTimeout)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Job %s: %v\n", j, err)
+			outcomes[i].Error = err.Error()
+			return err
+		}
+		recordStatus(jobLog, store, j.ID, status.Status)
+
+		fmt.Fprintf(humanOut(), "Job %s: %s\n", j, status.Status)
+		outcomes[i].Status = status.Status
+		if status.Failed() {
+			return fmt.Errorf("job %s %s", j.ID, status.Status)
+		}
+		return nil
+	})
+
+	failed := 0
+	for _, err := range errs {
+		if err != nil {
+			failed++
+		}
+	}
+	if failed > 0 {
+		return outcomes, fmt.Errorf("%d of %d jobs failed or didn't finish", failed, len(jobs))
+	}
+	return outcomes, nil
+}
+
+// addWaitFlags registers the flags controlling how long to wait for jobs
+func addWaitFlags(cmd *cobra.Command, timeoutName string) {
+	cmd.Flags().DurationVar(&jobTimeout, timeoutName, defaultJobTimeout, "Give up waiting after this long, 0 to wait forever")
+	cmd.Flags().DurationVar(&jobInterval, "interval", defaultJobInterval, "How often to poll job status")
+}
+
+func init() {
+	rootCmd.AddCommand(jobCmd)
+	jobCmd.AddCommand(jobStatusCmd)
+	jobCmd.AddCommand(jobWaitCmd)
+	jobCmd.AddCommand(jobListCmd)
+	jobCmd.AddCommand(jobResubmitCmd)
+	addWaitFlags(jobWaitCmd, "timeout")
+
+	jobListCmd.Flags().BoolVar(&jobFailedFlag, "failed", false, "Only show failed jobs that weren't resubmitted")
+	jobListCmd.Flags().BoolVar(&jobPendingFlag, "pending", false, "Only show jobs that haven't finished")
+	jobListCmd.Flags().IntVarP(&jobLimitFlag, "limit", "n", 50, "Show at most this many of the most recent jobs, 0 for all")
+	jobListCmd.Flags().BoolVar(&jobNoRefresh, "no-refresh", false, "Don't query the API for the status of pending jobs")
+
+	jobResubmitCmd.Flags().BoolVar(&jobFailedFlag, "failed", false, "Resubmit every failed job that wasn't resubmitted yet")
+	jobResubmitCmd.Flags().BoolVarP(&jobResubmitWait, "wait", "w", false, "Wait until the resubmitted jobs finish")
+	addWaitFlags(jobResubmitCmd, "wait-timeout")
+}
@@ -8,7 +8,6 @@ import (
 	"fmt"
 
 	"github.com/spf13/cobra"
-	"github.com/ThiagoAVicente/sfs-cli/internal/api"
 )
 
 var prefixFilter string
@@ -26,30 +25,53 @@ Examples:
   sfs list --prefix docs_
   sfs list --prefix home_user_`,
 	RunE: func(cmd *cobra.Command, args []string) error {
-		client, err := api.NewClient()
+		client, err := newClient()
 		if err != nil {
 			return err
 		}
 
-		result, err := client.ListFiles(prefixFilter)
+		result, err := client.ListFiles(cmd.Context(), prefixFilter)
 		if err != nil {
 			return err
 		}
 
-		if len(result.Files) == 0 {
-			fmt.Println("No files found")
-			return nil
+		r := listReport{Files: result.Files, Count: result.Count}
+		if r.Files == nil {
+			r.Files = []string{}
 		}
 
-		fmt.Printf("Found %d files:\n\n", result.Count)
-		for _, file := range result.Files {
-			fmt.Printf("  - %s\n", file)
-		}
+		return printReport(r, func() {
+			if len(r.Files) == 0 {
+				fmt.Println("No files found")
+				return
+			}
 
-		return nil
+			fmt.Printf("Found %d files:\n\n", r.Count)
+			for _, file := range r.Files {
+				fmt.Printf("  - %s\n", file)
+			}
+		})
 	},
 }
 
+// listReport is the output of sfs list
+type listReport struct {
+	Files []string `json:"files"`
+	Count int      `json:"count"`
+}
+
+func (r listReport) columns() []string {
+	return []string{"file"}
+}
+
+func (r listReport) rows() [][]string {
+	rows := make([][]string, len(r.Files))
+	for i, file := range r.Files {
+		rows[i] = []string{file}
+	}
+	return rows
+}
+
 func init() {
 	rootCmd.AddCommand(listCmd)
 	listCmd.Flags().StringVarP(&prefixFilter, "prefix", "p", "", "Filter files by prefix")
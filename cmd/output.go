@@ -0,0 +1,132 @@
+/*
+Copyright © 2026 T. Vicente <thiagoaureliovicente@gmail.com>
+
+*/
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"slices"
+	"strings"
+	"text/tabwriter"
+
+	"go.yaml.in/yaml/v3"
+)
+
+// Formats accepted by --output
+const (
+	outputText  = "text"
+	outputTable = "table"
+	outputTSV   = "tsv"
+	outputJSON  = "json"
+	outputYAML  = "yaml"
+)
+
+// tableCellWidth caps cells in table output, which is meant for reading
+const tableCellWidth = 60
+
+var outputFormats = []string{outputText, outputTable, outputTSV, outputJSON, outputYAML}
+
+// outputFlag is the format commands print their results in
+var outputFlag string
+
+// report is the result of a command, printable in every --output format.
+// Its JSON field names are the documented schema for json and yaml output.
+type report interface {
+	// columns names the fields of each row in table and tsv output
+	columns() []string
+	// rows returns the report flattened into rows for table and tsv output
+	rows() [][]string
+}
+
+// validateOutput checks the --output flag
+func validateOutput() error {
+	if !slices.Contains(outputFormats, outputFlag) {
+		return fmt.Errorf("invalid output format %q: use %s", outputFlag, strings.Join(outputFormats, ", "))
+	}
+	return nil
+}
+
+// structured reports whether stdout is reserved for a machine-readable report
+func structured() bool {
+	return outputFlag != outputText
+}
+
+// humanOut returns where messages for people go: stdout, unless it is
+// reserved for a machine-readable report
+func humanOut() io.Writer {
+	if structured() {
+		return os.Stderr
+	}
+	return os.Stdout
+}
+
+// printReport writes r to stdout in the --output format. The default text
+// format is printed by text, which may be nil for commands that print as
+// they go.
+func printReport(r report, text func()) error {
+	switch outputFlag {
+	case outputJSON:
+		encoder := json.NewEncoder(os.Stdout)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(r)
+
+	case outputYAML:
+		// Go through JSON so both formats share the same field names
+		data, err := json.Marshal(r)
+		if err != nil {
+			return fmt.Errorf("failed to encode output: %w", err)
+		}
+		var generic interface{}
+		if err := json.Unmarshal(data, &generic); err != nil {
+			return fmt.Errorf("failed to encode output: %w", err)
+		}
+		encoder := yaml.NewEncoder(os.Stdout)
+		encoder.SetIndent(2)
+		if err := encoder.Encode(generic); err != nil {
+			return fmt.Errorf("failed to encode output: %w", err)
+		}
+		return encoder.Close()
+
+	case outputTSV:
+		fmt.Println(strings.Join(r.columns(), "\t"))
+		for _, row := range r.rows() {
+			for i, cell := range row {
+				row[i] = tsvEscape(cell)
+			}
+			fmt.Println(strings.Join(row, "\t"))
+		}
+		return nil
+
+	case outputTable:
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, strings.ToUpper(strings.Join(r.columns(), "\t")))
+		for _, row := range r.rows() {
+			for i, cell := range row {
+				row[i] = tableCell(cell)
+			}
+			fmt.Fprintln(w, strings.Join(row, "\t"))
+		}
+		return w.Flush()
+	}
+
+	if text != nil {
+		text()
+	}
+	return nil
+}
+
+// tsvEscape escapes the characters that would break a TSV row
+var tsvEscape = strings.NewReplacer(`\`, `\\`, "\t", `\t`, "\n", `\n`, "\r", `\r`).Replace
+
+// tableCell collapses whitespace and shortens long values to fit a table
+func tableCell(cell string) string {
+	cell = strings.Join(strings.Fields(cell), " ")
+	if runes := []rune(cell); len(runes) > tableCellWidth {
+		return string(runes[:tableCellWidth-3]) + "..."
+	}
+	return cell
+}
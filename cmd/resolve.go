@@ -0,0 +1,95 @@
+/*
+Copyright © 2026 T. Vicente <thiagoaureliovicente@gmail.com>
+
+*/
+package cmd
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/spf13/cobra"
+	"github.com/ThiagoAVicente/sfs-cli/internal/names"
+)
+
+// resolveCmd represents the resolve command
+var resolveCmd = &cobra.Command{
+	Use:   "resolve <path|name>...",
+	Short: "Show the server-side name of a local path, or the reverse",
+	Long: `Show how local paths map to the names files are stored under on the server.
+
+Uploads store a file under its absolute path with the separators replaced by
+underscores, so /home/user/docs/notes.txt becomes home_user_docs_notes.txt.
+That can't be undone by itself, so local paths are looked up in the sync state
+and in the job history of the active profile.
+
+Arguments with a directory separator or starting with ~ are local paths.
+Anything else is a server-side name if one is known, else a local path if such
+a file exists, else an unknown server-side name. delete and download accept
+arguments the same way.
+
+Examples:
+  sfs resolve ./notes.txt
+  sfs resolve home_user_docs_notes.txt
+  sfs resolve ~/docs/*.md --output json`,
+	Args: cobra.MinimumNArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		known := loadNames()
+
+		r := resolveReport{Mappings: make([]names.Mapping, len(args))}
+		for i, arg := range args {
+			m, err := known.Resolve(arg)
+			if err != nil {
+				return err
+			}
+			r.Mappings[i] = m
+		}
+
+		return printReport(r, func() {
+			for _, m := range r.Mappings {
+				path := m.Path
+				if path == "" {
+					path = "(local path unknown)"
+				}
+				fmt.Printf("%s -> %s (%s)\n", path, m.Name, m.Source)
+			}
+		})
+	},
+}
+
+// resolveReport is the output of sfs resolve
+type resolveReport struct {
+	Mappings []names.Mapping `json:"mappings"`
+}
+
+func (r resolveReport) columns() []string {
+	return []string{"path", "name", "source"}
+}
+
+func (r resolveReport) rows() [][]string {
+	rows := make([][]string, len(r.Mappings))
+	for i, m := range r.Mappings {
+		rows[i] = []string{m.Path, m.Name, m.Source}
+	}
+	return rows
+}
+
+// loadNames returns the mapping between local paths and server-side names,
+// from the sync state and the uploads in the job history of the active
+// profile. Either source is skipped with a warning if it can't be read.
+func loadNames() *names.Map {
+	jobs, err := openHistory().List()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: Could not read job history: %v\n", err)
+	}
+
+	known, err := names.Load(profileJobs(jobs))
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: Could not read the sync state: %v\n", err)
+	}
+	return known
+}
+
+func init() {
+	rootCmd.AddCommand(resolveCmd)
+}
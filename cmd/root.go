@@ -5,13 +5,46 @@ Copyright © 2026 T. Vicente <thiagoaureliovicente@gmail.com>
 package cmd
 
 import (
+	"context"
+	"errors"
 	"fmt"
+	"net/url"
 	"os"
+	"os/signal"
+	"syscall"
 
 	"github.com/spf13/cobra"
+	"github.com/ThiagoAVicente/sfs-cli/internal/api"
 	"github.com/ThiagoAVicente/sfs-cli/internal/config"
 )
 
+// Exit codes, so scripts can tell failures apart
+const (
+	exitFailure      = 1   // any failure not covered below, including usage errors
+	exitUnauthorized = 3   // the API rejected the API key
+	exitNotFound     = 4   // the file or job doesn't exist on the server
+	exitAPIError     = 5   // any other error response from the API
+	exitUnreachable  = 6   // the API couldn't be reached or didn't respond in time
+	exitInterrupted  = 130 // cancelled with Ctrl+C or SIGTERM
+)
+
+var (
+	// profileFlag selects the configuration profile for this invocation
+	profileFlag string
+
+	// configFlag, apiURLFlag and apiKeyFlag override the config file for
+	// this invocation
+	configFlag string
+	apiURLFlag string
+	apiKeyFlag string
+)
+
+// newClient creates the API client of the active profile. Tests replace it
+// to talk to a fake server.
+var newClient = func() (api.Service, error) {
+	return api.NewClient()
+}
+
 // rootCmd represents the base command when called without any subcommands
 var rootCmd = &cobra.Command{
 	Use:   "sfs",
@@ -21,33 +54,102 @@ var rootCmd = &cobra.Command{
 Use it to upload files, search semantically, manage indexed files, and more.
 
 Configuration:
-  Config file: ~/.config/sfs/config.yaml
+  Config file: ~/.config/sfs/config.yaml (or --config, or SFS_CONFIG)
 
   Required settings:
     api_url - Base URL of your SFS API
     api_key - Your API authentication key
 
+  Profiles keep settings for several servers apart; pick one with --profile,
+  SFS_PROFILE or 'sfs config profile use'.
+
+  Every setting can be overridden for a single run with an SFS_<KEY>
+  environment variable, e.g. SFS_API_URL. Flags win over environment
+  variables, which win over the active profile, then the config file and
+  finally the built-in defaults. See 'sfs config list --show-origin'.
+
 Examples:
   sfs config set api_url https://api.example.com
   sfs config set api_key your-secret-key
   sfs upload /path/to/file.txt
-  sfs search "find relevant documents"`,
+  sfs search "find relevant documents"
+  sfs search "find relevant documents" --output json
+  sfs --profile staging list`,
+	PersistentPreRunE: func(cmd *cobra.Command, args []string) error {
+		if err := validateOutput(); err != nil {
+			return err
+		}
+
+		// Arguments and flags are valid by now, so later errors aren't about usage
+		cmd.SilenceUsage = true
+
+		if config.GetTLSInsecure() {
+			fmt.Fprintln(os.Stderr, api.InsecureWarning)
+		}
+		return nil
+	},
 }
 
 // Execute adds all child commands to the root command and sets flags appropriately.
 // This is called by main.main(). It only needs to happen once to the rootCmd.
 func Execute() {
-	err := rootCmd.Execute()
+	// Ctrl+C and SIGTERM cancel the command's context, aborting requests in flight
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	go func() {
+		<-ctx.Done()
+		// Restore the default handlers so a second signal exits immediately
+		stop()
+	}()
+
+	err := rootCmd.ExecuteContext(ctx)
+	interrupted := ctx.Err() != nil
+	stop()
 	if err != nil {
-		os.Exit(1)
+		if interrupted {
+			os.Exit(exitInterrupted)
+		}
+		os.Exit(exitCode(err))
+	}
+}
+
+// exitCode returns the exit code for a command that failed with err
+func exitCode(err error) int {
+	var apiErr *api.APIError
+	var urlErr *url.Error
+	switch {
+	case api.IsUnauthorized(err):
+		return exitUnauthorized
+	case api.IsNotFound(err):
+		return exitNotFound
+	case errors.As(err, &apiErr):
+		return exitAPIError
+	case errors.As(err, &urlErr):
+		return exitUnreachable
 	}
+	return exitFailure
 }
 
 func init() {
 	cobra.OnInitialize(initConfig)
+	rootCmd.PersistentFlags().StringVar(&profileFlag, "profile", "", "Configuration profile to use (default from "+config.ProfileEnv+" or the config file)")
+	rootCmd.PersistentFlags().StringVar(&outputFlag, "output", outputText, "Output format: text, table, tsv, json or yaml")
+	rootCmd.PersistentFlags().StringVar(&configFlag, "config", "", "Config file to use (default from "+config.ConfigEnv+" or ~/.config/sfs/config.yaml)")
+	rootCmd.PersistentFlags().StringVar(&apiURLFlag, "api-url", "", "Base URL of the SFS API, overriding "+config.EnvName("api_url")+" and the config file")
+	rootCmd.PersistentFlags().StringVar(&apiKeyFlag, "api-key", "", "API key, overriding "+config.EnvName("api_key")+" and the config file (visible to other users in the process list)")
 }
 
 func initConfig() {
+	config.SelectProfile(profileFlag)
+	config.SetConfigFile(configFlag)
+
+	flags := rootCmd.PersistentFlags()
+	if flags.Changed("api-url") {
+		config.Override("api_url", apiURLFlag)
+	}
+	if flags.Changed("api-key") {
+		config.Override("api_key", apiKeyFlag)
+	}
+
 	if err := config.InitConfig(); err != nil {
 		fmt.Fprintf(os.Stderr, "Warning: Failed to initialize config: %v\n", err)
 	}
@@ -6,10 +6,10 @@ package cmd
 
 import (
 	"fmt"
+	"strconv"
 	"strings"
 
 	"github.com/spf13/cobra"
-	"github.com/ThiagoAVicente/sfs-cli/internal/api"
 )
 
 var (
@@ -34,32 +34,91 @@ Examples:
 	RunE: func(cmd *cobra.Command, args []string) error {
 		query := strings.Join(args, " ")
 
-		client, err := api.NewClient()
+		client, err := newClient()
 		if err != nil {
 			return err
 		}
 
-		results, err := client.Search(query, searchLimit, scoreThreshold)
+		results, err := client.Search(cmd.Context(), query, searchLimit, scoreThreshold)
 		if err != nil {
 			return err
 		}
 
-		if len(results.Results) == 0 {
-			fmt.Println("No results found")
-			return nil
-		}
-
-		fmt.Printf("Found %d results:\n\n", len(results.Results))
+		names := loadNames()
+		r := searchReport{Query: query, Results: make([]searchMatch, len(results.Results))}
 		for i, result := range results.Results {
-			fmt.Printf("[%d] Score: %.3f | File: %s\n", i+1, result.Score, result.Payload.FilePath)
-			fmt.Printf("    Position: %d-%d | Chunk: %d\n", result.Payload.Start, result.Payload.End, result.Payload.ChunkIndex)
-			fmt.Printf("    Text: %s\n\n", result.Payload.Text)
+			r.Results[i] = searchMatch{
+				Rank:       i + 1,
+				Score:      result.Score,
+				FilePath:   result.Payload.FilePath,
+				LocalPath:  names.Path(result.Payload.FilePath).Path,
+				Start:      result.Payload.Start,
+				End:        result.Payload.End,
+				ChunkIndex: result.Payload.ChunkIndex,
+				Text:       result.Payload.Text,
+			}
 		}
 
-		return nil
+		return printReport(r, func() {
+			if len(r.Results) == 0 {
+				fmt.Println("No results found")
+				return
+			}
+
+			fmt.Printf("Found %d results:\n\n", len(r.Results))
+			for _, match := range r.Results {
+				// Show where the file lives locally when that is known
+				file := match.FilePath
+				if match.LocalPath != "" {
+					file = match.LocalPath
+				}
+				fmt.Printf("[%d] Score: %.3f | File: %s\n", match.Rank, match.Score, file)
+				fmt.Printf("    Position: %d-%d | Chunk: %d\n", match.Start, match.End, match.ChunkIndex)
+				fmt.Printf("    Text: %s\n\n", match.Text)
+			}
+		})
 	},
 }
 
+// searchReport is the output of sfs search
+type searchReport struct {
+	Query   string        `json:"query"`
+	Results []searchMatch `json:"results"`
+}
+
+// searchMatch is a matching chunk, best matches first
+type searchMatch struct {
+	Rank       int     `json:"rank"`
+	Score      float64 `json:"score"`
+	FilePath   string  `json:"file_path"`
+	LocalPath  string  `json:"local_path"`
+	Start      int     `json:"start"`
+	End        int     `json:"end"`
+	ChunkIndex int     `json:"chunk_index"`
+	Text       string  `json:"text"`
+}
+
+func (r searchReport) columns() []string {
+	return []string{"rank", "score", "file_path", "local_path", "start", "end", "chunk_index", "text"}
+}
+
+func (r searchReport) rows() [][]string {
+	rows := make([][]string, len(r.Results))
+	for i, match := range r.Results {
+		rows[i] = []string{
+			strconv.Itoa(match.Rank),
+			strconv.FormatFloat(match.Score, 'f', -1, 64),
+			match.FilePath,
+			match.LocalPath,
+			strconv.Itoa(match.Start),
+			strconv.Itoa(match.End),
+			strconv.Itoa(match.ChunkIndex),
+			match.Text,
+		}
+	}
+	return rows
+}
+
 func init() {
 	rootCmd.AddCommand(searchCmd)
 	searchCmd.Flags().IntVarP(&searchLimit, "limit", "l", 5, "Maximum number of results")
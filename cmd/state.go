@@ -0,0 +1,192 @@
+/*
+Copyright © 2026 T. Vicente <thiagoaureliovicente@gmail.com>
+
+*/
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"time"
+
+	"github.com/spf13/cobra"
+	"github.com/ThiagoAVicente/sfs-cli/internal/state"
+)
+
+// stateCmd represents the state command
+var stateCmd = &cobra.Command{
+	Use:   "state",
+	Short: "Inspect the local sync state",
+	Long: `Inspect the local record of files synced by the daemon.
+
+The sync state is stored in ~/.config/sfs/state.jsonl and records, for every
+synced file, its size, modification time, content hash, server-side name and
+the last indexing job submitted for it.
+
+Available commands:
+  list [directory]  List synced files, optionally only those under a directory
+  show <path>       Show the full sync record of a file`,
+}
+
+// syncStatus describes how a recorded entry compares to the file on disk
+func syncStatus(entry state.Entry) string {
+	if entry.Error != "" {
+		return "error"
+	}
+	if !entry.Synced() {
+		return "failed"
+	}
+
+	info, err := os.Stat(entry.Path)
+	if os.IsNotExist(err) {
+		return "missing"
+	}
+	if err != nil {
+		return "unreadable"
+	}
+	if !entry.Unchanged(info) {
+		return "modified"
+	}
+	return "synced"
+}
+
+var stateListCmd = &cobra.Command{
+	Use:   "list [directory]",
+	Short: "List synced files",
+	Args:  cobra.MaximumNArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		store, err := state.OpenDefault()
+		if err != nil {
+			return err
+		}
+
+		entries := store.List()
+		if len(args) == 1 {
+			absDir, err := filepath.Abs(args[0])
+			if err != nil {
+				return fmt.Errorf("failed to resolve path: %w", err)
+			}
+			entries = store.Under(absDir)
+		}
+
+		r := stateListReport{Files: make([]stateFile, len(entries))}
+		for i, entry := range entries {
+			r.Files[i] = stateFile{
+				Path:       entry.Path,
+				Status:     syncStatus(entry),
+				RemoteName: entry.RemoteName,
+				JobID:      entry.JobID,
+			}
+		}
+
+		return printReport(r, func() {
+			if len(r.Files) == 0 {
+				fmt.Println("No synced files")
+				return
+			}
+
+			fmt.Printf("Found %d synced files:\n\n", len(r.Files))
+			for _, file := range r.Files {
+				fmt.Printf("  [%s] %s\n", file.Status, file.Path)
+			}
+		})
+	},
+}
+
+// stateListReport is the output of sfs state list
+type stateListReport struct {
+	Files []stateFile `json:"files"`
+}
+
+// stateFile is a synced file and how it compares to the file on disk
+type stateFile struct {
+	Path       string `json:"path"`
+	Status     string `json:"status"`
+	RemoteName string `json:"remote_name"`
+	JobID      string `json:"job_id"`
+}
+
+func (r stateListReport) columns() []string {
+	return []string{"path", "status", "remote_name", "job_id"}
+}
+
+func (r stateListReport) rows() [][]string {
+	rows := make([][]string, len(r.Files))
+	for i, file := range r.Files {
+		rows[i] = []string{file.Path, file.Status, file.RemoteName, file.JobID}
+	}
+	return rows
+}
+
+var stateShowCmd = &cobra.Command{
+	Use:   "show <path>",
+	Short: "Show the sync record of a file",
+	Args:  cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		store, err := state.OpenDefault()
+		if err != nil {
+			return err
+		}
+
+		absPath, err := filepath.Abs(args[0])
+		if err != nil {
+			return fmt.Errorf("failed to resolve path: %w", err)
+		}
+
+		entry, ok := store.Get(absPath)
+		if !ok {
+			// Also accept the server-side name
+			if entry, ok = store.FindRemote(args[0]); !ok {
+				return fmt.Errorf("no sync record for: %s", args[0])
+			}
+		}
+
+		r := stateEntryReport{Entry: entry, Status: syncStatus(entry)}
+		return printReport(r, func() {
+			fmt.Printf("Path:        %s\n", entry.Path)
+			fmt.Printf("Server name: %s\n", entry.RemoteName)
+			fmt.Printf("Status:      %s\n", r.Status)
+			fmt.Printf("Size:        %d\n", entry.Size)
+			fmt.Printf("Modified:    %s\n", entry.ModTime.Format(time.RFC3339))
+			fmt.Printf("Hash:        %s\n", entry.Hash)
+			fmt.Printf("Job ID:      %s\n", entry.JobID)
+			fmt.Printf("Job status:  %s\n", entry.JobStatus)
+			if !entry.SyncedAt.IsZero() {
+				fmt.Printf("Synced at:   %s\n", entry.SyncedAt.Format(time.RFC3339))
+			}
+			if entry.Error != "" {
+				fmt.Printf("Error:       %s\n", entry.Error)
+			}
+		})
+	},
+}
+
+// stateEntryReport is the output of sfs state show: the sync record as
+// stored, plus how it compares to the file on disk
+type stateEntryReport struct {
+	state.Entry
+	Status string `json:"status"`
+}
+
+func (r stateEntryReport) columns() []string {
+	return []string{"path", "remote_name", "status", "size", "mod_time", "hash", "job_id", "job_status", "synced_at", "error"}
+}
+
+func (r stateEntryReport) rows() [][]string {
+	var syncedAt string
+	if !r.SyncedAt.IsZero() {
+		syncedAt = r.SyncedAt.Format(time.RFC3339)
+	}
+	return [][]string{{
+		r.Path, r.RemoteName, r.Status, strconv.FormatInt(r.Size, 10),
+		r.ModTime.Format(time.RFC3339), r.Hash, r.JobID, r.JobStatus, syncedAt, r.Error,
+	}}
+}
+
+func init() {
+	rootCmd.AddCommand(stateCmd)
+	stateCmd.AddCommand(stateListCmd)
+	stateCmd.AddCommand(stateShowCmd)
+}
@@ -0,0 +1,343 @@
+/*
+Copyright © 2026 T. Vicente <thiagoaureliovicente@gmail.com>
+
+*/
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+
+	"github.com/spf13/cobra"
+	"github.com/ThiagoAVicente/sfs-cli/internal/config"
+	"github.com/ThiagoAVicente/sfs-cli/internal/daemon"
+	"github.com/ThiagoAVicente/sfs-cli/internal/pool"
+)
+
+var (
+	syncDryRunFlag bool
+	syncDeleteFlag bool
+)
+
+// Results of a change in the sync report
+const (
+	syncPlanned    = "planned"
+	syncDone       = "done"
+	syncKept       = "kept"
+	syncFailed     = "failed"
+	syncNotStarted = "not_started"
+)
+
+// syncCmd represents the sync command
+var syncCmd = &cobra.Command{
+	Use:   "sync [directory]...",
+	Short: "Sync directories with the index once, without the daemon",
+	Long: `Bring the index in line with local directories once, the way the daemon
+does when it starts.
+
+Each directory is compared with the files the index has under it and with the
+local sync state: new files are uploaded, files changed since they were last
+synced are updated and indexed files that no longer exist locally, or are now
+ignored, are deleted. Ignore rules are the same as the daemon's.
+
+Without arguments, every watched directory is synced to the server of its
+profile. Other directories sync to the profile of the watched directory
+holding them, else to the default profile.
+
+Changes are made several at a time (upload_concurrency). Use --dry-run to
+print the plan instead: + for uploads, ~ for updates and - for deletes. With
+--delete=false nothing is deleted from the server. The command fails if any
+change or directory failed.
+
+Examples:
+  sfs sync
+  sfs sync ~/docs --dry-run
+  sfs sync ~/docs ~/notes --delete=false
+  sfs sync --output json`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		dirs, err := syncDirs(args)
+		if err != nil {
+			return err
+		}
+		if len(dirs) == 0 {
+			return fmt.Errorf("no directories to sync: give one or add one with sfs watch add")
+		}
+
+		// The daemon's warnings go through log; print them like any other
+		// command's, without timestamps
+		log.SetFlags(0)
+
+		oneshot, err := daemon.NewOneshot(dirs, openHistory())
+		if err != nil {
+			return err
+		}
+
+		ctx := cmd.Context()
+		poolOpts := pool.Options{
+			Workers: config.GetUploadConcurrency(),
+			Limiter: pool.NewLimiter(config.GetUploadRateLimit()),
+		}
+
+		r := syncReport{DryRun: syncDryRunFlag, Dirs: []syncedDir{}}
+		var counts syncCounts
+		var firstErr, firstDirErr error
+		for _, dir := range dirs {
+			if ctx.Err() != nil {
+				break
+			}
+
+			result := syncedDir{Path: dir.Path, Profile: dir.Profile, Changes: []syncChange{}}
+			plan, err := oneshot.Plan(ctx, dir)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "Failed: %s: %v\n", dir.Path, err)
+				result.Error = err.Error()
+				r.Dirs = append(r.Dirs, result)
+				counts.dirsFailed++
+				if firstDirErr == nil {
+					firstDirErr = err
+				}
+				continue
+			}
+			result.Unchanged = plan.Unchanged
+			counts.unchanged += plan.Unchanged
+
+			// Deletes left out with --delete=false are reported as kept
+			var apply []daemon.Change
+			for _, c := range plan.Changes {
+				if c.Kind == daemon.ChangeDelete && !syncDeleteFlag {
+					result.Changes = append(result.Changes, newSyncChange(c, syncKept, nil))
+					counts.kept++
+					continue
+				}
+				apply = append(apply, c)
+			}
+			plan.Changes = apply
+
+			if syncDryRunFlag {
+				for _, c := range apply {
+					fmt.Fprintf(humanOut(), "%s %s\n", changeSymbol(c.Kind), changeLabel(c))
+					result.Changes = append(result.Changes, newSyncChange(c, syncPlanned, nil))
+					counts.add(c.Kind)
+				}
+				r.Dirs = append(r.Dirs, result)
+				continue
+			}
+
+			errs := oneshot.Apply(ctx, plan, poolOpts, func(c daemon.Change, err error) {
+				if err == nil {
+					fmt.Fprintf(humanOut(), "%s: %s\n", changeVerb(c.Kind), changeLabel(c))
+				}
+			})
+			for i, err := range errs {
+				c := apply[i]
+				switch {
+				case err == nil:
+					result.Changes = append(result.Changes, newSyncChange(c, syncDone, nil))
+					counts.add(c.Kind)
+				case errors.Is(err, pool.ErrNotStarted):
+					result.Changes = append(result.Changes, newSyncChange(c, syncNotStarted, nil))
+					counts.notStarted++
+				default:
+					fmt.Fprintf(os.Stderr, "Failed: %s: %v\n", changeLabel(c), err)
+					result.Changes = append(result.Changes, newSyncChange(c, syncFailed, err))
+					counts.failed++
+					if firstErr == nil {
+						firstErr = err
+					}
+				}
+			}
+			r.Dirs = append(r.Dirs, result)
+		}
+
+		counts.print(syncDryRunFlag)
+		if err := printReport(r, nil); err != nil {
+			return err
+		}
+
+		total := counts.made() + counts.failed + counts.notStarted
+		switch {
+		case counts.failed > 0 && counts.made() == 0 && counts.notStarted == 0:
+			// Nothing got through, so the exit code follows the first failure
+			return fmt.Errorf("%d of %d changes failed: %w", counts.failed, total, firstErr)
+		case counts.failed > 0:
+			return fmt.Errorf("%d of %d changes failed", counts.failed, total)
+		case counts.dirsFailed > 0:
+			return fmt.Errorf("%d of %d directories could not be synced: %w", counts.dirsFailed, len(dirs), firstDirErr)
+		case counts.notStarted > 0 || ctx.Err() != nil:
+			return fmt.Errorf("sync interrupted, %d changes not made", counts.notStarted)
+		}
+		return nil
+	},
+}
+
+// syncCounts tallies the changes of a sync
+type syncCounts struct {
+	uploads, updates, deletes int
+	unchanged, kept           int
+	failed, notStarted        int
+	dirsFailed                int
+}
+
+// add counts a change that was made, or would be with --dry-run
+func (c *syncCounts) add(kind daemon.ChangeKind) {
+	switch kind {
+	case daemon.ChangeUpload:
+		c.uploads++
+	case daemon.ChangeUpdate:
+		c.updates++
+	case daemon.ChangeDelete:
+		c.deletes++
+	}
+}
+
+// made returns how many changes were made
+func (c *syncCounts) made() int {
+	return c.uploads + c.updates + c.deletes
+}
+
+// print writes the summary line
+func (c *syncCounts) print(dryRun bool) {
+	var line string
+	if dryRun {
+		line = fmt.Sprintf("To upload: %d, to update: %d, to delete: %d, unchanged: %d",
+			c.uploads, c.updates, c.deletes, c.unchanged)
+	} else {
+		line = fmt.Sprintf("Uploaded: %d, updated: %d, deleted: %d, unchanged: %d, failed: %d",
+			c.uploads, c.updates, c.deletes, c.unchanged, c.failed)
+	}
+	if c.kept > 0 {
+		line += fmt.Sprintf(", kept on the server: %d", c.kept)
+	}
+	if c.notStarted > 0 {
+		line += fmt.Sprintf(", not started: %d", c.notStarted)
+	}
+	if c.dirsFailed > 0 {
+		line += fmt.Sprintf(", directories failed: %d", c.dirsFailed)
+	}
+	fmt.Fprintf(humanOut(), "\n%s\n", line)
+}
+
+// syncDirs returns the directories to sync: those given, or every watched
+// directory if none are
+func syncDirs(args []string) ([]config.WatchDir, error) {
+	watched := config.GetAllWatchDirs()
+	if len(args) == 0 {
+		dirs := make([]config.WatchDir, 0, len(watched))
+		for _, dir := range watched {
+			absDir, err := filepath.Abs(dir.Path)
+			if err != nil {
+				return nil, fmt.Errorf("failed to resolve path: %w", err)
+			}
+			dirs = append(dirs, config.WatchDir{Path: absDir, Profile: dir.Profile})
+		}
+		return dirs, nil
+	}
+
+	dirs := make([]config.WatchDir, 0, len(args))
+	for _, arg := range args {
+		absDir, err := filepath.Abs(arg)
+		if err != nil {
+			return nil, fmt.Errorf("failed to resolve path: %w", err)
+		}
+		if info, err := os.Stat(absDir); err != nil {
+			return nil, fmt.Errorf("directory does not exist: %s", absDir)
+		} else if !info.IsDir() {
+			return nil, fmt.Errorf("path is not a directory: %s", absDir)
+		}
+		dirs = append(dirs, config.WatchDir{Path: absDir, Profile: config.ProfileFor(watched, absDir)})
+	}
+	return dirs, nil
+}
+
+// changeSymbol returns the diff-style marker of a change in a --dry-run plan
+func changeSymbol(kind daemon.ChangeKind) string {
+	switch kind {
+	case daemon.ChangeUpload:
+		return "+"
+	case daemon.ChangeUpdate:
+		return "~"
+	}
+	return "-"
+}
+
+// changeVerb describes a change that was made
+func changeVerb(kind daemon.ChangeKind) string {
+	switch kind {
+	case daemon.ChangeUpload:
+		return "Uploaded"
+	case daemon.ChangeUpdate:
+		return "Updated"
+	}
+	return "Deleted"
+}
+
+// changeLabel names the file of a change: its local path if known, else its
+// server-side name
+func changeLabel(c daemon.Change) string {
+	if c.Path == "" {
+		return c.Name
+	}
+	return c.Path
+}
+
+// syncReport is the output of sfs sync
+type syncReport struct {
+	DryRun bool        `json:"dry_run"`
+	Dirs   []syncedDir `json:"dirs"`
+}
+
+// syncedDir is a directory that was compared with the index
+type syncedDir struct {
+	Path      string       `json:"path"`
+	Profile   string       `json:"profile"`
+	Unchanged int          `json:"unchanged"`
+	Changes   []syncChange `json:"changes"`
+	// Error is set when the directory couldn't be compared with the index
+	Error string `json:"error,omitempty"`
+}
+
+// syncChange is a change to the index and what became of it
+type syncChange struct {
+	Kind   string `json:"kind"`
+	Path   string `json:"path"`
+	Name   string `json:"name"`
+	Result string `json:"result"`
+	Error  string `json:"error,omitempty"`
+}
+
+// newSyncChange reports change c with the given result
+func newSyncChange(c daemon.Change, result string, err error) syncChange {
+	change := syncChange{Kind: string(c.Kind), Path: c.Path, Name: c.Name, Result: result}
+	if err != nil {
+		change.Error = err.Error()
+	}
+	return change
+}
+
+func (r syncReport) columns() []string {
+	return []string{"result", "kind", "path", "name", "detail"}
+}
+
+// rows lists every change, and directories that couldn't be compared with
+// the index as failed scans
+func (r syncReport) rows() [][]string {
+	var rows [][]string
+	for _, dir := range r.Dirs {
+		if dir.Error != "" {
+			rows = append(rows, []string{syncFailed, "scan", dir.Path, "", dir.Error})
+		}
+		for _, c := range dir.Changes {
+			rows = append(rows, []string{c.Result, c.Kind, c.Path, c.Name, c.Error})
+		}
+	}
+	return rows
+}
+
+func init() {
+	rootCmd.AddCommand(syncCmd)
+	syncCmd.Flags().BoolVar(&syncDryRunFlag, "dry-run", false, "Print what would change without changing anything")
+	syncCmd.Flags().BoolVar(&syncDeleteFlag, "delete", true, "Delete indexed files that no longer exist locally")
+}
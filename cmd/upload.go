@@ -5,38 +5,262 @@ Copyright © 2026 T. Vicente<thiagoaureliovicente@gmail.com>
 package cmd
 
 import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+
 	"github.com/spf13/cobra"
 	"github.com/ThiagoAVicente/sfs-cli/internal/api"
+	"github.com/ThiagoAVicente/sfs-cli/internal/collect"
+	"github.com/ThiagoAVicente/sfs-cli/internal/config"
+	"github.com/ThiagoAVicente/sfs-cli/internal/history"
+	"github.com/ThiagoAVicente/sfs-cli/internal/pool"
+	"github.com/ThiagoAVicente/sfs-cli/internal/progress"
 )
 
-var updateFlag bool
+var (
+	updateFlag      bool
+	includeExts     []string
+	excludeExts     []string
+	maxSizeFlag     string
+	concurrencyFlag int
+	rateLimitFlag   float64
+	uploadWaitFlag  bool
+)
 
 // uploadCmd represents the upload command
 var uploadCmd = &cobra.Command{
-	Use:   "upload <file>",
-	Short: "Upload a file to the SFS API for indexing",
-	Long: `Upload a file to the SFS API for semantic indexing.
+	Use:   "upload <path>...",
+	Short: "Upload files to the SFS API for indexing",
+	Long: `Upload files to the SFS API for semantic indexing.
+
+Accepts any number of files, directories and glob patterns. Directories are
+uploaded recursively, skipping anything matched by .sfsignore files or the
+global ignore patterns. Quote glob patterns to let sfs expand them.
 
-The file will be processed and indexed, making it searchable via semantic queries.
+Files are uploaded in parallel (upload_concurrency in the config, 4 by
+default), optionally capped at a number of requests per second
+(upload_rate_limit). Pressing Ctrl+C stops starting new uploads and waits for
+the running ones to finish; press it again to quit immediately.
+
+The files will be processed and indexed, making them searchable via semantic queries.
+A summary is printed at the end, and the command fails if any upload failed.
+With --wait, the command also waits for the indexing jobs to finish and fails
+if any of them did.
 
 Examples:
   sfs upload document.pdf
-  sfs upload --update existing_file.txt    # Update existing file`,
-	Args: cobra.ExactArgs(1),
+  sfs upload --update existing_file.txt    # Update existing file
+  sfs upload ~/documents "notes/*.md"
+  sfs upload ~/projects --include go,md --max-size 1MB
+  sfs upload ~/documents --exclude .log,.tmp
+  sfs upload ~/archive --concurrency 8 --rate-limit 20
+  sfs upload --wait report.pdf                # Block until searchable`,
+	Args: cobra.MinimumNArgs(1),
 	RunE: func(cmd *cobra.Command, args []string) error {
-		filePath := args[0]
+		opts := collect.Options{
+			Include: includeExts,
+			Exclude: excludeExts,
+			Ignore:  config.GetIgnorePatterns(),
+		}
+		if maxSizeFlag != "" {
+			maxSize, err := collect.ParseSize(maxSizeFlag)
+			if err != nil {
+				return err
+			}
+			opts.MaxSize = maxSize
+		}
 
-		client, err := api.NewClient()
+		found, err := collect.Collect(args, opts)
 		if err != nil {
 			return err
 		}
 
-		_, err = client.UploadFile(filePath, updateFlag)
-		return err
+		client, err := newClient()
+		if err != nil {
+			return err
+		}
+
+		r := uploadReport{
+			Uploaded: []uploadedFile{},
+			Skipped:  make([]skippedFile, len(found.Skipped)),
+			Failed:   []failedFile{},
+		}
+		for i, skipped := range found.Skipped {
+			fmt.Fprintf(humanOut(), "Skipped: %s (%s)\n", skipped.Path, skipped.Reason)
+			r.Skipped[i] = skippedFile{Path: skipped.Path, Reason: skipped.Reason}
+		}
+
+		poolOpts := pool.Options{
+			Workers: config.GetUploadConcurrency(),
+			Limiter: pool.NewLimiter(config.GetUploadRateLimit()),
+		}
+		if cmd.Flags().Changed("concurrency") {
+			poolOpts.Workers = concurrencyFlag
+		}
+		if cmd.Flags().Changed("rate-limit") {
+			poolOpts.Limiter = pool.NewLimiter(rateLimitFlag)
+		}
+
+		jobLog := openHistory()
+		bar := progress.NewTerminal(len(found.Files), found.TotalSize())
+
+		// Ctrl+C cancels ctx, which stops new uploads from starting; those
+		// already running use a context that isn't cancelled so they finish
+		ctx := cmd.Context()
+		uploadCtx := context.WithoutCancel(ctx)
+
+		finished := make(chan struct{})
+		defer close(finished)
+		go func() {
+			select {
+			case <-ctx.Done():
+				bar.Printf(os.Stderr, "\nInterrupted, waiting for running uploads to finish (press Ctrl+C again to quit)\n")
+			case <-finished:
+			}
+		}()
+
+		results := make([]*api.UploadResponse, len(found.Files))
+		indexes := make([]int, len(found.Files))
+		for i := range indexes {
+			indexes[i] = i
+		}
+		errs := pool.Run(ctx, poolOpts, indexes, func(i int) error {
+			file := found.Files[i]
+			result, err := client.UploadFile(uploadCtx, file.Path, updateFlag)
+			if err == nil {
+				bar.Printf(humanOut(), "File uploaded: %s\nJob ID: %s\n", file.Path, result.JobID)
+				recordJob(jobLog, history.Job{
+					ID:   result.JobID,
+					Op:   history.OpUpload,
+					Path: result.Path,
+					Name: result.Name,
+				})
+				results[i] = result
+			}
+			bar.Add(file.Size)
+			return err
+		})
+		bar.Finish()
+
+		var jobs []job
+		var firstErr error
+		for i, err := range errs {
+			path := found.Files[i].Path
+			switch {
+			case err == nil:
+				result := results[i]
+				r.Uploaded = append(r.Uploaded, uploadedFile{Path: path, Name: result.Name, JobID: result.JobID})
+				jobs = append(jobs, job{ID: result.JobID, Label: path})
+			case errors.Is(err, pool.ErrNotStarted):
+				r.NotStarted++
+			default:
+				// The report lists failures itself, so only list them for people
+				if !structured() {
+					if len(r.Failed) == 0 {
+						fmt.Fprintln(os.Stderr, "\nFailed uploads:")
+					}
+					fmt.Fprintf(os.Stderr, "  %s: %v\n", path, err)
+				}
+				r.Failed = append(r.Failed, failedFile{Path: path, Error: err.Error()})
+				if firstErr == nil {
+					firstErr = err
+				}
+			}
+		}
+		uploaded, failed, cancelled := len(r.Uploaded), len(r.Failed), r.NotStarted
+
+		fmt.Fprintf(humanOut(), "\nUploaded: %d, skipped: %d, failed: %d", uploaded, len(found.Skipped), failed)
+		if cancelled > 0 {
+			fmt.Fprintf(humanOut(), ", not started: %d", cancelled)
+		}
+		fmt.Fprintln(humanOut())
+
+		var waitErr error
+		if uploadWaitFlag && ctx.Err() == nil {
+			var outcomes []jobOutcome
+			outcomes, waitErr = waitForJobs(ctx, client, jobs)
+			for i, outcome := range outcomes {
+				r.Uploaded[i].Status = outcome.Status
+			}
+			if waitErr != nil && failed > 0 {
+				fmt.Fprintf(os.Stderr, "Error: %v\n", waitErr)
+			}
+		}
+
+		if err := printReport(r, nil); err != nil {
+			return err
+		}
+
+		switch {
+		case failed > 0 && uploaded == 0 && cancelled == 0:
+			// Nothing got through, so the exit code follows the first failure
+			return fmt.Errorf("%d of %d files failed to upload: %w", failed, len(found.Files), firstErr)
+		case failed > 0:
+			return fmt.Errorf("%d of %d files failed to upload", failed, len(found.Files))
+		case cancelled > 0:
+			return fmt.Errorf("upload interrupted, %d files not uploaded", cancelled)
+		}
+		return waitErr
 	},
 }
 
+// uploadReport is the output of sfs upload
+type uploadReport struct {
+	Uploaded   []uploadedFile `json:"uploaded"`
+	Skipped    []skippedFile  `json:"skipped"`
+	Failed     []failedFile   `json:"failed"`
+	NotStarted int            `json:"not_started"`
+}
+
+// uploadedFile is a file the server accepted
+type uploadedFile struct {
+	Path   string `json:"path"`
+	Name   string `json:"name"`
+	JobID  string `json:"job_id"`
+	Status string `json:"status,omitempty"`
+}
+
+// skippedFile is a file left out by the filters
+type skippedFile struct {
+	Path   string `json:"path"`
+	Reason string `json:"reason"`
+}
+
+// failedFile is a file that couldn't be uploaded
+type failedFile struct {
+	Path  string `json:"path"`
+	Error string `json:"error"`
+}
+
+func (r uploadReport) columns() []string {
+	return []string{"result", "path", "detail"}
+}
+
+// rows lists every file with the job ID, skip reason or error as its detail
+func (r uploadReport) rows() [][]string {
+	var rows [][]string
+	for _, file := range r.Uploaded {
+		rows = append(rows, []string{"uploaded", file.Path, file.JobID})
+	}
+	for _, file := range r.Skipped {
+		rows = append(rows, []string{"skipped", file.Path, file.Reason})
+	}
+	for _, file := range r.Failed {
+		rows = append(rows, []string{"failed", file.Path, file.Error})
+	}
+	return rows
+}
+
 func init() {
 	rootCmd.AddCommand(uploadCmd)
 	uploadCmd.Flags().BoolVarP(&updateFlag, "update", "u", false, "Update existing file")
+	uploadCmd.Flags().StringSliceVarP(&includeExts, "include", "i", nil, "Only upload files with these extensions (e.g. pdf,md)")
+	uploadCmd.Flags().StringSliceVarP(&excludeExts, "exclude", "e", nil, "Skip files with these extensions")
+	uploadCmd.Flags().StringVar(&maxSizeFlag, "max-size", "", "Skip files larger than this size (e.g. 500K, 10MB)")
+	uploadCmd.Flags().IntVarP(&concurrencyFlag, "concurrency", "j", 0, "Number of parallel uploads (default from upload_concurrency)")
+	uploadCmd.Flags().BoolVarP(&uploadWaitFlag, "wait", "w", false, "Wait until the files are indexed")
+	addWaitFlags(uploadCmd, "wait-timeout")
+	uploadCmd.Flags().Float64Var(&rateLimitFlag, "rate-limit", 0, "Maximum uploads started per second, 0 for no limit (default from upload_rate_limit)")
 }
@@ -11,7 +11,6 @@ import (
 	"slices"
 
 	"github.com/spf13/cobra"
-	"github.com/spf13/viper"
 	"github.com/ThiagoAVicente/sfs-cli/internal/config"
 )
 
@@ -22,7 +21,11 @@ var watchCmd = &cobra.Command{
 	Long: `Manage the list of directories that the daemon watches for automatic file syncing.
 
 When you add directories to watch, the daemon will automatically upload any changes
-to the SFS API.`,
+to the SFS API.
+
+Each directory belongs to the active profile when it is added, and the daemon
+syncs it to that profile's server:
+  sfs --profile team watch add ~/team-docs`,
 }
 
 var watchAddCmd = &cobra.Command{
@@ -60,14 +63,13 @@ var watchAddCmd = &cobra.Command{
 
 		// Add to list
 		watchDirs = append(watchDirs, absDir)
-		viper.Set("watch_dirs", watchDirs)
 
 		// Save config
-		if err := config.Save(); err != nil {
+		if err := config.SetWatchDirs(watchDirs); err != nil {
 			return fmt.Errorf("failed to save config: %w", err)
 		}
 
-		fmt.Printf("Added to watch list: %s\n", absDir)
+		fmt.Printf("Added to watch list: %s%s\n", absDir, profileSuffix(config.ActiveProfile()))
 		return nil
 	},
 }
@@ -109,10 +111,7 @@ var watchRemoveCmd = &cobra.Command{
 		}
 
 		// Update config
-		viper.Set("watch_dirs", newWatchDirs)
-
-		// Save config
-		if err := config.Save(); err != nil {
+		if err := config.SetWatchDirs(newWatchDirs); err != nil {
 			return fmt.Errorf("failed to save config: %w", err)
 		}
 
@@ -130,23 +129,60 @@ var watchListCmd = &cobra.Command{
 			return fmt.Errorf("failed to load config: %w", err)
 		}
 
-		// Get watch dirs
-		watchDirs := config.GetWatchDirs()
+		// Get watch dirs of every profile
+		watchDirs := config.GetAllWatchDirs()
 
-		if len(watchDirs) == 0 {
-			fmt.Println("No directories being watched")
-			fmt.Println("Add directories with: sfs watch add <directory>")
-			return nil
-		}
-
-		fmt.Println("Watched directories:")
+		r := watchListReport{Dirs: []watchedDir{}}
 		for _, dir := range watchDirs {
-			fmt.Printf("  %s\n", dir)
+			r.Dirs = append(r.Dirs, watchedDir{Path: dir.Path, Profile: dir.Profile})
 		}
-		return nil
+
+		return printReport(r, func() {
+			if len(r.Dirs) == 0 {
+				fmt.Println("No directories being watched")
+				fmt.Println("Add directories with: sfs watch add <directory>")
+				return
+			}
+
+			fmt.Println("Watched directories:")
+			for _, dir := range r.Dirs {
+				fmt.Printf("  %s%s\n", dir.Path, profileSuffix(dir.Profile))
+			}
+		})
 	},
 }
 
+// watchListReport is the output of sfs watch list
+type watchListReport struct {
+	Dirs []watchedDir `json:"dirs"`
+}
+
+// watchedDir is a watched directory and the profile it syncs to
+type watchedDir struct {
+	Path    string `json:"path"`
+	Profile string `json:"profile"`
+}
+
+func (r watchListReport) columns() []string {
+	return []string{"path", "profile"}
+}
+
+func (r watchListReport) rows() [][]string {
+	rows := make([][]string, len(r.Dirs))
+	for i, dir := range r.Dirs {
+		rows[i] = []string{dir.Path, dir.Profile}
+	}
+	return rows
+}
+
+// profileSuffix names a profile after a directory, unless it is the default
+func profileSuffix(profile string) string {
+	if profile == config.DefaultProfile {
+		return ""
+	}
+	return " (profile: " + profile + ")"
+}
+
 func init() {
 	rootCmd.AddCommand(watchCmd)
 	watchCmd.AddCommand(watchAddCmd)
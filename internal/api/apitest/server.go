@@ -0,0 +1,372 @@
+// Package apitest provides an in-memory fake of the SFS API for tests.
+//
+// The fake serves the same endpoints as the real API over httptest, so
+// clients exercise their actual request and response handling. Files are
+// kept in memory, indexing jobs finish immediately unless told otherwise and
+// search scores chunks by the share of query words they contain.
+package apitest
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// APIKey is the key the fake server accepts unless Server.APIKey is changed
+const APIKey = "test-key"
+
+// Job statuses reported by the fake server
+const (
+	StatusProcessing = "processing"
+	StatusComplete   = "complete"
+	StatusFailed     = "failed"
+)
+
+// Server is a fake SFS API backed by memory. It is safe for concurrent use.
+type Server struct {
+	*httptest.Server
+
+	mu       sync.Mutex
+	apiKey   string
+	files    map[string][]byte
+	modTimes map[string]time.Time
+	jobs     map[string]string
+	nextJob  int
+	status   string
+	failures []int
+	requests int
+}
+
+// searchRequest is the body of a search request
+type searchRequest struct {
+	Query          string  `json:"query"`
+	Limit          int     `json:"limit"`
+	ScoreThreshold float64 `json:"score_threshold"`
+}
+
+// searchResult is a single scored chunk in a search response
+type searchResult struct {
+	Score   float64       `json:"score"`
+	Payload searchPayload `json:"payload"`
+}
+
+// searchPayload describes where a matching chunk came from
+type searchPayload struct {
+	FilePath   string `json:"file_path"`
+	Text       string `json:"text"`
+	Start      int    `json:"start"`
+	End        int    `json:"end"`
+	ChunkIndex int    `json:"chunk_index"`
+}
+
+// NewServer starts a fake server that accepts APIKey. Callers should call
+// Close when done.
+func NewServer() *Server {
+	s := &Server{
+		apiKey:   APIKey,
+		files:    make(map[string][]byte),
+		modTimes: make(map[string]time.Time),
+		jobs:     make(map[string]string),
+		status:   StatusComplete,
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /index", s.handleUpload)
+	mux.HandleFunc("DELETE /index/{name}", s.handleDelete)
+	mux.HandleFunc("GET /index/status/{id}", s.handleStatus)
+	mux.HandleFunc("POST /search", s.handleSearch)
+	mux.HandleFunc("GET /files/", s.handleList)
+	mux.HandleFunc("GET /files/{name}", s.handleDownload)
+
+	s.Server = httptest.NewServer(s.middleware(mux))
+	return s
+}
+
+// SetAPIKey changes the API key the server accepts
+func (s *Server) SetAPIKey(key string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.apiKey = key
+}
+
+// SetJobStatus sets the status that jobs submitted from now on report
+func (s *Server) SetJobStatus(status string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.status = status
+}
+
+// FinishJob changes the status of an existing job
+func (s *Server) FinishJob(id, status string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.jobs[id]; ok {
+		s.jobs[id] = status
+	}
+}
+
+// FailNext makes the next n requests fail with the given HTTP status
+func (s *Server) FailNext(n, status int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for range n {
+		s.failures = append(s.failures, status)
+	}
+}
+
+// Requests returns how many requests the server has received
+func (s *Server) Requests() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.requests
+}
+
+// PutFile stores a file as if it had been uploaded
+func (s *Server) PutFile(name string, data []byte) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.store(name, slices.Clone(data))
+}
+
+// File returns the contents of a stored file
+func (s *Server) File(name string) ([]byte, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	data, ok := s.files[name]
+	return slices.Clone(data), ok
+}
+
+// Files returns the names of all stored files, sorted
+func (s *Server) Files() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.names("")
+}
+
+// middleware counts requests, injects queued failures and checks the API key
+func (s *Server) middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		s.mu.Lock()
+		s.requests++
+		failure := 0
+		if len(s.failures) > 0 {
+			failure, s.failures = s.failures[0], s.failures[1:]
+		}
+		apiKey := s.apiKey
+		s.mu.Unlock()
+
+		switch {
+		case failure != 0:
+			writeError(w, failure, "injected failure")
+		case r.Header.Get("X-API-Key") != apiKey:
+			writeError(w, http.StatusUnauthorized, "Invalid API key")
+		default:
+			next.ServeHTTP(w, r)
+		}
+	})
+}
+
+// handleUpload stores an uploaded file and submits an indexing job
+func (s *Server) handleUpload(w http.ResponseWriter, r *http.Request) {
+	file, header, err := r.FormFile("file")
+	if err != nil {
+		writeError(w, http.StatusUnprocessableEntity, "Missing file")
+		return
+	}
+	defer file.Close()
+
+	data, err := io.ReadAll(file)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "Unreadable file")
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, exists := s.files[header.Filename]; exists && r.FormValue("update") != "true" {
+		writeError(w, http.StatusConflict, "File already exists")
+		return
+	}
+	s.store(header.Filename, data)
+	writeJSON(w, map[string]string{"job_id": s.submitJob()})
+}
+
+// handleDelete removes a file and submits a job for its removal
+func (s *Server) handleDelete(w http.ResponseWriter, r *http.Request) {
+	name := r.PathValue("name")
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, exists := s.files[name]; !exists {
+		writeError(w, http.StatusNotFound, "File not found")
+		return
+	}
+	delete(s.files, name)
+	delete(s.modTimes, name)
+	writeJSON(w, map[string]string{"job_id": s.submitJob()})
+}
+
+// handleStatus reports the status of a job
+func (s *Server) handleStatus(w http.ResponseWriter, r *http.Request) {
+	id := r.PathValue("id")
+
+	s.mu.Lock()
+	status, ok := s.jobs[id]
+	s.mu.Unlock()
+
+	if !ok {
+		writeError(w, http.StatusNotFound, "Job not found")
+		return
+	}
+	writeJSON(w, map[string]string{"job_id": id, "status": status})
+}
+
+// handleSearch scores every chunk of every file against the query
+func (s *Server) handleSearch(w http.ResponseWriter, r *http.Request) {
+	var req searchRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusUnprocessableEntity, "Invalid request body")
+		return
+	}
+	words := strings.Fields(strings.ToLower(req.Query))
+	if len(words) == 0 || req.Limit <= 0 {
+		writeError(w, http.StatusUnprocessableEntity, "Query must not be empty and limit must be positive")
+		return
+	}
+
+	s.mu.Lock()
+	results := []searchResult{}
+	for _, name := range s.names("") {
+		for _, chunk := range chunks(name, string(s.files[name])) {
+			if score := scoreChunk(chunk.Text, words); score > 0 && score >= req.ScoreThreshold {
+				results = append(results, searchResult{Score: score, Payload: chunk})
+			}
+		}
+	}
+	s.mu.Unlock()
+
+	sort.SliceStable(results, func(i, j int) bool {
+		return results[i].Score > results[j].Score
+	})
+	if len(results) > req.Limit {
+		results = results[:req.Limit]
+	}
+	writeJSON(w, map[string]any{"results": results})
+}
+
+// handleList lists stored files, optionally filtered by prefix
+func (s *Server) handleList(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	names := s.names(r.URL.Query().Get("prefix"))
+	s.mu.Unlock()
+
+	writeJSON(w, map[string]any{"files": names, "count": len(names)})
+}
+
+// handleDownload returns the contents of a stored file, honoring Range and
+// If-Range headers like the real API
+func (s *Server) handleDownload(w http.ResponseWriter, r *http.Request) {
+	name := r.PathValue("name")
+
+	s.mu.Lock()
+	data, ok := s.files[name]
+	modTime := s.modTimes[name]
+	s.mu.Unlock()
+
+	if !ok {
+		writeError(w, http.StatusNotFound, "File not found")
+		return
+	}
+	w.Header().Set("Content-Type", "application/octet-stream")
+	http.ServeContent(w, r, name, modTime, bytes.NewReader(data))
+}
+
+// store saves a file, stamping it with the current time. Callers must hold mu.
+func (s *Server) store(name string, data []byte) {
+	s.files[name] = data
+	s.modTimes[name] = time.Now().Truncate(time.Second)
+}
+
+// submitJob creates a job with the configured status. Callers must hold mu.
+func (s *Server) submitJob() string {
+	s.nextJob++
+	id := fmt.Sprintf("job-%d", s.nextJob)
+	s.jobs[id] = s.status
+	return id
+}
+
+// names returns the sorted names of stored files starting with prefix.
+// Callers must hold mu.
+func (s *Server) names(prefix string) []string {
+	names := []string{}
+	for name := range s.files {
+		if strings.HasPrefix(name, prefix) {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+// chunks splits a file's text into paragraphs
+func chunks(name, text string) []searchPayload {
+	var result []searchPayload
+	start := 0
+	for start < len(text) {
+		end := strings.Index(text[start:], "\n\n")
+		if end < 0 {
+			end = len(text)
+		} else {
+			end += start
+		}
+
+		raw := text[start:end]
+		if chunk := strings.TrimSpace(raw); chunk != "" {
+			offset := start + strings.Index(raw, chunk)
+			result = append(result, searchPayload{
+				FilePath:   name,
+				Text:       chunk,
+				Start:      offset,
+				End:        offset + len(chunk),
+				ChunkIndex: len(result),
+			})
+		}
+		start = end + 2
+	}
+	return result
+}
+
+// scoreChunk returns the share of query words that appear in text
+func scoreChunk(text string, words []string) float64 {
+	text = strings.ToLower(text)
+	matched := 0
+	for _, word := range words {
+		if strings.Contains(text, word) {
+			matched++
+		}
+	}
+	return float64(matched) / float64(len(words))
+}
+
+// writeJSON writes v as a JSON response
+func writeJSON(w http.ResponseWriter, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(v)
+}
+
+// writeError writes an error response in FastAPI's {"detail": ...} shape
+func writeError(w http.ResponseWriter, status int, detail string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(map[string]string{"detail": detail})
+}
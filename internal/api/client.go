@@ -1,12 +1,18 @@
 package api
 
 import (
-	"crypto/tls"
+	"context"
+	"errors"
 	"fmt"
 	"io"
+	"net"
+	"net/http"
 	"net/url"
 	"os"
 	"path/filepath"
+	"slices"
+	"strings"
+	"time"
 
 	"github.com/go-resty/resty/v2"
 	"github.com/ThiagoAVicente/sfs-cli/internal/config"
@@ -16,6 +22,7 @@ import (
 type Client struct {
 	client *resty.Client
 	config *config.Config
+	retry  retryPolicy
 }
 
 // SearchResult represents a search result from the API
@@ -38,6 +45,10 @@ type SearchResponse struct {
 // UploadResponse represents the upload API response
 type UploadResponse struct {
 	JobID string `json:"job_id"`
+	// Path is the absolute path of the uploaded file and Name the name it
+	// was stored under; they are filled in by the client, not the server
+	Path string `json:"-"`
+	Name string `json:"-"`
 }
 
 // JobStatusResponse represents the job status API response
@@ -46,6 +57,36 @@ type JobStatusResponse struct {
 	Status string `json:"status"`
 }
 
+// Job statuses that mean the job is over
+var (
+	jobSucceededStatuses = []string{"complete", "completed", "finished", "success", "succeeded"}
+	jobFailedStatuses    = []string{"failed", "error", "not_found"}
+)
+
+// ErrJobTimeout is returned by WaitForJob when the job doesn't finish in time
+var ErrJobTimeout = errors.New("timed out waiting for job")
+
+// IsTerminal reports whether the job has finished, successfully or not
+func (r *JobStatusResponse) IsTerminal() bool {
+	return IsTerminalStatus(r.Status)
+}
+
+// Failed reports whether the job finished without indexing its file
+func (r *JobStatusResponse) Failed() bool {
+	return IsFailedStatus(r.Status)
+}
+
+// IsTerminalStatus reports whether a job with the given status has finished
+func IsTerminalStatus(status string) bool {
+	status = strings.ToLower(status)
+	return slices.Contains(jobSucceededStatuses, status) || slices.Contains(jobFailedStatuses, status)
+}
+
+// IsFailedStatus reports whether a job with the given status has failed
+func IsFailedStatus(status string) bool {
+	return slices.Contains(jobFailedStatuses, strings.ToLower(status))
+}
+
 // ListFilesResponse represents the list files API response
 type ListFilesResponse struct {
 	Files []string `json:"files"`
@@ -57,38 +98,89 @@ type DeleteResponse struct {
 	JobID string `json:"job_id"`
 }
 
-// NewClient creates a new API client
+// NewClient creates a new API client for the active profile
 func NewClient() (*Client, error) {
-	cfg, err := config.Get()
+	return NewProfileClient(config.ActiveProfile())
+}
+
+// NewProfileClient creates a new API client for the named profile
+func NewProfileClient(profile string) (*Client, error) {
+	cfg, err := config.GetProfile(profile)
 	if err != nil {
 		return nil, fmt.Errorf("failed to get config: %w", err)
 	}
 
-	if cfg.APIKey == "" {
-		return nil, fmt.Errorf("API key not configured. Run: sfs config set api_key <your-key>")
+	apiKey, err := resolveAPIKey(cfg)
+	if err != nil {
+		return nil, err
+	}
+	if apiKey == "" {
+		if profile != config.DefaultProfile {
+			return nil, fmt.Errorf("API key not configured for profile %s. Run: sfs --profile %s config set api_key", profile, profile)
+		}
+		return nil, fmt.Errorf("API key not configured. Run: sfs config set api_key, or set %s", config.EnvName("api_key"))
+	}
+
+	tlsConfig, err := newTLSConfig(cfg)
+	if err != nil {
+		return nil, err
 	}
 
-	// Only skip cert validation for localhost
-	isLocalhost := false
-	if parsedURL, err := url.Parse(cfg.APIURL); err == nil {
-		hostname := parsedURL.Hostname()
-		isLocalhost = hostname == "localhost" || hostname == "127.0.0.1"
+	// Bound connecting and waiting for a response, but not transfers, so
+	// large uploads and downloads aren't cut off. Other requests are bounded
+	// as a whole by bounded; callers cancel through ctx.
+	dialer := &net.Dialer{Timeout: cfg.ConnectTimeout, KeepAlive: 30 * time.Second}
+	transport := &http.Transport{
+		Proxy:                 http.ProxyFromEnvironment,
+		DialContext:           dialer.DialContext,
+		TLSHandshakeTimeout:   cfg.ConnectTimeout,
+		ResponseHeaderTimeout: cfg.RequestTimeout,
+		IdleConnTimeout:       90 * time.Second,
+		MaxIdleConnsPerHost:   16,
+		TLSClientConfig:       tlsConfig,
 	}
 
 	client := resty.New().
+		SetTransport(transport).
 		SetBaseURL(cfg.APIURL).
-		SetHeader("X-API-Key", cfg.APIKey).
+		SetHeader("X-API-Key", apiKey).
 		SetHeader("Content-Type", "application/json").
-		SetTLSClientConfig(&tls.Config{InsecureSkipVerify: isLocalhost})
+		OnAfterResponse(forgetRejectedKey)
 
 	return &Client{
 		client: client,
 		config: cfg,
+		retry:  newRetryPolicy(cfg),
 	}, nil
 }
 
-// UploadFile uploads a file to the API
-func (c *Client) UploadFile(filePath string, update bool) (*UploadResponse, error) {
+// bounded limits ctx to request_timeout, for a single attempt at a request
+// whose response is read in full. Uploads and downloads aren't bounded this
+// way, since transferring a large file may take longer.
+func (c *Client) bounded(ctx context.Context) (context.Context, context.CancelFunc) {
+	if c.config.RequestTimeout <= 0 {
+		return context.WithCancel(ctx)
+	}
+	return context.WithTimeout(ctx, c.config.RequestTimeout)
+}
+
+// RemoteName returns the server-side file name for an absolute local path.
+// The name is the path with its leading separator dropped and the remaining
+// separators replaced by underscores, e.g. /home/user/docs/notes.txt becomes
+// home_user_docs_notes.txt.
+func RemoteName(absPath string) string {
+	path := filepath.Clean(absPath)
+	path = strings.TrimPrefix(path, filepath.VolumeName(path))
+	path = strings.TrimLeft(path, string(filepath.Separator))
+	return strings.ReplaceAll(path, string(filepath.Separator), "_")
+}
+
+// UploadFile uploads a file to the API under its RemoteName, which is sent as
+// the multipart file name in place of the base name so that files with the
+// same name in different directories are stored apart. Only updates are
+// retried after transient failures, since the server replaces the file either
+// way; retrying a plain upload could index it twice.
+func (c *Client) UploadFile(ctx context.Context, filePath string, update bool) (*UploadResponse, error) {
 	// Convert to absolute path
 	absPath, err := filepath.Abs(filePath)
 	if err != nil {
@@ -96,81 +188,102 @@ func (c *Client) UploadFile(filePath string, update bool) (*UploadResponse, erro
 	}
 
 	// Validate file exists and is readable
-	if _, err := os.Stat(absPath); err != nil {
+	file, err := os.Open(absPath)
+	if err != nil {
 		return nil, fmt.Errorf("failed to access file: %w", err)
 	}
-
-	resp, err := c.client.R().
-		SetFile("file", absPath).
-		SetFormData(map[string]string{
-			"update": fmt.Sprintf("%t", update),
-		}).
-		SetResult(&UploadResponse{}).
-		Post("/index")
+	defer file.Close()
+
+	resp, err := c.retry.do(ctx, update, func() (*resty.Response, error) {
+		// Send the whole file again on every attempt
+		if _, err := file.Seek(0, io.SeekStart); err != nil {
+			return nil, err
+		}
+		return c.client.R().
+			SetContext(ctx).
+			SetFileReader("file", RemoteName(absPath), file).
+			SetFormData(map[string]string{
+				"update": fmt.Sprintf("%t", update),
+			}).
+			SetResult(&UploadResponse{}).
+			Post("/index")
+	})
 
 	if err != nil {
 		return nil, fmt.Errorf("upload failed: %w", err)
 	}
 
 	if !resp.IsSuccess() {
-		return nil, fmt.Errorf("upload failed: %s", resp.String())
+		return nil, newAPIError("upload", resp)
 	}
 
 	result := resp.Result().(*UploadResponse)
-	fmt.Printf("File uploaded: %s\n", absPath)
-	fmt.Printf("Job ID: %s\n", result.JobID)
-
+	result.Path = absPath
+	result.Name = RemoteName(absPath)
 	return result, nil
 }
 
 // Search performs a semantic search
-func (c *Client) Search(query string, limit int, scoreThreshold float64) (*SearchResponse, error) {
+func (c *Client) Search(ctx context.Context, query string, limit int, scoreThreshold float64) (*SearchResponse, error) {
 	body := map[string]interface{}{
 		"query":           query,
 		"limit":           limit,
 		"score_threshold": scoreThreshold,
 	}
 
-	resp, err := c.client.R().
-		SetBody(body).
-		SetResult(&SearchResponse{}).
-		Post("/search")
+	// Searching doesn't change anything, so it is safe to retry
+	resp, err := c.retry.do(ctx, true, func() (*resty.Response, error) {
+		reqCtx, cancel := c.bounded(ctx)
+		defer cancel()
+		return c.client.R().
+			SetContext(reqCtx).
+			SetBody(body).
+			SetResult(&SearchResponse{}).
+			Post("/search")
+	})
 
 	if err != nil {
 		return nil, fmt.Errorf("search failed: %w", err)
 	}
 
 	if !resp.IsSuccess() {
-		return nil, fmt.Errorf("search failed: %s", resp.String())
+		return nil, newAPIError("search", resp)
 	}
 
 	return resp.Result().(*SearchResponse), nil
 }
 
 // ListFiles lists all files, optionally filtered by prefix
-func (c *Client) ListFiles(prefix string) (*ListFilesResponse, error) {
-	req := c.client.R().SetResult(&ListFilesResponse{})
+func (c *Client) ListFiles(ctx context.Context, prefix string) (*ListFilesResponse, error) {
+	resp, err := c.retry.do(ctx, true, func() (*resty.Response, error) {
+		reqCtx, cancel := c.bounded(ctx)
+		defer cancel()
+		req := c.client.R().SetContext(reqCtx).SetResult(&ListFilesResponse{})
 
-	if prefix != "" {
-		req.SetQueryParam("prefix", prefix)
-	}
+		if prefix != "" {
+			req.SetQueryParam("prefix", prefix)
+		}
 
-	resp, err := req.Get("/files/")
+		return req.Get("/files/")
+	})
 
 	if err != nil {
 		return nil, fmt.Errorf("list files failed: %w", err)
 	}
 
 	if !resp.IsSuccess() {
-		return nil, fmt.Errorf("list files failed: %s", resp.String())
+		return nil, newAPIError("list files", resp)
 	}
 
 	return resp.Result().(*ListFilesResponse), nil
 }
 
 // DeleteFile deletes a file
-func (c *Client) DeleteFile(fileName string) (*DeleteResponse, error) {
+func (c *Client) DeleteFile(ctx context.Context, fileName string) (*DeleteResponse, error) {
+	reqCtx, cancel := c.bounded(ctx)
+	defer cancel()
 	resp, err := c.client.R().
+		SetContext(reqCtx).
 		SetResult(&DeleteResponse{}).
 		Delete("/index/" + url.PathEscape(fileName))
 
@@ -179,56 +292,65 @@ func (c *Client) DeleteFile(fileName string) (*DeleteResponse, error) {
 	}
 
 	if !resp.IsSuccess() {
-		return nil, fmt.Errorf("delete failed: %s", resp.String())
+		return nil, newAPIError("delete", resp)
 	}
 
 	return resp.Result().(*DeleteResponse), nil
 }
 
-// DownloadFile downloads a file
-func (c *Client) DownloadFile(fileName, destPath string) error {
-	resp, err := c.client.R().
-		SetDoNotParseResponse(true).
-		Get("/files/" + url.PathEscape(fileName))
+// GetJobStatus gets the status of an indexing job
+func (c *Client) GetJobStatus(ctx context.Context, jobID string) (*JobStatusResponse, error) {
+	resp, err := c.retry.do(ctx, true, func() (*resty.Response, error) {
+		reqCtx, cancel := c.bounded(ctx)
+		defer cancel()
+		return c.client.R().
+			SetContext(reqCtx).
+			SetResult(&JobStatusResponse{}).
+			Get("/index/status/" + url.PathEscape(jobID))
+	})
 
 	if err != nil {
-		return fmt.Errorf("download failed: %w", err)
+		return nil, fmt.Errorf("status check failed: %w", err)
 	}
-	defer resp.RawBody().Close()
 
 	if !resp.IsSuccess() {
-		return fmt.Errorf("download failed: status %d", resp.StatusCode())
-	}
-
-	// Create destination file
-	outFile, err := os.Create(destPath)
-	if err != nil {
-		return fmt.Errorf("failed to create file: %w", err)
+		return nil, newAPIError("status check", resp)
 	}
-	defer outFile.Close()
 
-	// Copy response body to file
-	_, err = io.Copy(outFile, resp.RawBody())
-	if err != nil {
-		return fmt.Errorf("failed to write file: %w", err)
-	}
-
-	return nil
+	return resp.Result().(*JobStatusResponse), nil
 }
 
-// GetJobStatus gets the status of an indexing job
-func (c *Client) GetJobStatus(jobID string) (*JobStatusResponse, error) {
-	resp, err := c.client.R().
-		SetResult(&JobStatusResponse{}).
-		Get("/index/status/" + url.PathEscape(jobID))
-
-	if err != nil {
-		return nil, fmt.Errorf("status check failed: %w", err)
+// WaitForJob polls the status of a job every interval until it reaches a
+// terminal state, returning ErrJobTimeout along with the last known status
+// if that takes longer than timeout. A timeout of 0 waits forever; cancelling
+// ctx stops waiting early.
+func (c *Client) WaitForJob(ctx context.Context, jobID string, interval, timeout time.Duration) (*JobStatusResponse, error) {
+	var deadline time.Time
+	if timeout > 0 {
+		deadline = time.Now().Add(timeout)
 	}
 
-	if !resp.IsSuccess() {
-		return nil, fmt.Errorf("status check failed: %s", resp.String())
+	for {
+		status, err := c.GetJobStatus(ctx, jobID)
+		if err != nil {
+			return nil, err
+		}
+		if status.IsTerminal() {
+			return status, nil
+		}
+
+		wait := interval
+		if !deadline.IsZero() {
+			remaining := time.Until(deadline)
+			if remaining <= 0 {
+				return status, fmt.Errorf("%w %s (last status: %s)", ErrJobTimeout, jobID, status.Status)
+			}
+			wait = min(wait, remaining)
+		}
+		select {
+		case <-time.After(wait):
+		case <-ctx.Done():
+			return status, ctx.Err()
+		}
 	}
-
-	return resp.Result().(*JobStatusResponse), nil
 }
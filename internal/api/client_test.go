@@ -1,14 +1,34 @@
 package api
 
 import (
-	"net/url"
+	"bytes"
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io/fs"
+	"math/big"
+	"net"
+	"net/http"
+	"net/http/httptest"
 	"os"
 	"path/filepath"
+	"strconv"
 	"strings"
+	"sync/atomic"
 	"testing"
+	"time"
 
 	"github.com/spf13/viper"
+	"github.com/ThiagoAVicente/sfs-cli/internal/api/apitest"
 	"github.com/ThiagoAVicente/sfs-cli/internal/config"
+	"github.com/ThiagoAVicente/sfs-cli/internal/secrets"
 )
 
 func setupTestConfig(t *testing.T) {
@@ -30,6 +50,8 @@ func setupTestConfig(t *testing.T) {
 
 	config.Set("api_url", "https://test.localhost:8000")
 	config.Set("api_key", "test-key")
+	// Keep retries against unreachable servers fast
+	config.Set("retry_delay", "1ms")
 }
 
 func TestNewClient(t *testing.T) {
@@ -83,7 +105,7 @@ func TestUploadFileInvalidPath(t *testing.T) {
 	}
 
 	// Try to upload non-existent file
-	_, err = client.UploadFile("/nonexistent/file.txt", false)
+	_, err = client.UploadFile(context.Background(), "/nonexistent/file.txt", false)
 	if err == nil {
 		t.Error("Expected error when uploading non-existent file")
 	}
@@ -106,7 +128,7 @@ func TestUploadFileValidPath(t *testing.T) {
 
 	// Note: This will fail because the API server isn't running
 	// but it validates that the file exists and the request is formatted correctly
-	_, err = client.UploadFile(testFile, false)
+	_, err = client.UploadFile(context.Background(), testFile, false)
 	// We expect an error because the server isn't running, but not a file-related error
 	if err == nil {
 		t.Skip("API server is running, skipping validation-only test")
@@ -140,7 +162,7 @@ func TestUploadFileRelativePath(t *testing.T) {
 	}
 
 	// Upload using relative path
-	_, err = client.UploadFile("test.txt", false)
+	_, err = client.UploadFile(context.Background(), "test.txt", false)
 	// We expect an error because the server isn't running
 	// but it should handle the relative path correctly
 	if err == nil {
@@ -153,6 +175,42 @@ func TestUploadFileRelativePath(t *testing.T) {
 	}
 }
 
+func TestUploadFileName(t *testing.T) {
+	setupTestConfig(t)
+
+	sent := make(chan string, 1)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, header, err := r.FormFile("file")
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		sent <- header.Filename
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprint(w, `{"job_id": "job-1", "status": "queued"}`)
+	}))
+	defer server.Close()
+
+	config.Set("api_url", server.URL)
+	client, err := NewClient()
+	if err != nil {
+		t.Fatalf("Failed to create client: %v", err)
+	}
+
+	path := filepath.Join(t.TempDir(), "notes.txt")
+	if err := os.WriteFile(path, []byte("meeting notes"), 0644); err != nil {
+		t.Fatalf("Failed to create test file: %v", err)
+	}
+	if _, err := client.UploadFile(context.Background(), path, false); err != nil {
+		t.Fatalf("Upload failed: %v", err)
+	}
+
+	// The server gets the flattened path, not just notes.txt
+	if name := <-sent; name != RemoteName(path) {
+		t.Errorf("Expected the file to be sent as %q, got %q", RemoteName(path), name)
+	}
+}
+
 func TestSearchEmptyQuery(t *testing.T) {
 	setupTestConfig(t)
 
@@ -162,7 +220,7 @@ func TestSearchEmptyQuery(t *testing.T) {
 	}
 
 	// Search with empty query should still work (might return error from API)
-	_, err = client.Search("", 5, 0.5)
+	_, err = client.Search(context.Background(), "", 5, 0.5)
 	// We expect an error because the server isn't running
 	if err == nil {
 		t.Skip("API server is running, skipping validation-only test")
@@ -178,7 +236,7 @@ func TestSearchNegativeLimit(t *testing.T) {
 	}
 
 	// Negative limit should be handled by the API or client
-	_, err = client.Search("test query", -1, 0.5)
+	_, err = client.Search(context.Background(), "test query", -1, 0.5)
 	// We expect an error because the server isn't running
 	if err == nil {
 		t.Skip("API server is running, skipping validation-only test")
@@ -194,7 +252,7 @@ func TestDownloadFileInvalidDestination(t *testing.T) {
 	}
 
 	// Try to download to invalid path (non-existent directory)
-	err = client.DownloadFile("test.txt", "/nonexistent/directory/file.txt")
+	err = client.DownloadFile(context.Background(), "test.txt", "/nonexistent/directory/file.txt", false)
 	if err == nil {
 		t.Error("Expected error when downloading to invalid destination")
 	}
@@ -209,7 +267,7 @@ func TestListFiles(t *testing.T) {
 	}
 
 	// ListFiles should format the request correctly
-	_, err = client.ListFiles("")
+	_, err = client.ListFiles(context.Background(), "")
 	// We expect an error because the server isn't running
 	if err == nil {
 		t.Skip("API server is running, skipping validation-only test")
@@ -225,7 +283,7 @@ func TestDeleteFile(t *testing.T) {
 	}
 
 	// DeleteFile should format the request correctly
-	_, err = client.DeleteFile("test.txt")
+	_, err = client.DeleteFile(context.Background(), "test.txt")
 	// We expect an error because the server isn't running
 	if err == nil {
 		t.Skip("API server is running, skipping validation-only test")
@@ -241,7 +299,7 @@ func TestGetJobStatus(t *testing.T) {
 	}
 
 	// GetJobStatus should format the request correctly
-	_, err = client.GetJobStatus("test-job-id")
+	_, err = client.GetJobStatus(context.Background(), "test-job-id")
 	// We expect an error because the server isn't running
 	if err == nil {
 		t.Skip("API server is running, skipping validation-only test")
@@ -269,12 +327,12 @@ func TestCertificateValidationForLocalhost(t *testing.T) {
 		{
 			name:               "localhost with https",
 			apiURL:             "https://localhost:8000",
-			shouldSkipValidate: true,
+			shouldSkipValidate: false,
 		},
 		{
 			name:               "127.0.0.1 with https",
 			apiURL:             "https://127.0.0.1:8000",
-			shouldSkipValidate: true,
+			shouldSkipValidate: false,
 		},
 		{
 			name:               "local IP address",
@@ -289,7 +347,7 @@ func TestCertificateValidationForLocalhost(t *testing.T) {
 		{
 			name:               "localhost with http",
 			apiURL:             "http://localhost:8000",
-			shouldSkipValidate: true,
+			shouldSkipValidate: false,
 		},
 	}
 
@@ -304,21 +362,952 @@ func TestCertificateValidationForLocalhost(t *testing.T) {
 				t.Fatalf("Failed to create client: %v", err)
 			}
 
-			// Check TLS config using proper URL parsing
-			isLocalhost := false
-			if parsedURL, err := url.Parse(tt.apiURL); err == nil {
-				hostname := parsedURL.Hostname()
-				isLocalhost = hostname == "localhost" || hostname == "127.0.0.1"
+			// Verify client was created
+			if client == nil {
+				t.Fatal("Expected non-nil client")
 			}
 
-			if isLocalhost != tt.shouldSkipValidate {
-				t.Errorf("Expected shouldSkipValidate=%v for URL %s, but got %v", tt.shouldSkipValidate, tt.apiURL, isLocalhost)
+			// Local servers are verified like any other
+			transport := client.client.GetClient().Transport.(*http.Transport)
+			if skip := transport.TLSClientConfig.InsecureSkipVerify; skip != tt.shouldSkipValidate {
+				t.Errorf("Expected shouldSkipValidate=%v for URL %s, but got %v", tt.shouldSkipValidate, tt.apiURL, skip)
 			}
+		})
+	}
+}
 
-			// Verify client was created
-			if client == nil {
-				t.Error("Expected non-nil client")
+func TestRemoteName(t *testing.T) {
+	tests := []struct {
+		path     string
+		expected string
+	}{
+		{path: "/home/user/docs/notes.txt", expected: "home_user_docs_notes.txt"},
+		{path: "/notes.txt", expected: "notes.txt"},
+		{path: "/home/user/docs/../notes.txt", expected: "home_user_notes.txt"},
+		{path: "/home/user/docs/", expected: "home_user_docs"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			if got := RemoteName(tt.path); got != tt.expected {
+				t.Errorf("Expected %s, got %s", tt.expected, got)
+			}
+		})
+	}
+}
+
+func TestJobStatusTerminal(t *testing.T) {
+	tests := []struct {
+		status   string
+		terminal bool
+		failed   bool
+	}{
+		{status: "queued"},
+		{status: "in_progress"},
+		{status: "complete", terminal: true},
+		{status: "Completed", terminal: true},
+		{status: "failed", terminal: true, failed: true},
+		{status: "not_found", terminal: true, failed: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.status, func(t *testing.T) {
+			status := &JobStatusResponse{Status: tt.status}
+			if status.IsTerminal() != tt.terminal {
+				t.Errorf("Expected IsTerminal() = %v", tt.terminal)
+			}
+			if status.Failed() != tt.failed {
+				t.Errorf("Expected Failed() = %v", tt.failed)
+			}
+		})
+	}
+}
+
+func TestWaitForJob(t *testing.T) {
+	setupTestConfig(t)
+
+	var polls atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/index/status/job-1" {
+			http.NotFound(w, r)
+			return
+		}
+
+		status := "in_progress"
+		if polls.Add(1) >= 3 {
+			status = "complete"
+		}
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprintf(w, `{"job_id": "job-1", "status": %q}`, status)
+	}))
+	defer server.Close()
+
+	config.Set("api_url", server.URL)
+	client, err := NewClient()
+	if err != nil {
+		t.Fatalf("Failed to create client: %v", err)
+	}
+
+	status, err := client.WaitForJob(context.Background(), "job-1", time.Millisecond, time.Second)
+	if err != nil {
+		t.Fatalf("Failed to wait for job: %v", err)
+	}
+	if status.Status != "complete" || polls.Load() != 3 {
+		t.Errorf("Expected completion after 3 polls, got %q after %d", status.Status, polls.Load())
+	}
+
+	// A job that never finishes times out with its last status
+	polls.Store(-1000)
+	status, err = client.WaitForJob(context.Background(), "job-1", time.Millisecond, 20*time.Millisecond)
+	if !errors.Is(err, ErrJobTimeout) {
+		t.Fatalf("Expected timeout error, got %v", err)
+	}
+	if status == nil || status.Status != "in_progress" {
+		t.Errorf("Expected last status in_progress, got %+v", status)
+	}
+}
+
+func TestRequestTimeout(t *testing.T) {
+	tests := []struct {
+		name    string
+		handler http.HandlerFunc
+	}{
+		{
+			name:    "no response",
+			handler: func(w http.ResponseWriter, r *http.Request) {},
+		},
+		{
+			name: "response that stalls",
+			handler: func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("Content-Type", "application/json")
+				fmt.Fprint(w, `{"files": [`)
+				w.(http.Flusher).Flush()
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			setupTestConfig(t)
+
+			release := make(chan struct{})
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				tt.handler(w, r)
+				<-release
+			}))
+			defer server.Close()
+			defer close(release)
+
+			config.Set("api_url", server.URL)
+			config.Set("request_timeout", "50ms")
+			config.Set("max_retries", "1")
+			client, err := NewClient()
+			if err != nil {
+				t.Fatalf("Failed to create client: %v", err)
+			}
+
+			start := time.Now()
+			if _, err := client.ListFiles(context.Background(), ""); err == nil {
+				t.Fatal("Expected error from a server that never finishes responding")
+			}
+			if elapsed := time.Since(start); elapsed > 5*time.Second {
+				t.Errorf("Expected the request to time out quickly, took %s", elapsed)
+			}
+		})
+	}
+}
+
+func TestRequestCancel(t *testing.T) {
+	setupTestConfig(t)
+
+	release := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-release
+	}))
+	defer server.Close()
+	defer close(release)
+
+	config.Set("api_url", server.URL)
+	client, err := NewClient()
+	if err != nil {
+		t.Fatalf("Failed to create client: %v", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(20*time.Millisecond, cancel)
+
+	_, err = client.Search(ctx, "query", 5, 0.5)
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("Expected context.Canceled, got %v", err)
+	}
+}
+
+func TestWaitForJobCancel(t *testing.T) {
+	setupTestConfig(t)
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprint(w, `{"job_id": "job-1", "status": "queued"}`)
+	}))
+	defer server.Close()
+
+	config.Set("api_url", server.URL)
+	client, err := NewClient()
+	if err != nil {
+		t.Fatalf("Failed to create client: %v", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+
+	if _, err := client.WaitForJob(ctx, "job-1", time.Second, 0); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Expected context.DeadlineExceeded, got %v", err)
+	}
+}
+
+func TestRetry(t *testing.T) {
+	tests := []struct {
+		name      string
+		failures  int
+		status    int
+		call      func(*Client) error
+		wantCalls int32
+		wantErr   bool
+	}{
+		{
+			name:      "search recovers from a bad gateway",
+			failures:  1,
+			status:    http.StatusBadGateway,
+			call:      func(c *Client) error { _, err := c.Search(context.Background(), "query", 5, 0.5); return err },
+			wantCalls: 2,
+		},
+		{
+			name:      "list retries until attempts run out",
+			failures:  10,
+			status:    http.StatusServiceUnavailable,
+			call:      func(c *Client) error { _, err := c.ListFiles(context.Background(), ""); return err },
+			wantCalls: 3,
+			wantErr:   true,
+		},
+		{
+			name:      "job status honors too many requests",
+			failures:  1,
+			status:    http.StatusTooManyRequests,
+			call:      func(c *Client) error { _, err := c.GetJobStatus(context.Background(), "job-1"); return err },
+			wantCalls: 2,
+		},
+		{
+			name:      "client errors are not retried",
+			failures:  1,
+			status:    http.StatusBadRequest,
+			call:      func(c *Client) error { _, err := c.ListFiles(context.Background(), ""); return err },
+			wantCalls: 1,
+			wantErr:   true,
+		},
+		{
+			name:     "download recovers from a server error",
+			failures: 2,
+			status:   http.StatusInternalServerError,
+			call: func(c *Client) error {
+				return c.DownloadFile(context.Background(), "a.txt", filepath.Join(t.TempDir(), "a.txt"), false)
+			},
+			wantCalls: 3,
+		},
+		{
+			name:      "deletes are not retried",
+			failures:  1,
+			status:    http.StatusBadGateway,
+			call:      func(c *Client) error { _, err := c.DeleteFile(context.Background(), "a.txt"); return err },
+			wantCalls: 1,
+			wantErr:   true,
+		},
+		{
+			name:     "new uploads are not retried",
+			failures: 1,
+			status:   http.StatusBadGateway,
+			call: func(c *Client) error {
+				_, err := c.UploadFile(context.Background(), "client_test.go", false)
+				return err
+			},
+			wantCalls: 1,
+			wantErr:   true,
+		},
+		{
+			name:     "updates are retried",
+			failures: 1,
+			status:   http.StatusBadGateway,
+			call: func(c *Client) error {
+				_, err := c.UploadFile(context.Background(), "client_test.go", true)
+				return err
+			},
+			wantCalls: 2,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			setupTestConfig(t)
+
+			var calls atomic.Int32
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if calls.Add(1) <= int32(tt.failures) {
+					w.Header().Set("Retry-After", "0")
+					w.WriteHeader(tt.status)
+					return
+				}
+				w.Header().Set("Content-Type", "application/json")
+				fmt.Fprint(w, `{"job_id": "job-1", "status": "complete", "results": [], "files": []}`)
+			}))
+			defer server.Close()
+
+			config.Set("api_url", server.URL)
+			config.Set("max_retries", "2")
+			client, err := NewClient()
+			if err != nil {
+				t.Fatalf("Failed to create client: %v", err)
+			}
+
+			err = tt.call(client)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("Expected error %v, got %v", tt.wantErr, err)
+			}
+			if calls.Load() != tt.wantCalls {
+				t.Errorf("Expected %d calls, got %d", tt.wantCalls, calls.Load())
 			}
 		})
 	}
 }
+
+func TestRetryWait(t *testing.T) {
+	policy := retryPolicy{maxRetries: 5, baseDelay: 100 * time.Millisecond, maxDelay: time.Second}
+
+	for attempt, want := range map[int]time.Duration{1: 100 * time.Millisecond, 3: 400 * time.Millisecond, 10: time.Second, 64: time.Second} {
+		if wait := policy.wait(attempt, nil); wait < want/2 || wait > want {
+			t.Errorf("Attempt %d: expected a wait between %s and %s, got %s", attempt, want/2, want, wait)
+		}
+	}
+}
+
+func TestRetryAfter(t *testing.T) {
+	tests := []struct {
+		value string
+		want  time.Duration
+		ok    bool
+	}{
+		{"", 0, false},
+		{"3", 3 * time.Second, true},
+		{"-1", 0, true},
+		{"soon", 0, false},
+		{"Mon, 02 Jan 2006 15:04:05 GMT", 0, true},
+	}
+
+	for _, tt := range tests {
+		got, ok := retryAfter(tt.value)
+		if got != tt.want || ok != tt.ok {
+			t.Errorf("retryAfter(%q) = %s, %v; expected %s, %v", tt.value, got, ok, tt.want, tt.ok)
+		}
+	}
+
+	// Dates in the future wait until then
+	date := time.Now().Add(time.Minute).UTC().Format(http.TimeFormat)
+	if got, ok := retryAfter(date); !ok || got <= 50*time.Second || got > time.Minute {
+		t.Errorf("retryAfter(%q) = %s, %v; expected about a minute", date, got, ok)
+	}
+}
+
+func TestAPIError(t *testing.T) {
+	tests := []struct {
+		name        string
+		status      int
+		body        string
+		requestID   string
+		call        func(*Client) error
+		wantMessage string
+		wantError   string
+	}{
+		{
+			name:        "detail message",
+			status:      http.StatusNotFound,
+			body:        `{"detail": "File not found"}`,
+			call:        func(c *Client) error { _, err := c.DeleteFile(context.Background(), "a.txt"); return err },
+			wantMessage: "File not found",
+			wantError:   "delete failed: File not found (HTTP 404)",
+		},
+		{
+			name:        "validation errors",
+			status:      http.StatusUnprocessableEntity,
+			body:        `{"detail": [{"loc": ["body", "limit"], "msg": "must be positive"}, {"msg": "bad query"}]}`,
+			call:        func(c *Client) error { _, err := c.Search(context.Background(), "query", -1, 0.5); return err },
+			wantMessage: "body.limit: must be positive; bad query",
+		},
+		{
+			name:        "plain text body with request ID",
+			status:      http.StatusUnauthorized,
+			body:        "invalid key\n",
+			requestID:   "req-42",
+			call:        func(c *Client) error { _, err := c.ListFiles(context.Background(), ""); return err },
+			wantMessage: "invalid key",
+			wantError:   "list files failed: invalid key (HTTP 401, request ID req-42)",
+		},
+		{
+			name:   "streamed download body",
+			status: http.StatusNotFound,
+			body:   `{"detail": "No such file"}`,
+			call: func(c *Client) error {
+				return c.DownloadFile(context.Background(), "a.txt", filepath.Join(t.TempDir(), "a.txt"), false)
+			},
+			wantMessage: "No such file",
+		},
+		{
+			name:        "empty body",
+			status:      http.StatusForbidden,
+			call:        func(c *Client) error { _, err := c.GetJobStatus(context.Background(), "job-1"); return err },
+			wantMessage: "",
+			wantError:   "status check failed: forbidden (HTTP 403)",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			setupTestConfig(t)
+
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if tt.requestID != "" {
+					w.Header().Set("X-Request-ID", tt.requestID)
+				}
+				w.WriteHeader(tt.status)
+				fmt.Fprint(w, tt.body)
+			}))
+			defer server.Close()
+
+			config.Set("api_url", server.URL)
+			client, err := NewClient()
+			if err != nil {
+				t.Fatalf("Failed to create client: %v", err)
+			}
+
+			err = tt.call(client)
+			var apiErr *APIError
+			if !errors.As(err, &apiErr) {
+				t.Fatalf("Expected an APIError, got %v", err)
+			}
+			if apiErr.StatusCode != tt.status || apiErr.Message != tt.wantMessage || apiErr.RequestID != tt.requestID {
+				t.Errorf("Unexpected error fields: %+v", apiErr)
+			}
+			if tt.wantError != "" && err.Error() != tt.wantError {
+				t.Errorf("Expected error %q, got %q", tt.wantError, err.Error())
+			}
+		})
+	}
+}
+
+func TestAPIErrorChecks(t *testing.T) {
+	tests := []struct {
+		err          error
+		notFound     bool
+		unauthorized bool
+		clientError  bool
+	}{
+		{&APIError{StatusCode: http.StatusNotFound}, true, false, true},
+		{&APIError{StatusCode: http.StatusUnauthorized}, false, true, false},
+		{&APIError{StatusCode: http.StatusForbidden}, false, true, false},
+		{&APIError{StatusCode: http.StatusBadRequest}, false, false, true},
+		{&APIError{StatusCode: http.StatusTooManyRequests}, false, false, false},
+		{&APIError{StatusCode: http.StatusInternalServerError}, false, false, false},
+		{fmt.Errorf("wrapped: %w", &APIError{StatusCode: http.StatusNotFound}), true, false, true},
+		{errors.New("connection refused"), false, false, false},
+		{nil, false, false, false},
+	}
+
+	for _, tt := range tests {
+		if IsNotFound(tt.err) != tt.notFound || IsUnauthorized(tt.err) != tt.unauthorized || IsClientError(tt.err) != tt.clientError {
+			t.Errorf("%v: expected not found %v, unauthorized %v, client error %v",
+				tt.err, tt.notFound, tt.unauthorized, tt.clientError)
+		}
+	}
+}
+
+func TestClientAgainstFakeServer(t *testing.T) {
+	setupTestConfig(t)
+
+	server := apitest.NewServer()
+	defer server.Close()
+
+	config.Set("api_url", server.URL)
+	config.Set("api_key", apitest.APIKey)
+	cli, err := NewClient()
+	if err != nil {
+		t.Fatalf("Failed to create client: %v", err)
+	}
+	var client Service = cli
+	ctx := context.Background()
+
+	path := filepath.Join(t.TempDir(), "notes.txt")
+	content := "Shopping list: apples and pears.\n\nMeeting notes about the quarterly budget."
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatalf("Failed to write file: %v", err)
+	}
+	name := RemoteName(path)
+
+	upload, err := client.UploadFile(ctx, path, false)
+	if err != nil {
+		t.Fatalf("Failed to upload: %v", err)
+	}
+	if upload.Path != path || upload.Name != name {
+		t.Errorf("Expected the upload of %s as %s, got %+v", path, name, upload)
+	}
+	if status, err := client.WaitForJob(ctx, upload.JobID, time.Millisecond, time.Second); err != nil || status.Failed() {
+		t.Fatalf("Expected upload job to complete, got %+v, %v", status, err)
+	}
+
+	// Uploading again needs update
+	if _, err := client.UploadFile(ctx, path, false); statusCode(err) != http.StatusConflict {
+		t.Errorf("Expected a conflict for a duplicate upload, got %v", err)
+	}
+	if _, err := client.UploadFile(ctx, path, true); err != nil {
+		t.Errorf("Failed to update: %v", err)
+	}
+
+	list, err := client.ListFiles(ctx, name[:5])
+	if err != nil || list.Count != 1 || list.Files[0] != name {
+		t.Errorf("Expected %s to be listed, got %+v, %v", name, list, err)
+	}
+
+	results, err := client.Search(ctx, "budget meeting", 5, 0.5)
+	if err != nil {
+		t.Fatalf("Failed to search: %v", err)
+	}
+	if len(results.Results) != 1 || results.Results[0].Payload.ChunkIndex != 1 || results.Results[0].Score != 1 {
+		t.Errorf("Expected the second paragraph to match, got %+v", results.Results)
+	}
+
+	dest := filepath.Join(t.TempDir(), "copy.txt")
+	if err := client.DownloadFile(ctx, name, dest, false); err != nil {
+		t.Fatalf("Failed to download: %v", err)
+	}
+	if data, _ := os.ReadFile(dest); string(data) != content {
+		t.Errorf("Expected downloaded contents to match, got %q", data)
+	}
+
+	if _, err := client.DeleteFile(ctx, name); err != nil {
+		t.Errorf("Failed to delete: %v", err)
+	}
+	if _, err := client.DeleteFile(ctx, name); !IsNotFound(err) {
+		t.Errorf("Expected deleting a missing file to be not found, got %v", err)
+	}
+	if _, err := client.GetJobStatus(ctx, "unknown"); !IsNotFound(err) {
+		t.Errorf("Expected an unknown job to be not found, got %v", err)
+	}
+
+	// Transient failures are retried
+	server.FailNext(2, http.StatusServiceUnavailable)
+	if _, err := client.ListFiles(ctx, ""); err != nil {
+		t.Errorf("Expected list to succeed after retries, got %v", err)
+	}
+
+	server.SetAPIKey("other-key")
+	if _, err := client.ListFiles(ctx, ""); !IsUnauthorized(err) {
+		t.Errorf("Expected a rejected key to be unauthorized, got %v", err)
+	}
+}
+
+// writeTestCert generates a self-signed certificate and key for 127.0.0.1,
+// writes them as PEM files in dir and returns their paths
+func writeTestCert(t *testing.T, dir, name string) (certPath, keyPath string) {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("Failed to generate key: %v", err)
+	}
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: name},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth, x509.ExtKeyUsageServerAuth},
+		IPAddresses:           []net.IP{net.ParseIP("127.0.0.1")},
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatalf("Failed to create certificate: %v", err)
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatalf("Failed to encode key: %v", err)
+	}
+
+	certPath = filepath.Join(dir, name+".crt")
+	keyPath = filepath.Join(dir, name+".key")
+	os.WriteFile(certPath, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0600)
+	os.WriteFile(keyPath, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}), 0600)
+	return certPath, keyPath
+}
+
+func TestTLSConfig(t *testing.T) {
+	dir := t.TempDir()
+	clientCert, clientKey := writeTestCert(t, dir, "client")
+	otherCA, _ := writeTestCert(t, dir, "other")
+
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprint(w, `{"files": [], "count": 0}`)
+	})
+
+	server := httptest.NewTLSServer(handler)
+	defer server.Close()
+	serverCA := filepath.Join(dir, "server.crt")
+	os.WriteFile(serverCA, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: server.Certificate().Raw}), 0600)
+
+	// Requires clients to present the client certificate
+	clientPEM, err := os.ReadFile(clientCert)
+	if err != nil {
+		t.Fatalf("Failed to read certificate: %v", err)
+	}
+	clientCAs := x509.NewCertPool()
+	clientCAs.AppendCertsFromPEM(clientPEM)
+	mtlsServer := httptest.NewUnstartedServer(handler)
+	mtlsServer.TLS = &tls.Config{ClientAuth: tls.RequireAndVerifyClientCert, ClientCAs: clientCAs}
+	mtlsServer.StartTLS()
+	defer mtlsServer.Close()
+	mtlsCA := filepath.Join(dir, "mtls-server.crt")
+	os.WriteFile(mtlsCA, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: mtlsServer.Certificate().Raw}), 0600)
+
+	tests := []struct {
+		name      string
+		url       string
+		settings  map[string]string
+		clientErr bool
+		wantErr   bool
+	}{
+		{
+			name:     "custom CA bundle",
+			url:      server.URL,
+			settings: map[string]string{"tls_ca_file": serverCA},
+		},
+		{
+			name:     "CA bundle that didn't sign the server",
+			url:      server.URL,
+			settings: map[string]string{"tls_ca_file": otherCA},
+			wantErr:  true,
+		},
+		{
+			name:    "local server without CA bundle",
+			url:     server.URL,
+			wantErr: true,
+		},
+		{
+			name:     "insecure skips verification",
+			url:      server.URL,
+			settings: map[string]string{"tls_ca_file": otherCA, "tls_insecure": "true"},
+		},
+		{
+			name:     "client certificate",
+			url:      mtlsServer.URL,
+			settings: map[string]string{"tls_ca_file": mtlsCA, "tls_cert_file": clientCert, "tls_key_file": clientKey},
+		},
+		{
+			name:     "missing client certificate",
+			url:      mtlsServer.URL,
+			settings: map[string]string{"tls_ca_file": mtlsCA},
+			wantErr:  true,
+		},
+		{
+			name:      "certificate without key",
+			url:       server.URL,
+			settings:  map[string]string{"tls_cert_file": clientCert},
+			clientErr: true,
+		},
+		{
+			name:      "CA bundle without certificates",
+			url:       server.URL,
+			settings:  map[string]string{"tls_ca_file": clientKey},
+			clientErr: true,
+		},
+		{
+			name:      "missing CA bundle",
+			url:       server.URL,
+			settings:  map[string]string{"tls_ca_file": filepath.Join(dir, "missing.crt")},
+			clientErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			setupTestConfig(t)
+			config.Set("api_url", tt.url)
+			config.Set("max_retries", "0")
+			// Bypass validation, as if the config file had been edited by hand
+			for key, value := range tt.settings {
+				viper.Set(key, value)
+			}
+
+			client, err := NewClient()
+			if (err != nil) != tt.clientErr {
+				t.Fatalf("Expected client error %v, got %v", tt.clientErr, err)
+			}
+			if err != nil {
+				return
+			}
+
+			_, err = client.ListFiles(context.Background(), "")
+			if (err != nil) != tt.wantErr {
+				t.Errorf("Expected request error %v, got %v", tt.wantErr, err)
+			}
+		})
+	}
+}
+
+func TestAPIKeySources(t *testing.T) {
+	setupTestConfig(t)
+	defer ForgetAPIKeys()
+
+	server := apitest.NewServer()
+	defer server.Close()
+	config.Set("api_url", server.URL)
+	config.Set("api_key", "stale-key")
+
+	dir := t.TempDir()
+	keyFile := filepath.Join(dir, "key")
+	os.WriteFile(keyFile, []byte(apitest.APIKey+"\n"), 0600)
+	config.Set("api_key_file", keyFile)
+
+	cli, err := NewClient()
+	if err != nil {
+		t.Fatalf("Failed to create client: %v", err)
+	}
+	if _, err := cli.ListFiles(context.Background(), ""); err != nil {
+		t.Errorf("Expected the key from api_key_file to be accepted, got %v", err)
+	}
+
+	// The command wins over the file and runs once per process until the
+	// cached keys are forgotten
+	runs := filepath.Join(dir, "runs")
+	config.Set("api_key_command", fmt.Sprintf("echo run >> %s; printf 'rotated-key\\nuser: sfs\\n'", runs))
+	for range 2 {
+		if _, err := NewClient(); err != nil {
+			t.Fatalf("Failed to create client: %v", err)
+		}
+	}
+	if data, _ := os.ReadFile(runs); strings.Count(string(data), "run") != 1 {
+		t.Errorf("Expected api_key_command to run once, got %q", data)
+	}
+
+	server.SetAPIKey("rotated-key")
+	cli, _ = NewClient()
+	if _, err := cli.ListFiles(context.Background(), ""); err != nil {
+		t.Errorf("Expected the first line of the command output to be the key, got %v", err)
+	}
+
+	ForgetAPIKeys()
+	NewClient()
+	if data, _ := os.ReadFile(runs); strings.Count(string(data), "run") != 2 {
+		t.Errorf("Expected api_key_command to run again after ForgetAPIKeys, got %q", data)
+	}
+
+	config.Set("api_key_command", "true")
+	if _, err := NewClient(); err == nil || !strings.Contains(err.Error(), "no API key") {
+		t.Errorf("Expected an error for a command printing nothing, got %v", err)
+	}
+	config.Set("api_key_command", "exit 3")
+	if _, err := NewClient(); err == nil {
+		t.Error("Expected an error for a failing command")
+	}
+}
+
+func TestRejectedAPIKeyIsForgotten(t *testing.T) {
+	setupTestConfig(t)
+	defer ForgetAPIKeys()
+
+	server := apitest.NewServer()
+	defer server.Close()
+	config.Set("api_url", server.URL)
+
+	keyFile := filepath.Join(t.TempDir(), "key")
+	os.WriteFile(keyFile, []byte(apitest.APIKey), 0600)
+	config.Set("api_key_command", "cat "+keyFile)
+
+	cli, err := NewClient()
+	if err != nil {
+		t.Fatalf("Failed to create client: %v", err)
+	}
+	if _, err := cli.ListFiles(context.Background(), ""); err != nil {
+		t.Fatalf("Expected the key to be accepted, got %v", err)
+	}
+
+	// Rotating the key makes the server reject the cached one, whichever
+	// request it was sent with
+	os.WriteFile(keyFile, []byte("rotated-key"), 0600)
+	server.SetAPIKey("rotated-key")
+	if _, err := cli.DeleteFile(context.Background(), "notes.txt"); !IsUnauthorized(err) {
+		t.Fatalf("Expected the old key to be rejected, got %v", err)
+	}
+
+	cli, err = NewClient()
+	if err != nil {
+		t.Fatalf("Failed to create client: %v", err)
+	}
+	if _, err := cli.ListFiles(context.Background(), ""); err != nil {
+		t.Errorf("Expected the rotated key to be read again, got %v", err)
+	}
+}
+
+func TestEncryptedAPIKey(t *testing.T) {
+	setupTestConfig(t)
+	defer ForgetAPIKeys()
+
+	server := apitest.NewServer()
+	defer server.Close()
+	config.Set("api_url", server.URL)
+	config.Set("api_key", "")
+
+	store, err := secrets.OpenDefault()
+	if err != nil {
+		t.Fatalf("Failed to open secrets: %v", err)
+	}
+	if err := store.Set(config.DefaultProfile, apitest.APIKey, "passphrase"); err != nil {
+		t.Fatalf("Failed to store key: %v", err)
+	}
+
+	// Without a terminal, the key stays locked until a passphrase is given
+	stdin := os.Stdin
+	os.Stdin, _ = os.Open(os.DevNull)
+	defer func() { os.Stdin = stdin }()
+	if _, err := NewClient(); err == nil {
+		t.Error("Expected a locked key to fail")
+	}
+	t.Setenv(secrets.PassphraseEnv, "passphrase")
+	cli, err := NewClient()
+	if err != nil {
+		t.Fatalf("Failed to create client: %v", err)
+	}
+	if _, err := cli.ListFiles(context.Background(), ""); err != nil {
+		t.Errorf("Expected the decrypted key to be accepted, got %v", err)
+	}
+
+	// A profile without a key of its own uses the default profile's
+	if err := config.AddProfile("staging", server.URL); err != nil {
+		t.Fatalf("Failed to add profile: %v", err)
+	}
+	cli, err = NewProfileClient("staging")
+	if err != nil {
+		t.Fatalf("Failed to create client: %v", err)
+	}
+	if _, err := cli.ListFiles(context.Background(), ""); err != nil {
+		t.Errorf("Expected the default profile's key to be used, got %v", err)
+	}
+}
+
+func TestDownloadResume(t *testing.T) {
+	setupTestConfig(t)
+
+	content := strings.Repeat("0123456789", 1000)
+	modTime := time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC)
+
+	var cuts atomic.Int32
+	var ranges []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/files/missing.txt" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		ranges = append(ranges, r.Header.Get("Range"))
+		if cuts.Add(-1) >= 0 {
+			// Promise the whole file but drop the connection part way
+			w.Header().Set("Content-Length", strconv.Itoa(len(content)))
+			w.Header().Set("Last-Modified", modTime.Format(http.TimeFormat))
+			w.Write([]byte(content[:4000]))
+			panic(http.ErrAbortHandler)
+		}
+		http.ServeContent(w, r, "a.txt", modTime, strings.NewReader(content))
+	}))
+	defer server.Close()
+
+	config.Set("api_url", server.URL)
+	config.Set("max_retries", "0")
+	client, err := NewClient()
+	if err != nil {
+		t.Fatalf("Failed to create client: %v", err)
+	}
+	ctx := context.Background()
+	dir := t.TempDir()
+	dest := filepath.Join(dir, "a.txt")
+	part := dest + PartialSuffix
+
+	// An interrupted download keeps the partial file for later
+	cuts.Store(1)
+	if err := client.DownloadFile(ctx, "a.txt", dest, false); err == nil {
+		t.Fatal("Expected the interrupted download to fail")
+	}
+	if _, err := os.Stat(dest); !os.IsNotExist(err) {
+		t.Errorf("Expected no file at the destination, got %v", err)
+	}
+	info, err := os.Stat(part)
+	if err != nil || info.Size() != 4000 || !info.ModTime().Equal(modTime) {
+		t.Fatalf("Expected a partial file stamped with the server's time, got %v, %v", info, err)
+	}
+
+	// The next download picks up where it stopped
+	ranges = nil
+	if err := client.DownloadFile(ctx, "a.txt", dest, false); err != nil {
+		t.Fatalf("Failed to resume: %v", err)
+	}
+	if data, _ := os.ReadFile(dest); string(data) != content {
+		t.Errorf("Expected the resumed file to match, got %d bytes", len(data))
+	}
+	if len(ranges) != 1 || ranges[0] != "bytes=4000-" {
+		t.Errorf("Expected a single range request, got %q", ranges)
+	}
+	if _, err := os.Stat(part); !os.IsNotExist(err) {
+		t.Errorf("Expected the partial file to be gone, got %v", err)
+	}
+
+	// Existing files are only replaced when asked to
+	os.WriteFile(dest, []byte("local"), 0644)
+	if err := client.DownloadFile(ctx, "a.txt", dest, false); !errors.Is(err, fs.ErrExist) {
+		t.Errorf("Expected an existing file to be kept, got %v", err)
+	}
+	if data, _ := os.ReadFile(dest); string(data) != "local" {
+		t.Errorf("Expected the existing file to be untouched, got %q", data)
+	}
+	if err := client.DownloadFile(ctx, "a.txt", dest, true); err != nil {
+		t.Errorf("Failed to overwrite: %v", err)
+	}
+
+	// A partial file from another version of the file is started over
+	os.WriteFile(part, []byte("stale"), 0644)
+	if err := client.DownloadFile(ctx, "a.txt", dest, true); err != nil {
+		t.Fatalf("Failed to download: %v", err)
+	}
+	if data, _ := os.ReadFile(dest); string(data) != content {
+		t.Errorf("Expected a stale partial file to be replaced, got %d bytes", len(data))
+	}
+
+	// Errors from the server leave nothing behind
+	missing := filepath.Join(dir, "missing.txt")
+	if err := client.DownloadFile(ctx, "missing.txt", missing, false); !IsNotFound(err) {
+		t.Errorf("Expected a missing file to be not found, got %v", err)
+	}
+	if entries, _ := os.ReadDir(dir); len(entries) != 1 {
+		t.Errorf("Expected only the downloaded file to remain, got %v", entries)
+	}
+
+	// Streams resume within the same call
+	config.Set("max_retries", "1")
+	client, _ = NewClient()
+	cuts.Store(1)
+	ranges = nil
+	var buf bytes.Buffer
+	if err := client.Download(ctx, "a.txt", &buf); err != nil {
+		t.Fatalf("Failed to stream: %v", err)
+	}
+	if buf.String() != content {
+		t.Errorf("Expected the streamed file to match, got %d bytes", buf.Len())
+	}
+	if len(ranges) != 2 || ranges[1] != "bytes=4000-" {
+		t.Errorf("Expected the stream to resume with a range request, got %q", ranges)
+	}
+}
@@ -0,0 +1,156 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"os/exec"
+	"runtime"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-resty/resty/v2"
+	"github.com/ThiagoAVicente/sfs-cli/internal/config"
+	"github.com/ThiagoAVicente/sfs-cli/internal/secrets"
+)
+
+// keyCommandTimeout bounds how long api_key_command may run, leaving time
+// to answer a passphrase prompt
+const keyCommandTimeout = 2 * time.Minute
+
+// keyCache holds the API keys read from commands, files and the secrets
+// file, so each one is only run, read or decrypted once per process
+var keyCache = struct {
+	sync.Mutex
+	keys map[string]string
+}{keys: make(map[string]string)}
+
+// resolveAPIKey returns the API key of cfg: the output of api_key_command if
+// set, else the contents of api_key_file if set, else api_key itself, else
+// the profile's key in the encrypted secrets file. Like the plain-text
+// settings, a profile without an encrypted key of its own uses the default
+// profile's.
+func resolveAPIKey(cfg *config.Config) (string, error) {
+	switch {
+	case cfg.APIKeyCommand != "":
+		return cachedKey("command:"+cfg.APIKeyCommand, func() (string, error) {
+			return runKeyCommand(cfg.APIKeyCommand)
+		})
+	case cfg.APIKeyFile != "":
+		return cachedKey("file:"+cfg.APIKeyFile, func() (string, error) {
+			return readKeyFile(cfg.APIKeyFile)
+		})
+	case cfg.APIKey != "":
+		return cfg.APIKey, nil
+	}
+
+	store, err := secrets.OpenDefault()
+	if err != nil {
+		return "", err
+	}
+	name := cfg.Profile
+	if !store.Has(name) {
+		name = config.DefaultProfile
+	}
+	if !store.Has(name) {
+		return "", nil
+	}
+	return cachedKey("secret:"+store.Path()+":"+name, func() (string, error) {
+		passphrase, err := secrets.Passphrase()
+		if err != nil {
+			return "", err
+		}
+		key, err := store.Get(name, passphrase)
+		if err != nil {
+			return "", fmt.Errorf("failed to decrypt API key: %w", err)
+		}
+		return key, nil
+	})
+}
+
+// ForgetAPIKeys drops the cached keys, so the next client runs
+// api_key_command or reads api_key_file again and picks up a rotated key
+func ForgetAPIKeys() {
+	keyCache.Lock()
+	defer keyCache.Unlock()
+	clear(keyCache.keys)
+}
+
+// forgetRejectedKey is a response hook that drops the cached keys when the
+// server rejects the API key. It may have been rotated, so the next client
+// runs api_key_command or reads api_key_file again.
+func forgetRejectedKey(_ *resty.Client, resp *resty.Response) error {
+	switch resp.StatusCode() {
+	case http.StatusUnauthorized, http.StatusForbidden:
+		ForgetAPIKeys()
+	}
+	return nil
+}
+
+// cachedKey returns the cached key for source, calling read on a miss
+func cachedKey(source string, read func() (string, error)) (string, error) {
+	keyCache.Lock()
+	defer keyCache.Unlock()
+
+	if key, ok := keyCache.keys[source]; ok {
+		return key, nil
+	}
+	key, err := read()
+	if err != nil {
+		return "", err
+	}
+	keyCache.keys[source] = key
+	return key, nil
+}
+
+// runKeyCommand runs command through the shell and returns the first line of
+// its output. Stdin and stderr are passed through so password managers can
+// prompt for a passphrase.
+func runKeyCommand(command string) (string, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), keyCommandTimeout)
+	defer cancel()
+
+	var cmd *exec.Cmd
+	if runtime.GOOS == "windows" {
+		cmd = exec.CommandContext(ctx, "cmd", "/C", command)
+	} else {
+		cmd = exec.CommandContext(ctx, "sh", "-c", command)
+	}
+	var stdout bytes.Buffer
+	cmd.Stdin = os.Stdin
+	cmd.Stdout = &stdout
+	cmd.Stderr = os.Stderr
+
+	if err := cmd.Run(); err != nil {
+		if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+			return "", fmt.Errorf("api_key_command timed out after %s", keyCommandTimeout)
+		}
+		return "", fmt.Errorf("api_key_command failed: %w", err)
+	}
+
+	// Tools like `pass` print the secret on the first line and metadata after
+	key, _, _ := strings.Cut(stdout.String(), "\n")
+	key = strings.TrimSpace(key)
+	if key == "" {
+		return "", fmt.Errorf("api_key_command printed no API key")
+	}
+	return key, nil
+}
+
+// readKeyFile returns the API key stored in path, ignoring surrounding
+// whitespace
+func readKeyFile(path string) (string, error) {
+	data, err := os.ReadFile(config.ExpandHome(path))
+	if err != nil {
+		return "", fmt.Errorf("failed to read api_key_file: %w", err)
+	}
+	key := strings.TrimSpace(string(data))
+	if key == "" {
+		return "", fmt.Errorf("api_key_file %s is empty", path)
+	}
+	return key, nil
+}
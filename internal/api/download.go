@@ -0,0 +1,254 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-resty/resty/v2"
+)
+
+// PartialSuffix is added to the name of a file while it is being downloaded
+const PartialSuffix = ".sfs-part"
+
+// transfer is a download in progress
+type transfer struct {
+	w io.Writer
+	// written is how many bytes of the file w already holds
+	written int64
+	// validator is sent as If-Range when resuming, so the server only sends
+	// the rest of the file if it hasn't changed
+	validator string
+	// modTime is the server's Last-Modified time of the file
+	modTime time.Time
+	// restart empties w to receive the whole file again. It is nil when w
+	// can't be rewound, such as stdout.
+	restart func() error
+}
+
+// writeTracker records errors writing to w, to tell them apart from errors
+// reading the response
+type writeTracker struct {
+	w   io.Writer
+	err error
+}
+
+func (t *writeTracker) Write(p []byte) (int, error) {
+	n, err := t.w.Write(p)
+	if err != nil {
+		t.err = err
+	}
+	return n, err
+}
+
+// DownloadFile saves a stored file to destPath. The file is written to
+// destPath plus PartialSuffix and renamed into place once complete, so
+// destPath never holds half a file. If the transfer is interrupted, the
+// partial file is kept and the next call resumes it, provided the server
+// supports Range requests and the file hasn't changed since. An existing
+// destPath is only replaced if overwrite is set.
+func (c *Client) DownloadFile(ctx context.Context, fileName, destPath string, overwrite bool) error {
+	if !overwrite {
+		if _, err := os.Lstat(destPath); err == nil {
+			return fmt.Errorf("%w: %s", fs.ErrExist, destPath)
+		}
+	}
+
+	partPath := destPath + PartialSuffix
+	part, err := os.OpenFile(partPath, os.O_RDWR|os.O_CREATE, 0644)
+	if err != nil {
+		return fmt.Errorf("failed to create file: %w", err)
+	}
+	info, err := part.Stat()
+	if err != nil {
+		part.Close()
+		return fmt.Errorf("failed to create file: %w", err)
+	}
+
+	t := &transfer{
+		w:       part,
+		written: info.Size(),
+		restart: func() error {
+			if err := part.Truncate(0); err != nil {
+				return err
+			}
+			_, err := part.Seek(0, io.SeekStart)
+			return err
+		},
+	}
+	if t.written > 0 {
+		// A kept partial file carries the server's Last-Modified time
+		t.modTime = info.ModTime()
+		t.validator = t.modTime.UTC().Format(http.TimeFormat)
+		if _, err := part.Seek(t.written, io.SeekStart); err != nil {
+			part.Close()
+			return fmt.Errorf("failed to write file: %w", err)
+		}
+	}
+
+	err = c.fetch(ctx, fileName, t)
+	if closeErr := part.Close(); err == nil && closeErr != nil {
+		err = fmt.Errorf("failed to write file: %w", closeErr)
+	}
+
+	if err != nil {
+		if resumable(t, err) {
+			os.Chtimes(partPath, t.modTime, t.modTime)
+		} else {
+			os.Remove(partPath)
+		}
+		return err
+	}
+
+	if err := os.Rename(partPath, destPath); err != nil {
+		os.Remove(partPath)
+		return fmt.Errorf("failed to write file: %w", err)
+	}
+	return nil
+}
+
+// Download writes a stored file to w. If the connection drops part way, the
+// rest is requested again when the server supports Range requests.
+func (c *Client) Download(ctx context.Context, fileName string, w io.Writer) error {
+	return c.fetch(ctx, fileName, &transfer{w: w})
+}
+
+// fetch copies a stored file into t, starting after the bytes t already
+// holds. Failures before the transfer starts are retried like any other
+// idempotent request; a transfer cut off part way is resumed from where it
+// stopped, up to max_retries times.
+func (c *Client) fetch(ctx context.Context, fileName string, t *transfer) error {
+	for attempt := 1; ; attempt++ {
+		resp, err := c.retry.do(ctx, true, func() (*resty.Response, error) {
+			req := c.client.R().
+				SetContext(ctx).
+				SetDoNotParseResponse(true)
+			if t.written > 0 {
+				req.SetHeader("Range", fmt.Sprintf("bytes=%d-", t.written))
+				if t.validator != "" {
+					req.SetHeader("If-Range", t.validator)
+				}
+			}
+			return req.Get("/files/" + url.PathEscape(fileName))
+		})
+		if err != nil {
+			return fmt.Errorf("download failed: %w", err)
+		}
+		body := resp.RawBody()
+
+		switch status := resp.StatusCode(); {
+		case status == http.StatusPartialContent:
+			if start := contentRangeStart(resp.Header().Get("Content-Range")); start != t.written {
+				body.Close()
+				return fmt.Errorf("download failed: server resumed at byte %d instead of %d", start, t.written)
+			}
+
+		case status == http.StatusRequestedRangeNotSatisfiable && t.written > 0:
+			// What we have is no shorter than the file on the server, so it
+			// isn't part of it
+			body.Close()
+			if err := t.rewind(); err != nil {
+				return err
+			}
+			continue
+
+		case resp.IsSuccess():
+			// The whole file, because it is the first request, the file
+			// changed or the server ignores Range
+			if t.written > 0 {
+				if err := t.rewind(); err != nil {
+					body.Close()
+					return err
+				}
+			}
+			t.validator = resumeValidator(resp.Header())
+			t.modTime, _ = http.ParseTime(resp.Header().Get("Last-Modified"))
+
+		default:
+			err := newAPIError("download", resp)
+			body.Close()
+			return err
+		}
+
+		w := &writeTracker{w: t.w}
+		n, err := io.Copy(w, body)
+		body.Close()
+		t.written += n
+		if err == nil {
+			return nil
+		}
+		if w.err != nil {
+			return fmt.Errorf("failed to write file: %w", w.err)
+		}
+
+		if ctx.Err() != nil {
+			return fmt.Errorf("download interrupted: %w", ctx.Err())
+		}
+		if attempt > c.retry.maxRetries {
+			return fmt.Errorf("download interrupted: %w", err)
+		}
+		select {
+		case <-time.After(c.retry.wait(attempt, nil)):
+		case <-ctx.Done():
+			return fmt.Errorf("download interrupted: %w", ctx.Err())
+		}
+	}
+}
+
+// resumable reports whether a download that failed with err can be resumed
+// later: some of the file arrived, its modification time is known to check
+// it hasn't changed, and the server didn't reject the request outright
+func resumable(t *transfer, err error) bool {
+	var apiErr *APIError
+	if errors.As(err, &apiErr) && apiErr.StatusCode < http.StatusInternalServerError {
+		return false
+	}
+	return t.written > 0 && !t.modTime.IsZero()
+}
+
+// rewind empties t to receive the whole file again
+func (t *transfer) rewind() error {
+	if t.restart == nil {
+		return errors.New("download failed: the file changed on the server or it can't resume the transfer")
+	}
+	if err := t.restart(); err != nil {
+		return fmt.Errorf("failed to write file: %w", err)
+	}
+	t.written = 0
+	return nil
+}
+
+// resumeValidator returns the If-Range value that resumes the contents of a
+// response: its ETag if it is a strong one, else its Last-Modified time
+func resumeValidator(header http.Header) string {
+	if etag := header.Get("ETag"); etag != "" && !strings.HasPrefix(etag, "W/") {
+		return etag
+	}
+	return header.Get("Last-Modified")
+}
+
+// contentRangeStart returns the first byte of a Content-Range header such as
+// "bytes 100-199/200", or -1 if it can't be parsed
+func contentRangeStart(value string) int64 {
+	rest, ok := strings.CutPrefix(value, "bytes ")
+	if !ok {
+		return -1
+	}
+	first, _, ok := strings.Cut(rest, "-")
+	if !ok {
+		return -1
+	}
+	start, err := strconv.ParseInt(first, 10, 64)
+	if err != nil {
+		return -1
+	}
+	return start
+}
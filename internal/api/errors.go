@@ -0,0 +1,158 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/go-resty/resty/v2"
+)
+
+// maxErrorBody bounds how much of an error response is read for its message
+const maxErrorBody = 64 * 1024
+
+// requestIDHeaders are the response headers servers commonly use to identify
+// a request in their logs
+var requestIDHeaders = []string{"X-Request-ID", "X-Correlation-ID", "X-Trace-ID"}
+
+// APIError is returned when the API answers a request with an error status
+type APIError struct {
+	// Op is the operation that failed, e.g. "search" or "upload"
+	Op string
+	// StatusCode is the HTTP status of the response
+	StatusCode int
+	// Message is the error message from the server, if it sent one
+	Message string
+	// RequestID identifies the request in the server's logs, if it sent one
+	RequestID string
+}
+
+// Error returns a readable description of the error
+func (e *APIError) Error() string {
+	message := e.Message
+	if message == "" {
+		message = strings.ToLower(http.StatusText(e.StatusCode))
+	}
+
+	details := fmt.Sprintf("HTTP %d", e.StatusCode)
+	if e.RequestID != "" {
+		details += ", request ID " + e.RequestID
+	}
+	return fmt.Sprintf("%s failed: %s (%s)", e.Op, message, details)
+}
+
+// IsNotFound reports whether err is an API error for something that doesn't
+// exist on the server
+func IsNotFound(err error) bool {
+	return statusCode(err) == http.StatusNotFound
+}
+
+// IsUnauthorized reports whether err is an API error caused by a missing or
+// rejected API key
+func IsUnauthorized(err error) bool {
+	status := statusCode(err)
+	return status == http.StatusUnauthorized || status == http.StatusForbidden
+}
+
+// IsClientError reports whether the server rejected the request itself, so
+// sending it again unchanged won't help. Rate limiting, timeouts and
+// authentication failures aren't counted, since those can clear up.
+func IsClientError(err error) bool {
+	status := statusCode(err)
+	switch status {
+	case http.StatusRequestTimeout, http.StatusTooManyRequests:
+		return false
+	}
+	return status >= 400 && status < 500 && !IsUnauthorized(err)
+}
+
+// statusCode returns the HTTP status of an APIError, or 0 for other errors
+func statusCode(err error) int {
+	var apiErr *APIError
+	if errors.As(err, &apiErr) {
+		return apiErr.StatusCode
+	}
+	return 0
+}
+
+// newAPIError builds the error for an unsuccessful response to op
+func newAPIError(op string, resp *resty.Response) *APIError {
+	body := resp.Body()
+	if body == nil && resp.RawResponse != nil {
+		// Streamed responses haven't been read yet
+		body, _ = io.ReadAll(io.LimitReader(resp.RawBody(), maxErrorBody))
+	}
+
+	apiErr := &APIError{
+		Op:         op,
+		StatusCode: resp.StatusCode(),
+		Message:    errorMessage(body),
+	}
+	for _, header := range requestIDHeaders {
+		if id := resp.Header().Get(header); id != "" {
+			apiErr.RequestID = id
+			break
+		}
+	}
+	return apiErr
+}
+
+// errorMessage extracts the error message from a response body. JSON bodies
+// are expected in FastAPI's {"detail": ...} shape, with "message" and "error"
+// fields as fallbacks; anything else is used as plain text.
+func errorMessage(body []byte) string {
+	var parsed struct {
+		Detail  json.RawMessage `json:"detail"`
+		Message string          `json:"message"`
+		Error   string          `json:"error"`
+	}
+	if err := json.Unmarshal(body, &parsed); err != nil {
+		text := strings.TrimSpace(string(body))
+		if len(text) > 200 {
+			text = text[:200] + "..."
+		}
+		return text
+	}
+
+	if detail := detailMessage(parsed.Detail); detail != "" {
+		return detail
+	}
+	if parsed.Message != "" {
+		return parsed.Message
+	}
+	return parsed.Error
+}
+
+// detailMessage renders a FastAPI detail field, which is either a string or
+// a list of validation errors
+func detailMessage(detail json.RawMessage) string {
+	var text string
+	if err := json.Unmarshal(detail, &text); err == nil {
+		return text
+	}
+
+	var validation []struct {
+		Loc []any  `json:"loc"`
+		Msg string `json:"msg"`
+	}
+	if err := json.Unmarshal(detail, &validation); err != nil {
+		return ""
+	}
+
+	messages := make([]string, 0, len(validation))
+	for _, v := range validation {
+		loc := make([]string, len(v.Loc))
+		for i, part := range v.Loc {
+			loc[i] = fmt.Sprint(part)
+		}
+		if len(loc) > 0 {
+			messages = append(messages, strings.Join(loc, ".")+": "+v.Msg)
+		} else {
+			messages = append(messages, v.Msg)
+		}
+	}
+	return strings.Join(messages, "; ")
+}
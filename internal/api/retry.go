@@ -0,0 +1,110 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"math/rand/v2"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/go-resty/resty/v2"
+	"github.com/ThiagoAVicente/sfs-cli/internal/config"
+)
+
+// maxRetryAfter caps how long a Retry-After header can make a request wait
+const maxRetryAfter = 5 * time.Minute
+
+// retryPolicy controls how idempotent requests are retried after transient
+// failures: network errors, 429 Too Many Requests and 5xx responses
+type retryPolicy struct {
+	maxRetries int
+	baseDelay  time.Duration
+	maxDelay   time.Duration
+}
+
+// newRetryPolicy builds the retry policy from the configuration
+func newRetryPolicy(cfg *config.Config) retryPolicy {
+	return retryPolicy{
+		maxRetries: max(cfg.MaxRetries, 0),
+		baseDelay:  cfg.RetryDelay,
+		maxDelay:   max(cfg.RetryMaxDelay, cfg.RetryDelay),
+	}
+}
+
+// do runs send, retrying transient failures with exponential backoff while
+// ctx allows. Only idempotent requests may be retried; for any other request
+// do runs send exactly once.
+func (p retryPolicy) do(ctx context.Context, idempotent bool, send func() (*resty.Response, error)) (*resty.Response, error) {
+	for attempt := 1; ; attempt++ {
+		resp, err := send()
+		if !idempotent || attempt > p.maxRetries || !retryable(ctx, resp, err) {
+			return resp, err
+		}
+
+		// Responses read as streams must be released before trying again
+		if resp != nil && resp.RawResponse != nil {
+			resp.RawResponse.Body.Close()
+		}
+
+		select {
+		case <-time.After(p.wait(attempt, resp)):
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+}
+
+// wait returns how long to wait after the given failed attempt (starting at
+// 1). A Retry-After header from the server takes precedence over the
+// exponential backoff.
+func (p retryPolicy) wait(attempt int, resp *resty.Response) time.Duration {
+	if resp != nil {
+		if delay, ok := retryAfter(resp.Header().Get("Retry-After")); ok {
+			return min(delay, maxRetryAfter)
+		}
+	}
+
+	delay := p.maxDelay
+	if attempt < 20 {
+		delay = min(p.baseDelay<<(attempt-1), p.maxDelay)
+	}
+
+	// Wait somewhere between half and the full delay
+	return delay/2 + rand.N(delay/2+1)
+}
+
+// retryable reports whether a request that ended with resp and err is worth
+// trying again
+func retryable(ctx context.Context, resp *resty.Response, err error) bool {
+	// An attempt that ran out of request_timeout is worth another, unless
+	// the caller's own deadline passed
+	if ctx.Err() != nil || errors.Is(err, context.Canceled) {
+		return false
+	}
+	if err != nil {
+		// Failing before a response arrived means a network error, as
+		// opposed to e.g. an unreadable response body
+		return resp == nil || resp.RawResponse == nil
+	}
+
+	status := resp.StatusCode()
+	return status == http.StatusTooManyRequests || status >= http.StatusInternalServerError
+}
+
+// retryAfter parses a Retry-After header, given either in seconds or as an
+// HTTP date
+func retryAfter(value string) (time.Duration, bool) {
+	if value == "" {
+		return 0, false
+	}
+
+	if seconds, err := strconv.Atoi(value); err == nil {
+		return time.Duration(max(seconds, 0)) * time.Second, true
+	}
+
+	if date, err := http.ParseTime(value); err == nil {
+		return max(time.Until(date), 0), true
+	}
+	return 0, false
+}
@@ -0,0 +1,32 @@
+package api
+
+import (
+	"context"
+	"io"
+	"time"
+)
+
+// Service is the set of operations the SFS API offers. Client implements it
+// over HTTP; code that only needs the operations should depend on Service so
+// it can be exercised against a fake.
+type Service interface {
+	// UploadFile indexes a local file under its RemoteName
+	UploadFile(ctx context.Context, filePath string, update bool) (*UploadResponse, error)
+	// Search returns the indexed chunks most relevant to query
+	Search(ctx context.Context, query string, limit int, scoreThreshold float64) (*SearchResponse, error)
+	// ListFiles lists indexed files, optionally filtered by prefix
+	ListFiles(ctx context.Context, prefix string) (*ListFilesResponse, error)
+	// DeleteFile removes a file from the index
+	DeleteFile(ctx context.Context, fileName string) (*DeleteResponse, error)
+	// DownloadFile saves an indexed file to destPath, resuming a partial
+	// download and replacing an existing file only if overwrite is set
+	DownloadFile(ctx context.Context, fileName, destPath string, overwrite bool) error
+	// Download writes an indexed file to w
+	Download(ctx context.Context, fileName string, w io.Writer) error
+	// GetJobStatus returns the status of an indexing job
+	GetJobStatus(ctx context.Context, jobID string) (*JobStatusResponse, error)
+	// WaitForJob polls a job until it finishes or timeout passes
+	WaitForJob(ctx context.Context, jobID string, interval, timeout time.Duration) (*JobStatusResponse, error)
+}
+
+var _ Service = (*Client)(nil)
@@ -0,0 +1,53 @@
+package api
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"os"
+
+	"github.com/ThiagoAVicente/sfs-cli/internal/config"
+)
+
+// InsecureWarning is shown whenever tls_insecure disables certificate checks
+const InsecureWarning = "WARNING: tls_insecure is enabled, so the API server's TLS certificate is NOT verified. " +
+	"Anyone on the network path can impersonate the server and read your API key and files."
+
+// newTLSConfig builds the TLS settings for connecting to the API: a custom CA
+// bundle, a client certificate for mutual TLS, and whether to verify the
+// server at all. Servers with self-signed certificates, local ones included,
+// need their certificate in the CA bundle or tls_insecure.
+func newTLSConfig(cfg *config.Config) (*tls.Config, error) {
+	tlsConfig := &tls.Config{MinVersion: tls.VersionTLS12}
+
+	if cfg.TLSCAFile != "" {
+		pem, err := os.ReadFile(config.ExpandHome(cfg.TLSCAFile))
+		if err != nil {
+			return nil, fmt.Errorf("failed to read CA bundle: %w", err)
+		}
+
+		pool, err := x509.SystemCertPool()
+		if err != nil {
+			pool = x509.NewCertPool()
+		}
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificates found in CA bundle %s", cfg.TLSCAFile)
+		}
+		tlsConfig.RootCAs = pool
+	}
+
+	if cfg.TLSCertFile != "" || cfg.TLSKeyFile != "" {
+		if cfg.TLSCertFile == "" || cfg.TLSKeyFile == "" {
+			return nil, fmt.Errorf("tls_cert_file and tls_key_file must be set together")
+		}
+
+		cert, err := tls.LoadX509KeyPair(config.ExpandHome(cfg.TLSCertFile), config.ExpandHome(cfg.TLSKeyFile))
+		if err != nil {
+			return nil, fmt.Errorf("failed to load client certificate: %w", err)
+		}
+		tlsConfig.Certificates = []tls.Certificate{cert}
+	}
+
+	tlsConfig.InsecureSkipVerify = cfg.TLSInsecure
+	return tlsConfig, nil
+}
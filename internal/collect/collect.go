@@ -0,0 +1,238 @@
+package collect
+
+import (
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/ThiagoAVicente/sfs-cli/internal/ignore"
+)
+
+// Options filters the files gathered by Collect
+type Options struct {
+	// Include keeps only files with one of these extensions, if set
+	Include []string
+	// Exclude drops files with any of these extensions
+	Exclude []string
+	// MaxSize drops files larger than this many bytes, if positive
+	MaxSize int64
+	// Ignore holds global ignore patterns applied to every directory
+	Ignore []string
+}
+
+// Skipped is a file that was found but filtered out
+type Skipped struct {
+	Path   string
+	Reason string
+}
+
+// File is a file selected for processing
+type File struct {
+	Path string
+	Size int64
+}
+
+// Result is the outcome of Collect
+type Result struct {
+	Files   []File
+	Skipped []Skipped
+}
+
+// TotalSize returns the combined size of the selected files
+func (r *Result) TotalSize() int64 {
+	var total int64
+	for _, file := range r.Files {
+		total += file.Size
+	}
+	return total
+}
+
+// Collect expands files, directories and glob patterns into the list of
+// regular files to process. Directories are walked recursively and honour
+// .sfsignore files and the global ignore patterns. Files named explicitly are
+// only subject to the extension and size filters.
+func Collect(args []string, opts Options) (*Result, error) {
+	c := &collector{opts: opts, result: &Result{}, seen: make(map[string]bool)}
+
+	for _, arg := range args {
+		paths, err := expand(arg)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, path := range paths {
+			absPath, err := filepath.Abs(path)
+			if err != nil {
+				return nil, fmt.Errorf("failed to get absolute path: %w", err)
+			}
+
+			info, err := os.Stat(absPath)
+			if err != nil {
+				return nil, fmt.Errorf("failed to access %s: %w", path, err)
+			}
+
+			if info.IsDir() {
+				c.walk(absPath)
+			} else {
+				c.add(absPath, info)
+			}
+		}
+	}
+
+	return c.result, nil
+}
+
+// expand returns the paths matching arg if it is a glob pattern, or arg itself
+func expand(arg string) ([]string, error) {
+	if !strings.ContainsAny(arg, "*?[") {
+		return []string{arg}, nil
+	}
+
+	matches, err := filepath.Glob(arg)
+	if err != nil {
+		return nil, fmt.Errorf("invalid pattern %s: %w", arg, err)
+	}
+	if len(matches) == 0 {
+		return nil, fmt.Errorf("no files match %s", arg)
+	}
+	return matches, nil
+}
+
+// collector accumulates the files found across all arguments
+type collector struct {
+	opts   Options
+	result *Result
+	seen   map[string]bool
+}
+
+// add keeps a file or records why it was filtered out
+func (c *collector) add(path string, info fs.FileInfo) {
+	if c.seen[path] {
+		return
+	}
+	c.seen[path] = true
+
+	if reason := c.opts.reject(path, info); reason != "" {
+		c.skip(path, reason)
+		return
+	}
+	c.result.Files = append(c.result.Files, File{Path: path, Size: info.Size()})
+}
+
+// skip records a file that won't be processed
+func (c *collector) skip(path, reason string) {
+	c.result.Skipped = append(c.result.Skipped, Skipped{Path: path, Reason: reason})
+}
+
+// walk adds every non-ignored regular file under root. Entries that can't
+// be read are skipped rather than aborting the walk.
+func (c *collector) walk(root string) {
+	matcher := ignore.New([]string{root}, c.opts.Ignore)
+
+	filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			c.skip(path, err.Error())
+			return nil
+		}
+		if matcher.Ignored(path, d.IsDir()) {
+			if d.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if d.IsDir() || !d.Type().IsRegular() || d.Name() == ignore.FileName {
+			return nil
+		}
+
+		info, err := d.Info()
+		if err != nil {
+			c.skip(path, err.Error())
+			return nil
+		}
+		c.add(path, info)
+		return nil
+	})
+}
+
+// reject returns why a file is filtered out, or "" if it should be kept
+func (o Options) reject(path string, info fs.FileInfo) string {
+	if !info.Mode().IsRegular() {
+		return "not a regular file"
+	}
+
+	ext := strings.ToLower(filepath.Ext(path))
+	if len(o.Include) > 0 && !slices.Contains(normalize(o.Include), ext) {
+		return "extension not included"
+	}
+	if slices.Contains(normalize(o.Exclude), ext) {
+		return "extension excluded"
+	}
+	if o.MaxSize > 0 && info.Size() > o.MaxSize {
+		return fmt.Sprintf("larger than %s", FormatSize(o.MaxSize))
+	}
+	return ""
+}
+
+// normalize lowercases extensions and adds the leading dot where missing
+func normalize(exts []string) []string {
+	normalized := make([]string, 0, len(exts))
+	for _, ext := range exts {
+		ext = strings.ToLower(strings.TrimSpace(ext))
+		if ext == "" {
+			continue
+		}
+		if !strings.HasPrefix(ext, ".") {
+			ext = "." + ext
+		}
+		normalized = append(normalized, ext)
+	}
+	return normalized
+}
+
+var sizeUnits = []struct {
+	suffix string
+	bytes  int64
+}{
+	{"GB", 1 << 30},
+	{"MB", 1 << 20},
+	{"KB", 1 << 10},
+	{"G", 1 << 30},
+	{"M", 1 << 20},
+	{"K", 1 << 10},
+	{"B", 1},
+}
+
+// ParseSize parses a size such as "512", "100K", "10MB" or "1G", using
+// binary units
+func ParseSize(s string) (int64, error) {
+	value := strings.ToUpper(strings.TrimSpace(s))
+	multiplier := int64(1)
+	for _, unit := range sizeUnits {
+		if strings.HasSuffix(value, unit.suffix) {
+			value = strings.TrimSpace(strings.TrimSuffix(value, unit.suffix))
+			multiplier = unit.bytes
+			break
+		}
+	}
+
+	n, err := strconv.ParseFloat(value, 64)
+	if err != nil || n < 0 {
+		return 0, fmt.Errorf("invalid size: %s", s)
+	}
+	return int64(n * float64(multiplier)), nil
+}
+
+// FormatSize formats a byte count using the largest fitting binary unit
+func FormatSize(n int64) string {
+	for _, unit := range sizeUnits[:3] {
+		if n >= unit.bytes {
+			value := strconv.FormatFloat(float64(n)/float64(unit.bytes), 'f', 1, 64)
+			return strings.TrimSuffix(value, ".0") + unit.suffix
+		}
+	}
+	return fmt.Sprintf("%dB", n)
+}
@@ -0,0 +1,191 @@
+package collect
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+)
+
+func writeFiles(t *testing.T, root string, files map[string]string) {
+	t.Helper()
+
+	for name, content := range files {
+		path := filepath.Join(root, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatalf("Failed to create directory: %v", err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatalf("Failed to write file: %v", err)
+		}
+	}
+}
+
+func relative(t *testing.T, root string, files []File) []string {
+	t.Helper()
+
+	var rel []string
+	for _, file := range files {
+		r, err := filepath.Rel(root, file.Path)
+		if err != nil {
+			t.Fatalf("Failed to make path relative: %v", err)
+		}
+		rel = append(rel, filepath.ToSlash(r))
+	}
+	slices.Sort(rel)
+	return rel
+}
+
+func TestCollect(t *testing.T) {
+	root := t.TempDir()
+	writeFiles(t, root, map[string]string{
+		"a.txt":               "a",
+		"b.md":                "b",
+		"big.txt":             "0123456789",
+		"sub/c.TXT":           "c",
+		"sub/d.log":           "d",
+		"sub/.sfsignore":      "*.log\n",
+		"node_modules/x.txt":  "x",
+		"build/output.bin":    "o",
+		"notes/one.md":        "1",
+		"notes/deeper/two.md": "2",
+	})
+
+	tests := []struct {
+		name     string
+		args     []string
+		opts     Options
+		expected []string
+		skipped  int
+	}{
+		{
+			name: "directory recursively with ignores",
+			args: []string{root},
+			opts: Options{Ignore: []string{"node_modules/", "build/"}},
+			expected: []string{
+				"a.txt", "b.md", "big.txt", "notes/deeper/two.md", "notes/one.md", "sub/c.TXT",
+			},
+		},
+		{
+			name:     "include extensions",
+			args:     []string{root},
+			opts:     Options{Include: []string{"txt"}, Ignore: []string{"node_modules/"}},
+			expected: []string{"a.txt", "big.txt", "sub/c.TXT"},
+			skipped:  4,
+		},
+		{
+			name:     "exclude extensions",
+			args:     []string{filepath.Join(root, "notes"), filepath.Join(root, "a.txt")},
+			opts:     Options{Exclude: []string{".MD"}},
+			expected: []string{"a.txt"},
+			skipped:  2,
+		},
+		{
+			name:     "max size",
+			args:     []string{filepath.Join(root, "a.txt"), filepath.Join(root, "big.txt")},
+			opts:     Options{MaxSize: 5},
+			expected: []string{"a.txt"},
+			skipped:  1,
+		},
+		{
+			name:     "glob pattern",
+			args:     []string{filepath.Join(root, "*.md"), filepath.Join(root, "notes", "*")},
+			expected: []string{"b.md", "notes/deeper/two.md", "notes/one.md"},
+		},
+		{
+			name:     "explicit file bypasses ignore files",
+			args:     []string{filepath.Join(root, "sub", "d.log")},
+			expected: []string{"sub/d.log"},
+		},
+		{
+			name:     "duplicates are collected once",
+			args:     []string{filepath.Join(root, "a.txt"), filepath.Join(root, "*.txt")},
+			expected: []string{"a.txt", "big.txt"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result, err := Collect(tt.args, tt.opts)
+			if err != nil {
+				t.Fatalf("Failed to collect files: %v", err)
+			}
+
+			got := relative(t, root, result.Files)
+			if !slices.Equal(got, tt.expected) {
+				t.Errorf("Expected %v, got %v", tt.expected, got)
+			}
+			if len(result.Skipped) != tt.skipped {
+				t.Errorf("Expected %d skipped files, got %v", tt.skipped, result.Skipped)
+			}
+		})
+	}
+}
+
+func TestResultTotalSize(t *testing.T) {
+	result := &Result{Files: []File{{Path: "a", Size: 3}, {Path: "b", Size: 4}}}
+	if total := result.TotalSize(); total != 7 {
+		t.Errorf("Expected total size 7, got %d", total)
+	}
+}
+
+func TestCollectErrors(t *testing.T) {
+	root := t.TempDir()
+
+	if _, err := Collect([]string{filepath.Join(root, "missing.txt")}, Options{}); err == nil {
+		t.Error("Expected error for missing file")
+	}
+	if _, err := Collect([]string{filepath.Join(root, "*.nothing")}, Options{}); err == nil {
+		t.Error("Expected error for pattern without matches")
+	}
+}
+
+func TestParseSize(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected int64
+		wantErr  bool
+	}{
+		{input: "512", expected: 512},
+		{input: "100K", expected: 100 << 10},
+		{input: "10MB", expected: 10 << 20},
+		{input: "1.5mb", expected: 3 << 19},
+		{input: "2G", expected: 2 << 30},
+		{input: "7B", expected: 7},
+		{input: "lots", wantErr: true},
+		{input: "-1K", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			got, err := ParseSize(tt.input)
+			if tt.wantErr {
+				if err == nil {
+					t.Errorf("Expected error, got %d", got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if got != tt.expected {
+				t.Errorf("Expected %d, got %d", tt.expected, got)
+			}
+		})
+	}
+}
+
+func TestFormatSize(t *testing.T) {
+	tests := map[int64]string{
+		10:       "10B",
+		1 << 10:  "1KB",
+		3 << 19:  "1.5MB",
+		10 << 30: "10GB",
+	}
+
+	for input, expected := range tests {
+		if got := FormatSize(input); got != expected {
+			t.Errorf("FormatSize(%d): expected %s, got %s", input, expected, got)
+		}
+	}
+}
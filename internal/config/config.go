@@ -1,10 +1,16 @@
 package config
 
 import (
+	"errors"
 	"fmt"
+	"io/fs"
 	"os"
 	"path/filepath"
+	"slices"
+	"strings"
+	"time"
 
+	"github.com/spf13/cast"
 	"github.com/spf13/viper"
 )
 
@@ -12,13 +18,54 @@ const (
 	ConfigFileName = "config"
 	ConfigFileType = "yaml"
 	ConfigDirName  = ".config/sfs"
+
+	// DefaultUploadConcurrency is the number of parallel uploads in bulk operations
+	DefaultUploadConcurrency = 4
+
+	// DefaultConnectTimeout bounds establishing a connection to the API
+	DefaultConnectTimeout = 10 * time.Second
+	// DefaultRequestTimeout bounds a request, or waiting for the API to respond
+	// to an upload or download
+	DefaultRequestTimeout = 60 * time.Second
+
+	// DefaultMaxRetries is how many times idempotent requests are retried
+	// after transient failures
+	DefaultMaxRetries = 3
+	// DefaultRetryDelay is the backoff before the first retry, doubled for
+	// each one after it
+	DefaultRetryDelay = 500 * time.Millisecond
+	// DefaultRetryMaxDelay caps the backoff between retries
+	DefaultRetryMaxDelay = 30 * time.Second
 )
 
 // Config holds the application configuration
 type Config struct {
-	APIURL         string   `mapstructure:"api_url"`
-	APIKey         string   `mapstructure:"api_key"`
-	WatchDirs      []string `mapstructure:"watch_dirs"`
+	APIURL        string `mapstructure:"api_url"`
+	APIKey        string `mapstructure:"api_key"`
+	APIKeyCommand string `mapstructure:"api_key_command"`
+	APIKeyFile    string `mapstructure:"api_key_file"`
+
+	SecretsPassphraseFile string   `mapstructure:"secrets_passphrase_file"`
+	WatchDirs             []string `mapstructure:"watch_dirs"`
+	Ignore                []string `mapstructure:"ignore"`
+
+	UploadConcurrency int     `mapstructure:"upload_concurrency"`
+	UploadRateLimit   float64 `mapstructure:"upload_rate_limit"`
+
+	ConnectTimeout time.Duration `mapstructure:"connect_timeout"`
+	RequestTimeout time.Duration `mapstructure:"request_timeout"`
+
+	MaxRetries    int           `mapstructure:"max_retries"`
+	RetryDelay    time.Duration `mapstructure:"retry_delay"`
+	RetryMaxDelay time.Duration `mapstructure:"retry_max_delay"`
+
+	TLSCAFile   string `mapstructure:"tls_ca_file"`
+	TLSCertFile string `mapstructure:"tls_cert_file"`
+	TLSKeyFile  string `mapstructure:"tls_key_file"`
+	TLSInsecure bool   `mapstructure:"tls_insecure"`
+
+	// Profile is the name of the profile these settings belong to
+	Profile string `mapstructure:"-"`
 }
 
 // InitConfig initializes viper configuration
@@ -30,20 +77,40 @@ func InitConfig() error {
 
 	configDir := filepath.Join(home, ConfigDirName)
 
-	// Set config file location
-	viper.AddConfigPath(configDir)
-	viper.SetConfigName(ConfigFileName)
+	// Set config file location, unless --config or SFS_CONFIG points elsewhere
+	if path := configFile(); path != "" {
+		viper.SetConfigFile(path)
+	} else {
+		viper.AddConfigPath(configDir)
+		viper.SetConfigName(ConfigFileName)
+	}
 	viper.SetConfigType(ConfigFileType)
 
 	// Set defaults
 	viper.SetDefault("api_url", "https://localhost")
 	viper.SetDefault("api_key", "")
+	viper.SetDefault("api_key_command", "")
+	viper.SetDefault("api_key_file", "")
+	viper.SetDefault("secrets_passphrase_file", "")
 	viper.SetDefault("watch_dirs", []string{})
+	viper.SetDefault("ignore", []string{})
+	viper.SetDefault("upload_concurrency", DefaultUploadConcurrency)
+	viper.SetDefault("upload_rate_limit", 0)
+	// Durations are kept as strings so the saved config stays readable
+	viper.SetDefault("connect_timeout", DefaultConnectTimeout.String())
+	viper.SetDefault("request_timeout", DefaultRequestTimeout.String())
+	viper.SetDefault("max_retries", DefaultMaxRetries)
+	viper.SetDefault("retry_delay", DefaultRetryDelay.String())
+	viper.SetDefault("retry_max_delay", DefaultRetryMaxDelay.String())
+	viper.SetDefault("tls_ca_file", "")
+	viper.SetDefault("tls_cert_file", "")
+	viper.SetDefault("tls_key_file", "")
+	viper.SetDefault("tls_insecure", false)
 
 	// Read config file
 	if err := viper.ReadInConfig(); err != nil {
 		// Config file not found is okay, we'll create it on first set
-		if _, ok := err.(viper.ConfigFileNotFoundError); !ok {
+		if _, ok := err.(viper.ConfigFileNotFoundError); !ok && !errors.Is(err, fs.ErrNotExist) {
 			return fmt.Errorf("failed to read config: %w", err)
 		}
 	}
@@ -51,43 +118,159 @@ func InitConfig() error {
 	return nil
 }
 
-// Get returns the current configuration
+// Get returns the configuration of the active profile
 func Get() (*Config, error) {
-	var cfg Config
-	if err := viper.Unmarshal(&cfg); err != nil {
-		return nil, fmt.Errorf("failed to unmarshal config: %w", err)
-	}
-	return &cfg, nil
+	return GetProfile(ActiveProfile())
 }
 
-// Set sets a configuration value
+// Set sets a configuration value, in the active profile if the key is one a
+// profile can override. Values of known keys are checked and saved with
+// their proper type; lists are changed with AddValues and RemoveValues.
 func Set(key, value string) error {
-	viper.Set(key, value)
-	return Save()
+	if isListKey(key) {
+		return fmt.Errorf("%s is a list. Run: sfs config add %s <value> or sfs config remove %s <value>", key, key, key)
+	}
+	parsed, err := parseValue(key, value)
+	if err != nil {
+		return err
+	}
+
+	key, err = profileKey(key)
+	if err != nil {
+		return err
+	}
+	return save(key, parsed)
+}
+
+// Unset removes a configuration value from the active profile, so it falls
+// back to the top-level value, or from the top level, so it falls back to
+// the built-in default
+func Unset(key string) error {
+	key, err := profileKey(key)
+	if err != nil {
+		return err
+	}
+
+	file, err := fileConfig()
+	if err != nil {
+		return err
+	}
+	settings := file.AllSettings()
+	parts := strings.Split(key, ".")
+	parent := settings
+	for _, part := range parts[:len(parts)-1] {
+		if parent, _ = parent[part].(map[string]interface{}); parent == nil {
+			return nil
+		}
+	}
+	delete(parent, parts[len(parts)-1])
+
+	// A profile without settings wouldn't survive being saved
+	if len(parent) == 0 && len(parts) == 3 {
+		return fmt.Errorf("%s is the only setting of profile %s. Run: sfs config profile remove %s", parts[2], parts[1], parts[1])
+	}
+	return replace(settings)
+}
+
+// AddValues appends values to a list key of the active profile, skipping
+// those already present, and returns the ones added
+func AddValues(key string, values ...string) ([]string, error) {
+	return updateList(key, values, true)
+}
+
+// RemoveValues removes values from a list key of the active profile and
+// returns the ones that were present
+func RemoveValues(key string, values ...string) ([]string, error) {
+	return updateList(key, values, false)
 }
 
-// GetValue gets a single configuration value
+// updateList adds values to or removes them from the saved list at key, and
+// saves the list if anything changed
+func updateList(key string, values []string, add bool) ([]string, error) {
+	if !isListKey(key) {
+		return nil, fmt.Errorf("%s is not a list", key)
+	}
+	stored, err := profileKey(key)
+	if err != nil {
+		return nil, err
+	}
+
+	list := slices.Clone(viper.GetStringSlice(stored))
+	var changed []string
+	for _, value := range values {
+		if key == "watch_dirs" {
+			// Directories are saved as absolute paths, like sfs watch does
+			if value, err = filepath.Abs(ExpandHome(value)); err != nil {
+				return nil, fmt.Errorf("failed to get absolute path: %w", err)
+			}
+		}
+
+		present := slices.Contains(list, value)
+		switch {
+		case add && !present:
+			if err := validate(key, value); err != nil {
+				return nil, err
+			}
+			list = append(list, value)
+		case !add && present:
+			list = slices.DeleteFunc(list, func(item string) bool { return item == value })
+		default:
+			continue
+		}
+		changed = append(changed, value)
+	}
+
+	if len(changed) == 0 {
+		return nil, nil
+	}
+	return changed, save(stored, list)
+}
+
+// GetValue gets the effective value of a single configuration key, as seen
+// by the active profile and including flag and environment overrides
 func GetValue(key string) string {
-	return viper.GetString(key)
+	return getString(key)
 }
 
-// Save saves the current configuration to disk
-func Save() error {
-	home, err := os.UserHomeDir()
+// save sets key to value in the config file and reloads it. Only what the
+// file already holds is written alongside it, so defaults stay defaults and
+// keep showing up as such.
+func save(key string, value interface{}) error {
+	file, err := fileConfig()
 	if err != nil {
-		return fmt.Errorf("failed to get home directory: %w", err)
+		return err
 	}
+	file.Set(key, value)
+	return replace(file.AllSettings())
+}
 
-	configDir := filepath.Join(home, ConfigDirName)
-	configPath := filepath.Join(configDir, ConfigFileName+"."+ConfigFileType)
+// fileConfig returns the settings in the config file, without defaults or
+// overrides
+func fileConfig() (*viper.Viper, error) {
+	configPath, err := GetConfigPath()
+	if err != nil {
+		return nil, err
+	}
+
+	file := viper.New()
+	file.SetConfigFile(configPath)
+	file.SetConfigType(ConfigFileType)
+	if err := file.ReadInConfig(); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return nil, fmt.Errorf("failed to read config: %w", err)
+	}
+	return file, nil
+}
 
+// writeConfig writes the settings of v to configPath, readable only by the
+// owner
+func writeConfig(v *viper.Viper, configPath string) error {
 	// Create config directory if it doesn't exist
-	if err := os.MkdirAll(configDir, 0755); err != nil {
+	if err := os.MkdirAll(filepath.Dir(configPath), 0755); err != nil {
 		return fmt.Errorf("failed to create config directory: %w", err)
 	}
 
 	// Use WriteConfigAs which handles both create and update
-	if err := viper.WriteConfigAs(configPath); err != nil {
+	if err := v.WriteConfigAs(configPath); err != nil {
 		return fmt.Errorf("failed to write config: %w", err)
 	}
 
@@ -104,9 +287,36 @@ func GetAll() map[string]interface{} {
 	return viper.AllSettings()
 }
 
-// GetWatchDirs returns the list of directories to watch
+// GetWatchDirs returns the directories watched for the active profile
 func GetWatchDirs() []string {
-	return viper.GetStringSlice("watch_dirs")
+	if _, err := profileKey("watch_dirs"); err != nil {
+		return nil
+	}
+	return getStringSlice("watch_dirs")
+}
+
+// GetIgnorePatterns returns the global ignore patterns, in .sfsignore syntax
+func GetIgnorePatterns() []string {
+	return getStringSlice("ignore")
+}
+
+// GetUploadConcurrency returns how many uploads bulk operations run at once
+func GetUploadConcurrency() int {
+	value, _ := lookup("upload_concurrency")
+	return max(cast.ToInt(value), 1)
+}
+
+// GetUploadRateLimit returns the maximum number of requests per second bulk
+// operations may start, or 0 for no limit
+func GetUploadRateLimit() float64 {
+	value, _ := lookup("upload_rate_limit")
+	return max(cast.ToFloat64(value), 0)
+}
+
+// GetTLSInsecure reports whether TLS certificate verification is disabled
+func GetTLSInsecure() bool {
+	value, _ := lookup("tls_insecure")
+	return cast.ToBool(value)
 }
 
 // GetConfigDir returns the configuration directory path
@@ -118,8 +328,12 @@ func GetConfigDir() (string, error) {
 	return filepath.Join(home, ConfigDirName), nil
 }
 
-// GetConfigPath returns the full config file path
+// GetConfigPath returns the full config file path, which --config or
+// SFS_CONFIG can override
 func GetConfigPath() (string, error) {
+	if path := configFile(); path != "" {
+		return path, nil
+	}
 	configDir, err := GetConfigDir()
 	if err != nil {
 		return "", err
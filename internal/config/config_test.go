@@ -4,6 +4,8 @@ import (
 	"os"
 	"path/filepath"
 	"testing"
+
+	"github.com/spf13/viper"
 )
 
 func TestSetAndGet(t *testing.T) {
@@ -64,6 +66,15 @@ func TestGetDefault(t *testing.T) {
 	if cfg.APIKey != "" {
 		t.Errorf("Expected empty API key, got '%s'", cfg.APIKey)
 	}
+
+	if cfg.UploadConcurrency != DefaultUploadConcurrency {
+		t.Errorf("Expected default upload concurrency %d, got %d", DefaultUploadConcurrency, cfg.UploadConcurrency)
+	}
+
+	if cfg.ConnectTimeout != DefaultConnectTimeout || cfg.RequestTimeout != DefaultRequestTimeout {
+		t.Errorf("Expected default timeouts %s/%s, got %s/%s",
+			DefaultConnectTimeout, DefaultRequestTimeout, cfg.ConnectTimeout, cfg.RequestTimeout)
+	}
 }
 
 func TestGetAll(t *testing.T) {
@@ -124,3 +135,359 @@ func TestConfigFilePermissions(t *testing.T) {
 		t.Errorf("Expected file permissions 0600, got %04o", mode)
 	}
 }
+
+func TestProfiles(t *testing.T) {
+	viper.Reset()
+	tmpDir := t.TempDir()
+	home := os.Getenv("HOME")
+	os.Setenv("HOME", tmpDir)
+	defer os.Setenv("HOME", home)
+	defer SelectProfile("")
+
+	if err := InitConfig(); err != nil {
+		t.Fatalf("Failed to init config: %v", err)
+	}
+	Set("api_url", "https://prod.example.com")
+	Set("api_key", "prod-key")
+	Set("request_timeout", "30s")
+
+	if err := AddProfile("staging", "https://staging.example.com"); err != nil {
+		t.Fatalf("Failed to add profile: %v", err)
+	}
+	if err := AddProfile("staging", "https://other.example.com"); err == nil {
+		t.Error("Expected adding an existing profile to fail")
+	}
+	if err := AddProfile("Bad.Name", "https://other.example.com"); err == nil {
+		t.Error("Expected an invalid profile name to fail")
+	}
+
+	// Settings go to the selected profile, which falls back to the top level
+	SelectProfile("staging")
+	Set("api_key", "staging-key")
+	SetWatchDirs([]string{"/srv/staging"})
+
+	cfg, err := Get()
+	if err != nil {
+		t.Fatalf("Failed to get config: %v", err)
+	}
+	if cfg.Profile != "staging" || cfg.APIURL != "https://staging.example.com" || cfg.APIKey != "staging-key" {
+		t.Errorf("Expected staging settings, got %+v", cfg)
+	}
+	if cfg.RequestTimeout.String() != "30s" {
+		t.Errorf("Expected the top-level request timeout, got %s", cfg.RequestTimeout)
+	}
+
+	SelectProfile("")
+	if cfg, _ := Get(); cfg.APIKey != "prod-key" || cfg.Profile != DefaultProfile {
+		t.Errorf("Expected default settings, got %+v", cfg)
+	}
+
+	// SFS_PROFILE applies unless a profile is selected explicitly
+	t.Setenv(ProfileEnv, "staging")
+	if active := ActiveProfile(); active != "staging" {
+		t.Errorf("Expected SFS_PROFILE to select staging, got %s", active)
+	}
+	SelectProfile(DefaultProfile)
+	if active := ActiveProfile(); active != DefaultProfile {
+		t.Errorf("Expected the selected profile to win, got %s", active)
+	}
+	os.Unsetenv(ProfileEnv)
+	SelectProfile("")
+
+	SetWatchDirs([]string{"/srv/prod"})
+	dirs := GetAllWatchDirs()
+	if len(dirs) != 2 || dirs[0] != (WatchDir{"/srv/prod", DefaultProfile}) || dirs[1] != (WatchDir{"/srv/staging", "staging"}) {
+		t.Errorf("Expected watch dirs of both profiles, got %+v", dirs)
+	}
+
+	if err := UseProfile("staging"); err != nil {
+		t.Fatalf("Failed to use profile: %v", err)
+	}
+	if active := ActiveProfile(); active != "staging" {
+		t.Errorf("Expected staging to be in use, got %s", active)
+	}
+
+	if err := RemoveProfile("staging"); err != nil {
+		t.Fatalf("Failed to remove profile: %v", err)
+	}
+	if len(Profiles()) != 0 || ActiveProfile() != DefaultProfile {
+		t.Errorf("Expected only the default profile to remain, got %v (active %s)", Profiles(), ActiveProfile())
+	}
+	if _, err := GetProfile("staging"); err == nil {
+		t.Error("Expected a removed profile to be unknown")
+	}
+
+	// The removal is saved
+	viper.Reset()
+	InitConfig()
+	if len(Profiles()) != 0 || GetValue("api_key") != "prod-key" {
+		t.Errorf("Expected the saved config to keep only the default profile, got %v", Profiles())
+	}
+}
+
+func TestOverrides(t *testing.T) {
+	viper.Reset()
+	tmpDir := t.TempDir()
+	home := os.Getenv("HOME")
+	os.Setenv("HOME", tmpDir)
+	defer os.Setenv("HOME", home)
+	defer SelectProfile("")
+	defer delete(flagValues, "api_key")
+
+	if err := InitConfig(); err != nil {
+		t.Fatalf("Failed to init config: %v", err)
+	}
+	Set("api_url", "https://prod.example.com")
+	Set("api_key", "prod-key")
+	if err := AddProfile("staging", "https://staging.example.com"); err != nil {
+		t.Fatalf("Failed to add profile: %v", err)
+	}
+	SelectProfile("staging")
+
+	t.Setenv(EnvName("api_key"), "env-key")
+	t.Setenv(EnvName("watch_dirs"), "/srv/a, /srv/b")
+	t.Setenv(EnvName("max_retries"), "7")
+	Override("api_key", "flag-key")
+
+	tests := []struct {
+		key    string
+		value  string
+		origin string
+	}{
+		{"api_key", "flag-key", "flag --api-key"},
+		{"api_url", "https://staging.example.com", "profile staging"},
+		{"max_retries", "7", "env SFS_MAX_RETRIES"},
+		{"watch_dirs", "/srv/a, /srv/b", "env SFS_WATCH_DIRS"},
+		{"profile", "staging", "flag --profile"},
+		{"tls_ca_file", "", OriginDefault},
+	}
+	for _, tt := range tests {
+		value, origin := lookup(tt.key)
+		if GetValue(tt.key) != tt.value || origin != tt.origin {
+			t.Errorf("%s: expected %q from %s, got %v from %s", tt.key, tt.value, tt.origin, value, origin)
+		}
+	}
+
+	cfg, err := Get()
+	if err != nil {
+		t.Fatalf("Failed to get config: %v", err)
+	}
+	if cfg.APIKey != "flag-key" || cfg.MaxRetries != 7 || len(cfg.WatchDirs) != 2 || cfg.WatchDirs[1] != "/srv/b" {
+		t.Errorf("Expected overrides to apply, got %+v", cfg)
+	}
+	if dirs := GetAllWatchDirs(); len(dirs) != 2 || dirs[0] != (WatchDir{"/srv/a", "staging"}) {
+		t.Errorf("Expected the overridden watch dirs, got %+v", dirs)
+	}
+
+	// Overrides only apply to the active profile and are never saved
+	if cfg, _ := GetProfile(DefaultProfile); cfg.APIKey != "prod-key" {
+		t.Errorf("Expected the default profile to keep its key, got %s", cfg.APIKey)
+	}
+	Set("connect_timeout", "5s")
+	viper.Reset()
+	InitConfig()
+	if value := viper.GetString("api_key"); value != "prod-key" {
+		t.Errorf("Expected the saved key to be unchanged, got %s", value)
+	}
+}
+
+func TestSaveOnlyWritesSetKeys(t *testing.T) {
+	viper.Reset()
+	home := os.Getenv("HOME")
+	os.Setenv("HOME", t.TempDir())
+	defer os.Setenv("HOME", home)
+
+	if err := InitConfig(); err != nil {
+		t.Fatalf("Failed to init config: %v", err)
+	}
+	if err := Set("api_url", "https://prod.example.com"); err != nil {
+		t.Fatalf("Failed to set config: %v", err)
+	}
+
+	for _, setting := range Settings() {
+		want := OriginDefault
+		if setting.Key == "api_url" {
+			want = OriginFile
+		}
+		if setting.Origin != want {
+			t.Errorf("%s: expected origin %s, got %s", setting.Key, want, setting.Origin)
+		}
+	}
+
+	configPath, _ := GetConfigPath()
+	data, err := os.ReadFile(configPath)
+	if err != nil {
+		t.Fatalf("Failed to read config file: %v", err)
+	}
+	if string(data) != "api_url: https://prod.example.com\n" {
+		t.Errorf("Expected only api_url in the config file, got %q", data)
+	}
+}
+
+func TestConfigFileOverride(t *testing.T) {
+	viper.Reset()
+	home := os.Getenv("HOME")
+	os.Setenv("HOME", t.TempDir())
+	defer os.Setenv("HOME", home)
+	defer SetConfigFile("")
+
+	path := filepath.Join(t.TempDir(), "sfs.yaml")
+	t.Setenv(ConfigEnv, path)
+	if err := InitConfig(); err != nil {
+		t.Fatalf("Failed to init config: %v", err)
+	}
+	if configPath, _ := GetConfigPath(); configPath != path {
+		t.Errorf("Expected %s to be used, got %s", path, configPath)
+	}
+	Set("api_url", "https://alt.example.com")
+	if _, err := os.Stat(path); err != nil {
+		t.Errorf("Expected %s to be written: %v", path, err)
+	}
+
+	// The flag wins over SFS_CONFIG
+	other := filepath.Join(t.TempDir(), "other.yaml")
+	SetConfigFile(other)
+	viper.Reset()
+	InitConfig()
+	if configPath, _ := GetConfigPath(); configPath != other || GetValue("api_url") != "https://localhost" {
+		t.Errorf("Expected %s to be used, got %s with api_url %s", other, configPath, GetValue("api_url"))
+	}
+}
+
+func TestValidate(t *testing.T) {
+	dir := t.TempDir()
+	file := filepath.Join(dir, "ca.pem")
+	os.WriteFile(file, []byte("cert"), 0600)
+
+	tests := []struct {
+		key   string
+		value string
+		valid bool
+	}{
+		{"api_url", "https://api.example.com", true},
+		{"api_url", "http://localhost:8000", true},
+		{"api_url", "api.example.com", false},
+		{"api_url", "https://", false},
+		{"watch_dirs", dir, true},
+		{"watch_dirs", filepath.Join(dir, "missing"), false},
+		{"watch_dirs", file, false},
+		{"upload_concurrency", "8", true},
+		{"upload_concurrency", "0", false},
+		{"upload_concurrency", "many", false},
+		{"upload_rate_limit", "2.5", true},
+		{"upload_rate_limit", "-1", false},
+		{"max_retries", "0", true},
+		{"max_retries", "21", false},
+		{"connect_timeout", "5s", true},
+		{"connect_timeout", "5", false},
+		{"retry_delay", "0s", false},
+		{"tls_insecure", "false", true},
+		{"tls_insecure", "maybe", false},
+		{"tls_ca_file", file, true},
+		{"tls_ca_file", "", true},
+		{"tls_ca_file", dir, false},
+		{"api_key_file", filepath.Join(dir, "missing"), false},
+		{"unknown_key", "anything", true},
+	}
+	for _, tt := range tests {
+		if err := validate(tt.key, tt.value); (err == nil) != tt.valid {
+			t.Errorf("validate(%s, %q) = %v, expected valid %v", tt.key, tt.value, err, tt.valid)
+		}
+	}
+}
+
+func TestUnsetAndLists(t *testing.T) {
+	viper.Reset()
+	home := os.Getenv("HOME")
+	os.Setenv("HOME", t.TempDir())
+	defer os.Setenv("HOME", home)
+	defer SelectProfile("")
+
+	if err := InitConfig(); err != nil {
+		t.Fatalf("Failed to init config: %v", err)
+	}
+
+	// Values are saved with their type, and lists can't be overwritten
+	if err := Set("max_retries", "7"); err != nil {
+		t.Fatalf("Failed to set config: %v", err)
+	}
+	if value := viper.Get("max_retries"); value != 7 {
+		t.Errorf("Expected max_retries to be saved as a number, got %#v", value)
+	}
+	if err := Set("watch_dirs", "/tmp"); err == nil {
+		t.Error("Expected setting a list to a string to fail")
+	}
+	if err := Set("max_retries", "lots"); err == nil {
+		t.Error("Expected an invalid value to be rejected")
+	}
+
+	if err := Unset("max_retries"); err != nil {
+		t.Fatalf("Failed to unset config: %v", err)
+	}
+	if value := GetValue("max_retries"); value != "3" {
+		t.Errorf("Expected max_retries to fall back to the default, got %s", value)
+	}
+
+	// Unsetting a profile's value falls back to the top level
+	Set("api_url", "https://prod.example.com")
+	AddProfile("staging", "https://staging.example.com")
+	SelectProfile("staging")
+	if err := Unset("api_url"); err == nil {
+		t.Error("Expected unsetting the only setting of a profile to fail")
+	}
+	Set("max_retries", "5")
+	if err := Unset("api_url"); err != nil {
+		t.Fatalf("Failed to unset config: %v", err)
+	}
+	if value := GetValue("api_url"); value != "https://prod.example.com" {
+		t.Errorf("Expected the top-level api_url, got %s", value)
+	}
+
+	dir := t.TempDir()
+	added, err := AddValues("watch_dirs", dir, dir)
+	if err != nil || len(added) != 1 {
+		t.Fatalf("Expected one dir to be added, got %v, %v", added, err)
+	}
+	if _, err := AddValues("watch_dirs", filepath.Join(dir, "missing")); err == nil {
+		t.Error("Expected adding a missing directory to fail")
+	}
+	AddValues("ignore", "*.log", "node_modules/")
+	removed, err := RemoveValues("ignore", "*.log", "*.tmp")
+	if err != nil || len(removed) != 1 || removed[0] != "*.log" {
+		t.Errorf("Expected *.log to be removed, got %v, %v", removed, err)
+	}
+	if _, err := AddValues("api_url", "https://other.example.com"); err == nil {
+		t.Error("Expected adding to a non-list key to fail")
+	}
+
+	// The changes are saved, watch_dirs to the active profile
+	viper.Reset()
+	InitConfig()
+	if dirs := GetWatchDirs(); len(dirs) != 1 || dirs[0] != dir {
+		t.Errorf("Expected %s to be watched by staging, got %v", dir, dirs)
+	}
+	if patterns := GetIgnorePatterns(); len(patterns) != 1 || patterns[0] != "node_modules/" {
+		t.Errorf("Expected only node_modules/ to be ignored, got %v", patterns)
+	}
+}
+
+func TestProfileFor(t *testing.T) {
+	dirs := []WatchDir{
+		{Path: "/data", Profile: DefaultProfile},
+		{Path: "/data/team", Profile: "team"},
+	}
+
+	tests := map[string]string{
+		"/data/notes.txt":        DefaultProfile,
+		"/data/team":             "team",
+		"/data/team/sub/a.txt":   "team",
+		"/data/team_old/a.txt":   DefaultProfile,
+		"/elsewhere/a.txt":       DefaultProfile,
+		"/data/team/../other.md": DefaultProfile,
+	}
+	for path, want := range tests {
+		if got := ProfileFor(dirs, filepath.Clean(path)); got != want {
+			t.Errorf("ProfileFor(%s) = %s, expected %s", path, got, want)
+		}
+	}
+}
@@ -0,0 +1,187 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+
+	"github.com/spf13/cast"
+	"github.com/spf13/viper"
+)
+
+const (
+	// EnvPrefix starts the name of the environment variable for every key,
+	// e.g. SFS_API_URL for api_url
+	EnvPrefix = "SFS_"
+
+	// ConfigEnv is the environment variable holding an alternate config file
+	ConfigEnv = "SFS_CONFIG"
+)
+
+// Where an effective setting came from, from highest precedence to lowest
+const (
+	OriginFlag    = "flag"
+	OriginEnv     = "env"
+	OriginProfile = "profile"
+	OriginFile    = "config file"
+	OriginDefault = "default"
+)
+
+// profileSettingKey is the key holding the profile saved as the default
+const profileSettingKey = "profile"
+
+var (
+	// flagValues are the settings given as command-line flags
+	flagValues = make(map[string]string)
+
+	// configFileFlag is the config file given on the command line, if any
+	configFileFlag string
+)
+
+// Setting is the effective value of a configuration key
+type Setting struct {
+	Key    string
+	Value  interface{}
+	Origin string
+}
+
+// Override sets key for this process only, taking precedence over the
+// environment and the config file. The value is never saved.
+func Override(key, value string) {
+	flagValues[key] = value
+}
+
+// SetConfigFile makes InitConfig read and Save write path instead of the
+// default config file, taking precedence over SFS_CONFIG
+func SetConfigFile(path string) {
+	configFileFlag = path
+}
+
+// EnvName returns the environment variable that overrides key
+func EnvName(key string) string {
+	return EnvPrefix + strings.ToUpper(key)
+}
+
+// FlagName returns the name of the command-line flag that overrides key
+func FlagName(key string) string {
+	return strings.ReplaceAll(key, "_", "-")
+}
+
+// Keys returns every known configuration key, sorted
+func Keys() []string {
+	keys := []string{profileSettingKey}
+	configType := reflect.TypeOf(Config{})
+	for i := range configType.NumField() {
+		if key := configType.Field(i).Tag.Get("mapstructure"); key != "" && key != "-" {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// isListKey reports whether key holds a list of values
+func isListKey(key string) bool {
+	field, ok := fieldType(key)
+	return ok && field.Kind() == reflect.Slice
+}
+
+// Settings returns the effective value of every known key for the active
+// profile, along with where each one came from
+func Settings() []Setting {
+	var settings []Setting
+	for _, key := range Keys() {
+		value, origin := lookup(key)
+		settings = append(settings, Setting{Key: key, Value: value, Origin: origin})
+	}
+	return settings
+}
+
+// lookup returns the effective value of key for the active profile and where
+// it came from. Flags win over environment variables, which win over the
+// active profile, then the top level of the config file and finally the
+// built-in defaults.
+func lookup(key string) (interface{}, string) {
+	if value, ok := flagValues[key]; ok {
+		return value, OriginFlag + " --" + FlagName(key)
+	}
+	if value, ok := os.LookupEnv(EnvName(key)); ok {
+		return value, OriginEnv + " " + EnvName(key)
+	}
+
+	if key == profileSettingKey && viper.GetString(key) == "" {
+		return DefaultProfile, OriginDefault
+	}
+	if key != profileSettingKey {
+		if profiled, err := profileKey(key); err == nil && profiled != key && viper.IsSet(profiled) {
+			return viper.Get(profiled), OriginProfile + " " + ActiveProfile()
+		}
+	}
+
+	if viper.InConfig(key) {
+		return viper.Get(key), OriginFile
+	}
+	return viper.Get(key), OriginDefault
+}
+
+// overrides returns the settings given as flags or environment variables
+func overrides() map[string]interface{} {
+	values := make(map[string]interface{})
+	for _, key := range Keys() {
+		if value, origin := lookup(key); strings.HasPrefix(origin, OriginFlag) || strings.HasPrefix(origin, OriginEnv) {
+			values[key] = value
+		}
+	}
+	return values
+}
+
+// getString returns the effective value of key as a string
+func getString(key string) string {
+	value, _ := lookup(key)
+	switch value.(type) {
+	case []interface{}, []string:
+		return strings.Join(cast.ToStringSlice(value), ",")
+	}
+	return cast.ToString(value)
+}
+
+// getStringSlice returns the effective value of key as a list. Flags and
+// environment variables separate items with commas.
+func getStringSlice(key string) []string {
+	value, _ := lookup(key)
+	text, ok := value.(string)
+	if !ok {
+		return cast.ToStringSlice(value)
+	}
+
+	var items []string
+	for item := range strings.SplitSeq(text, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+// configFile returns the config file chosen with a flag or SFS_CONFIG, or ""
+// for the default one
+func configFile() string {
+	if configFileFlag != "" {
+		return ExpandHome(configFileFlag)
+	}
+	return ExpandHome(os.Getenv(ConfigEnv))
+}
+
+// ExpandHome replaces a leading ~ in path with the user's home directory
+func ExpandHome(path string) string {
+	if path != "~" && !strings.HasPrefix(path, "~/") {
+		return path
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return path
+	}
+	return filepath.Join(home, path[1:])
+}
@@ -0,0 +1,294 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"sort"
+	"strings"
+
+	"github.com/spf13/viper"
+)
+
+const (
+	// DefaultProfile names the settings at the top level of the config file
+	DefaultProfile = "default"
+
+	// ProfileEnv is the environment variable that selects a profile
+	ProfileEnv = "SFS_PROFILE"
+)
+
+// profileKeys are the settings a profile can override
+var profileKeys = []string{
+	"api_url",
+	"api_key",
+	"api_key_command",
+	"api_key_file",
+	"watch_dirs",
+	"connect_timeout",
+	"request_timeout",
+	"max_retries",
+	"retry_delay",
+	"retry_max_delay",
+	"tls_ca_file",
+	"tls_cert_file",
+	"tls_key_file",
+	"tls_insecure",
+}
+
+// profileNamePattern restricts profile names to what survives as a config
+// key, since keys are case-insensitive and dots separate nested keys
+var profileNamePattern = regexp.MustCompile(`^[a-z0-9][a-z0-9_-]*$`)
+
+// selectedProfile is the profile chosen on the command line, if any
+var selectedProfile string
+
+// WatchDir is a watched directory and the profile its files sync to
+type WatchDir struct {
+	Path    string
+	Profile string
+}
+
+// SelectProfile makes name the active profile for this process, taking
+// precedence over SFS_PROFILE and the profile saved in the config file
+func SelectProfile(name string) {
+	selectedProfile = strings.ToLower(name)
+	if selectedProfile == "" {
+		delete(flagValues, profileSettingKey)
+	} else {
+		flagValues[profileSettingKey] = selectedProfile
+	}
+}
+
+// ActiveProfile returns the profile in use: the one selected on the command
+// line, else SFS_PROFILE, else the one saved with `sfs config profile use`
+func ActiveProfile() string {
+	name := selectedProfile
+	if name == "" {
+		name = os.Getenv(ProfileEnv)
+	}
+	if name == "" {
+		name = viper.GetString("profile")
+	}
+	if name == "" {
+		return DefaultProfile
+	}
+	return strings.ToLower(name)
+}
+
+// ValidateProfileName checks that name can be used for a new profile
+func ValidateProfileName(name string) error {
+	if name == DefaultProfile {
+		return fmt.Errorf("%q is reserved for the top-level settings", DefaultProfile)
+	}
+	if !profileNamePattern.MatchString(name) {
+		return fmt.Errorf("invalid profile name %q: use lowercase letters, digits, '-' and '_'", name)
+	}
+	return nil
+}
+
+// Profiles returns the names of the defined profiles, sorted, not counting
+// the default one
+func Profiles() []string {
+	profiles, _ := viper.AllSettings()["profiles"].(map[string]interface{})
+	names := make([]string, 0, len(profiles))
+	for name := range profiles {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// ProfileExists reports whether name is the default profile or a defined one
+func ProfileExists(name string) bool {
+	return name == DefaultProfile || slices.Contains(Profiles(), name)
+}
+
+// GetProfile returns the configuration of the named profile: the top-level
+// settings with the profile's own settings applied on top, then any flag and
+// environment overrides if it is the active profile
+func GetProfile(name string) (*Config, error) {
+	cfg, err := fileProfile(name)
+	if err != nil || name != ActiveProfile() {
+		return cfg, err
+	}
+
+	values := overrides()
+	for key := range values {
+		if isListKey(key) {
+			values[key] = getStringSlice(key)
+		}
+	}
+
+	flags := viper.New()
+	if err := flags.MergeConfigMap(values); err != nil {
+		return nil, fmt.Errorf("failed to apply overrides: %w", err)
+	}
+	if err := flags.Unmarshal(cfg); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal overrides: %w", err)
+	}
+	return cfg, nil
+}
+
+// fileProfile returns the configuration of the named profile as saved in the
+// config file
+func fileProfile(name string) (*Config, error) {
+	var cfg Config
+	if err := viper.Unmarshal(&cfg); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal config: %w", err)
+	}
+	cfg.Profile = DefaultProfile
+
+	if name == DefaultProfile {
+		return &cfg, nil
+	}
+	if !ProfileExists(name) {
+		return nil, fmt.Errorf("profile %q is not defined. Run: sfs config profile add %s", name, name)
+	}
+
+	// Decode only the keys the profile sets, leaving the rest as they are
+	overrides := viper.New()
+	profiles, _ := viper.AllSettings()["profiles"].(map[string]interface{})
+	settings, _ := profiles[name].(map[string]interface{})
+	if err := overrides.MergeConfigMap(settings); err != nil {
+		return nil, fmt.Errorf("failed to read profile %s: %w", name, err)
+	}
+	if err := overrides.Unmarshal(&cfg); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal profile %s: %w", name, err)
+	}
+	cfg.Profile = name
+	return &cfg, nil
+}
+
+// AddProfile defines a new profile connecting to apiURL
+func AddProfile(name, apiURL string) error {
+	if err := ValidateProfileName(name); err != nil {
+		return err
+	}
+	if ProfileExists(name) {
+		return fmt.Errorf("profile %q already exists", name)
+	}
+
+	return save("profiles."+name+".api_url", apiURL)
+}
+
+// RemoveProfile deletes a profile, switching back to the default profile if
+// it was the one in use
+func RemoveProfile(name string) error {
+	if name == DefaultProfile {
+		return fmt.Errorf("the %s profile can't be removed", DefaultProfile)
+	}
+	if !ProfileExists(name) {
+		return fmt.Errorf("profile %q is not defined", name)
+	}
+
+	file, err := fileConfig()
+	if err != nil {
+		return err
+	}
+	settings := file.AllSettings()
+	profiles, _ := settings["profiles"].(map[string]interface{})
+	delete(profiles, name)
+	if settings["profile"] == name {
+		settings["profile"] = ""
+	}
+	return replace(settings)
+}
+
+// UseProfile saves name as the profile to use by default
+func UseProfile(name string) error {
+	if !ProfileExists(name) {
+		return fmt.Errorf("profile %q is not defined", name)
+	}
+	if name == DefaultProfile {
+		name = ""
+	}
+
+	return save("profile", name)
+}
+
+// GetAllWatchDirs returns the watched directories of every profile
+func GetAllWatchDirs() []WatchDir {
+	var dirs []WatchDir
+	for _, name := range append([]string{DefaultProfile}, Profiles()...) {
+		// The active profile's list may be overridden for this process
+		paths := viper.GetStringSlice("profiles." + name + ".watch_dirs")
+		switch {
+		case name == ActiveProfile():
+			paths = GetWatchDirs()
+		case name == DefaultProfile:
+			paths = viper.GetStringSlice("watch_dirs")
+		}
+		for _, path := range paths {
+			dirs = append(dirs, WatchDir{Path: path, Profile: name})
+		}
+	}
+	return dirs
+}
+
+// ProfileFor returns the profile of the innermost of dirs holding path, or
+// the default profile if none does
+func ProfileFor(dirs []WatchDir, path string) string {
+	profile, longest := DefaultProfile, -1
+	for _, dir := range dirs {
+		root, err := filepath.Abs(dir.Path)
+		if err != nil {
+			continue
+		}
+		if Within(root, path) && len(root) > longest {
+			profile, longest = dir.Profile, len(root)
+		}
+	}
+	return profile
+}
+
+// Within reports whether path is root or inside it
+func Within(root, path string) bool {
+	rel, err := filepath.Rel(root, path)
+	return err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator))
+}
+
+// SetWatchDirs replaces the watched directories of the active profile
+func SetWatchDirs(dirs []string) error {
+	key, err := profileKey("watch_dirs")
+	if err != nil {
+		return err
+	}
+	return save(key, dirs)
+}
+
+// profileKey returns where key is stored for the active profile. Settings a
+// profile can't override always live at the top level.
+func profileKey(key string) (string, error) {
+	name := ActiveProfile()
+	if name == DefaultProfile || !slices.Contains(profileKeys, key) {
+		return key, nil
+	}
+	if !ProfileExists(name) {
+		return "", fmt.Errorf("profile %q is not defined. Run: sfs config profile add %s", name, name)
+	}
+	return "profiles." + name + "." + key, nil
+}
+
+// replace saves settings as the whole configuration and reloads it. Unlike
+// Set, this can drop keys, which viper otherwise keeps around.
+func replace(settings map[string]interface{}) error {
+	fresh := viper.New()
+	fresh.SetConfigType(ConfigFileType)
+	if err := fresh.MergeConfigMap(settings); err != nil {
+		return fmt.Errorf("failed to update config: %w", err)
+	}
+
+	configPath, err := GetConfigPath()
+	if err != nil {
+		return err
+	}
+	if err := writeConfig(fresh, configPath); err != nil {
+		return err
+	}
+
+	viper.Reset()
+	return InitConfig()
+}
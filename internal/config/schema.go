@@ -0,0 +1,173 @@
+package config
+
+import (
+	"fmt"
+	"net/url"
+	"os"
+	"reflect"
+	"slices"
+	"strconv"
+	"time"
+)
+
+// validators check the values of keys beyond their type. List keys are
+// checked one item at a time.
+var validators = map[string]func(string) error{
+	"api_url":                 validateURL,
+	"watch_dirs":              validateDir,
+	"upload_concurrency":      intRange(1, 64),
+	"upload_rate_limit":       floatAtLeast(0),
+	"max_retries":             intRange(0, 20),
+	"api_key_file":            validateFile,
+	"secrets_passphrase_file": validateFile,
+	"tls_ca_file":             validateFile,
+	"tls_cert_file":           validateFile,
+	"tls_key_file":            validateFile,
+	"profile":                 validateProfile,
+}
+
+// durationType is the type of timeout and delay settings
+var durationType = reflect.TypeOf(time.Duration(0))
+
+// KnownKey reports whether key is a configuration key sfs understands
+func KnownKey(key string) bool {
+	return slices.Contains(Keys(), key)
+}
+
+// validate checks that value is acceptable for key. Unknown keys accept any
+// value; for list keys, value is a single item.
+func validate(key, value string) error {
+	_, err := parseValue(key, value)
+	return err
+}
+
+// parseValue converts value to the type of key, checking it on the way.
+// Durations stay strings so the saved config remains readable.
+func parseValue(key, value string) (interface{}, error) {
+	var parsed interface{} = value
+	if field, ok := fieldType(key); ok {
+		var err error
+		switch {
+		case field == durationType:
+			var d time.Duration
+			if d, err = time.ParseDuration(value); err == nil && d <= 0 {
+				return nil, fmt.Errorf("invalid %s %q: must be positive", key, value)
+			}
+		case field.Kind() == reflect.Bool:
+			parsed, err = strconv.ParseBool(value)
+		case field.Kind() == reflect.Int:
+			parsed, err = strconv.Atoi(value)
+		case field.Kind() == reflect.Float64:
+			parsed, err = strconv.ParseFloat(value, 64)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("invalid %s %q: expected %s", key, value, typeName(field))
+		}
+	}
+
+	if validate, ok := validators[key]; ok {
+		if err := validate(value); err != nil {
+			return nil, fmt.Errorf("invalid %s %q: %w", key, value, err)
+		}
+	}
+	return parsed, nil
+}
+
+// fieldType returns the Go type of key in Config
+func fieldType(key string) (reflect.Type, bool) {
+	configType := reflect.TypeOf(Config{})
+	for i := range configType.NumField() {
+		if field := configType.Field(i); field.Tag.Get("mapstructure") == key {
+			return field.Type, true
+		}
+	}
+	return nil, false
+}
+
+// typeName describes a config type for error messages
+func typeName(t reflect.Type) string {
+	switch {
+	case t == durationType:
+		return "a duration such as 30s or 1m"
+	case t.Kind() == reflect.Bool:
+		return "true or false"
+	case t.Kind() == reflect.Int:
+		return "a whole number"
+	case t.Kind() == reflect.Float64:
+		return "a number"
+	case t.Kind() == reflect.Slice:
+		return "a list"
+	}
+	return "text"
+}
+
+// validateURL checks that value is an absolute http or https URL
+func validateURL(value string) error {
+	parsedURL, err := url.Parse(value)
+	if err != nil {
+		return err
+	}
+	if parsedURL.Scheme != "http" && parsedURL.Scheme != "https" {
+		return fmt.Errorf("must start with http:// or https://")
+	}
+	if parsedURL.Host == "" {
+		return fmt.Errorf("missing host")
+	}
+	return nil
+}
+
+// validateDir checks that value is an existing directory
+func validateDir(value string) error {
+	info, err := os.Stat(ExpandHome(value))
+	if err != nil {
+		return fmt.Errorf("directory does not exist")
+	}
+	if !info.IsDir() {
+		return fmt.Errorf("not a directory")
+	}
+	return nil
+}
+
+// validateFile checks that value is an existing file. An empty value turns
+// the setting off.
+func validateFile(value string) error {
+	if value == "" {
+		return nil
+	}
+	info, err := os.Stat(ExpandHome(value))
+	if err != nil {
+		return fmt.Errorf("file does not exist")
+	}
+	if info.IsDir() {
+		return fmt.Errorf("is a directory")
+	}
+	return nil
+}
+
+// validateProfile checks that value names a defined profile
+func validateProfile(value string) error {
+	if value == "" || ProfileExists(value) {
+		return nil
+	}
+	return fmt.Errorf("profile is not defined")
+}
+
+// intRange returns a validator for whole numbers between lo and hi
+func intRange(lo, hi int) func(string) error {
+	return func(value string) error {
+		if n, err := strconv.Atoi(value); err == nil && (n < lo || n > hi) {
+			return fmt.Errorf("must be between %d and %d", lo, hi)
+		}
+		return nil
+	}
+}
+
+// floatAtLeast returns a validator for numbers no smaller than lo
+func floatAtLeast(lo float64) func(string) error {
+	return func(value string) error {
+		if n, err := strconv.ParseFloat(value, 64); err == nil && n < lo {
+			return fmt.Errorf("must be at least %g", lo)
+		}
+		return nil
+	}
+}
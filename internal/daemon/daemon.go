@@ -4,11 +4,13 @@ Copyright © 2026 T. Vicente <thiagoaureliovicente@gmail.com>
 package daemon
 
 import (
+	"context"
 	"io/fs"
 	"log"
 	"os"
 	"os/signal"
 	"path/filepath"
+	"slices"
 	"strings"
 	"sync"
 	"syscall"
@@ -17,6 +19,9 @@ import (
 	"github.com/fsnotify/fsnotify"
 	"github.com/ThiagoAVicente/sfs-cli/internal/api"
 	"github.com/ThiagoAVicente/sfs-cli/internal/config"
+	"github.com/ThiagoAVicente/sfs-cli/internal/history"
+	"github.com/ThiagoAVicente/sfs-cli/internal/ignore"
+	"github.com/ThiagoAVicente/sfs-cli/internal/state"
 )
 
 const debounceDelay = 500 * time.Millisecond
@@ -24,6 +29,7 @@ const debounceDelay = 500 * time.Millisecond
 var (
 	debounceTimers   = make(map[string]*time.Timer)
 	debounceMutex    sync.Mutex
+	removedDirs      = make(map[string]bool)
 )
 
 func ensure(err error, msg string, stopOnErr bool) {
@@ -35,8 +41,9 @@ func ensure(err error, msg string, stopOnErr bool) {
 	}
 }
 
-// createWatcher receives a list of directories/files and adds to watcher
-func createWatcher(dirs []string) *fsnotify.Watcher {
+// createWatcher receives a list of directories/files and adds to watcher,
+// skipping directories the matcher ignores
+func createWatcher(dirs []string, matcher *ignore.Matcher) *fsnotify.Watcher {
 	fileWatcher, err := fsnotify.NewWatcher()
 	ensure(err, "Failed to create file watcher", true)
 
@@ -48,26 +55,93 @@ func createWatcher(dirs []string) *fsnotify.Watcher {
 			continue
 		}
 
-		// Walk recursively to add all subdirectories
-		filepath.WalkDir(absDir, func(path string, d fs.DirEntry, err error) error {
-			if err != nil {
-				log.Printf("Error walking %s: %v", path, err)
-				return nil
-			}
+		watchRecursive(fileWatcher, absDir, matcher)
+	}
+	return fileWatcher
+}
+
+// watchRecursive adds root and all of its subdirectories to the watcher and
+// returns the regular files found along the way, leaving out anything the
+// matcher ignores
+func watchRecursive(fileWatcher *fsnotify.Watcher, root string, matcher *ignore.Matcher) []string {
+	var files []string
+
+	filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			log.Printf("Error walking %s: %v", path, err)
+			return nil
+		}
+		if matcher.Ignored(path, d.IsDir()) {
 			if d.IsDir() {
-				if err := fileWatcher.Add(path); err != nil {
-					log.Printf("Warning: Could not watch %s: %v", path, err)
-				} else {
-					log.Printf("Watching: %s", path)
-				}
+				return filepath.SkipDir
 			}
 			return nil
-		})
+		}
+		if d.IsDir() {
+			if err := fileWatcher.Add(path); err != nil {
+				log.Printf("Warning: Could not watch %s: %v", path, err)
+			} else {
+				log.Printf("Watching: %s", path)
+			}
+		} else if d.Type().IsRegular() {
+			files = append(files, path)
+		}
+		return nil
+	})
+	return files
+}
+
+// isTempFile reports whether path looks like an editor backup or swap file,
+// or a download in progress
+func isTempFile(path string) bool {
+	return strings.HasSuffix(path, "~") || strings.HasSuffix(path, ".swp") || strings.HasSuffix(path, api.PartialSuffix)
+}
+
+// isIndexable reports whether a file event should trigger an upload.
+//
+// Writes, creates (which also covers files moved into a watched directory)
+// and permission changes all qualify, as long as the path is a regular file
+// the owner can read.
+func isIndexable(event fsnotify.Event) bool {
+	if !event.Has(fsnotify.Write) && !event.Has(fsnotify.Create) && !event.Has(fsnotify.Chmod) {
+		return false
 	}
-	return fileWatcher
+
+	if isTempFile(event.Name) {
+		return false
+	}
+
+	info, err := os.Stat(event.Name)
+	if err != nil || !info.Mode().IsRegular() {
+		return false
+	}
+
+	return info.Mode().Perm()&0400 != 0
+}
+
+// debounce runs fn once no new call for the same key has arrived within delay
+func debounce(key string, delay time.Duration, fn func()) {
+	debounceMutex.Lock()
+	defer debounceMutex.Unlock()
+
+	if timer, exists := debounceTimers[key]; exists {
+		timer.Stop()
+	}
+
+	debounceTimers[key] = time.AfterFunc(delay, func() {
+		fn()
+
+		// Clean up timer
+		debounceMutex.Lock()
+		delete(debounceTimers, key)
+		debounceMutex.Unlock()
+	})
 }
 
-func Run() error {
+// Run watches the configured directories and keeps the index in sync until
+// ctx is cancelled or the process receives SIGINT or SIGTERM. Requests in
+// flight at shutdown are cancelled and their operations stay queued.
+func Run(ctx context.Context) error {
 	log.Println("SFS daemon starting...")
 
 	// Create config watcher
@@ -89,10 +163,11 @@ func Run() error {
 		log.Printf("Warning: Could not create config directory: %v", err)
 	}
 
-	// Watch the config directory
-	err = configWatcher.Add(configDir)
+	// Watch the directory holding the config file, which --config or
+	// SFS_CONFIG may place elsewhere
+	err = configWatcher.Add(filepath.Dir(configPath))
 	if err != nil {
-		log.Printf("Warning: Could not watch config directory %s: %v", configDir, err)
+		log.Printf("Warning: Could not watch config directory %s: %v", filepath.Dir(configPath), err)
 	} else {
 		log.Printf("Watching config file: %s", configPath)
 	}
@@ -106,9 +181,72 @@ func Run() error {
 		log.Printf("Warning: Failed to load config: %v", err)
 	}
 
+	// Load local sync state and any operations left pending by a previous run
+	store, err := state.OpenDefault()
+	ensure(err, "Failed to open sync state", true)
+	ensure(store.Compact(), "Failed to compact sync state", false)
+	store.AutoCompact()
+
+	pending, err := openQueue(filepath.Join(configDir, QueueFileName))
+	ensure(err, "Failed to open queue", true)
+	if n := pending.len(); n > 0 {
+		log.Printf("Resuming %d pending operations", n)
+	}
+
+	jobs, err := history.OpenDefault()
+	ensure(err, "Failed to open job history", false)
+	ensure(jobs.Compact(), "Failed to compact job history", false)
+	jobs.AutoCompact()
+
+	s := &syncer{store: store, queue: pending, history: jobs}
+
+	ctx, cancel := context.WithCancel(ctx)
+	drained := make(chan struct{})
+	go func() {
+		s.drain(ctx)
+		close(drained)
+	}()
+	go s.watchJobs(ctx)
+
+	// shutdown cancels outstanding requests and waits for the queue to settle
+	shutdown := func() {
+		cancel()
+		<-drained
+	}
+	defer shutdown()
+
 	// Create file watcher
-	fileWatcher := createWatcher(config.GetWatchDirs())
-	defer fileWatcher.Close()
+	var fileWatcher *fsnotify.Watcher
+	defer func() { fileWatcher.Close() }()
+
+	// restart rebuilds the ignore rules and the watcher, then catches up on
+	// anything that changed while the daemon was stopped or wasn't watched
+	restart := func() {
+		if config.GetTLSInsecure() {
+			log.Println(api.InsecureWarning)
+		}
+
+		dirs := config.GetAllWatchDirs()
+		paths := make([]string, len(dirs))
+		for i, dir := range dirs {
+			paths[i] = dir.Path
+		}
+
+		matcher := ignore.New(paths, config.GetIgnorePatterns())
+		s.setMatcher(matcher)
+		s.setWatchDirs(dirs)
+
+		if fileWatcher != nil {
+			fileWatcher.Close()
+		}
+		fileWatcher = createWatcher(paths, matcher)
+
+		s.requestReconcile(ctx)
+	}
+	restart()
+
+	// Ignore file changes are debounced onto this channel
+	reloadChan := make(chan struct{}, 1)
 
 	log.Println("Daemon is running. Press Ctrl+C to stop.")
 
@@ -133,69 +271,73 @@ func Run() error {
 					log.Printf("Error reloading config: %v", err)
 				} else {
 					log.Println("Config reloaded successfully")
-					fileWatcher.Close()
-					fileWatcher = createWatcher(config.GetWatchDirs())
+					restart()
 				}
 			}
 
+		case <-reloadChan:
+			log.Println("Ignore rules changed, rescanning watched directories")
+			restart()
+
 		case event, ok := <-fileWatcher.Events:
 			if !ok {
 				return nil
 			}
 
-			// Handle new directory creation
-			if event.Has(fsnotify.Create) {
-				if info, err := os.Stat(event.Name); err == nil && info.IsDir() {
-					// Add new directory to watcher
-					if err := fileWatcher.Add(event.Name); err != nil {
-						log.Printf("Warning: Could not watch new directory %s: %v", event.Name, err)
-					} else {
-						log.Printf("Now watching new directory: %s", event.Name)
+			// A changed ignore file can both hide and reveal files, so rebuild
+			// the watcher and reconcile once the edits settle
+			if filepath.Base(event.Name) == ignore.FileName {
+				debounce(event.Name, debounceDelay, func() {
+					select {
+					case reloadChan <- struct{}{}:
+					default:
 					}
-					continue
-				}
+				})
+				continue
 			}
 
-			// Handle file changes
-			if event.Has(fsnotify.Write) {
-				// Skip backup/temp files
-				if strings.HasSuffix(event.Name, "~") || strings.HasSuffix(event.Name, ".swp") {
-					continue
+			// Removed directories are only known from the watch list
+			watched := slices.Contains(fileWatcher.WatchList(), event.Name)
+			isDir := watched
+			if info, err := os.Stat(event.Name); err == nil {
+				isDir = info.IsDir()
+			}
+
+			if s.matcher().Ignored(event.Name, isDir) {
+				continue
+			}
+
+			// Handle new directories, including ones moved into a watched tree
+			if event.Has(fsnotify.Create) && isDir {
+				log.Printf("New directory: %s", event.Name)
+				for _, file := range watchRecursive(fileWatcher, event.Name, s.matcher()) {
+					if isIndexable(fsnotify.Event{Name: file, Op: fsnotify.Create}) {
+						s.scheduleSync(file)
+					}
 				}
+				continue
+			}
 
-				// Skip directories
-				if info, err := os.Stat(event.Name); err == nil && info.IsDir() {
+			// Handle deletes and the old name of renames; the new name of a
+			// rename arrives as a separate create event
+			if event.Has(fsnotify.Remove) || event.Has(fsnotify.Rename) {
+				if isTempFile(event.Name) {
 					continue
 				}
 
-				log.Printf("File changed: %s (debouncing...)", event.Name)
-
-				// Debounce: cancel existing timer and set new one
-				debounceMutex.Lock()
-				if timer, exists := debounceTimers[event.Name]; exists {
-					timer.Stop()
+				log.Printf("File removed: %s (%s, debouncing...)", event.Name, event.Op)
+				if watched {
+					s.scheduleDirRemoval(event.Name)
+				} else {
+					s.scheduleSync(event.Name)
 				}
+				continue
+			}
 
-				debounceTimers[event.Name] = time.AfterFunc(debounceDelay, func() {
-					// Upload the file after delay
-					cli, err := api.NewClient()
-					if err != nil {
-						log.Printf("Failed to create client: %v", err)
-						return
-					}
-
-					if _, err := cli.UploadFile(event.Name, true); err != nil {
-						log.Printf("Failed to upload file %s: %v", event.Name, err)
-					} else {
-						log.Printf("Uploaded file: %s", event.Name)
-					}
-
-					// Clean up timer
-					debounceMutex.Lock()
-					delete(debounceTimers, event.Name)
-					debounceMutex.Unlock()
-				})
-				debounceMutex.Unlock()
+			// Handle file changes
+			if isIndexable(event) {
+				log.Printf("File changed: %s (%s, debouncing...)", event.Name, event.Op)
+				s.scheduleSync(event.Name)
 			}
 
 		case err, ok := <-fileWatcher.Errors:
@@ -213,6 +355,10 @@ func Run() error {
 		case sig := <-sigChan:
 			log.Printf("Received signal %v, shutting down...", sig)
 			return nil
+
+		case <-ctx.Done():
+			log.Println("Shutting down...")
+			return nil
 		}
 	}
 }
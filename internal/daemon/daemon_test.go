@@ -3,9 +3,14 @@ package daemon
 import (
 	"os"
 	"path/filepath"
+	"slices"
 	"sync"
 	"testing"
 	"time"
+
+	"github.com/ThiagoAVicente/sfs-cli/internal/api"
+	"github.com/ThiagoAVicente/sfs-cli/internal/ignore"
+	"github.com/fsnotify/fsnotify"
 )
 
 func TestCreateWatcher(t *testing.T) {
@@ -17,7 +22,7 @@ func TestCreateWatcher(t *testing.T) {
 	}
 
 	// Create watcher
-	watcher := createWatcher([]string{tmpDir})
+	watcher := createWatcher([]string{tmpDir}, nil)
 	defer watcher.Close()
 
 	if watcher == nil {
@@ -27,7 +32,7 @@ func TestCreateWatcher(t *testing.T) {
 
 func TestCreateWatcherWithInvalidPath(t *testing.T) {
 	// This should not panic, but log warnings
-	watcher := createWatcher([]string{"/nonexistent/path"})
+	watcher := createWatcher([]string{"/nonexistent/path"}, nil)
 	defer watcher.Close()
 
 	if watcher == nil {
@@ -44,7 +49,7 @@ func TestCreateWatcherRecursive(t *testing.T) {
 	}
 
 	// Create watcher - should watch all levels
-	watcher := createWatcher([]string{tmpDir})
+	watcher := createWatcher([]string{tmpDir}, nil)
 	defer watcher.Close()
 
 	// Create a file in nested directory
@@ -123,10 +128,193 @@ func TestCreateWatcherAbsolutePaths(t *testing.T) {
 	os.Chdir(tmpDir)
 
 	// Create watcher with relative path
-	watcher := createWatcher([]string{"./test"})
+	watcher := createWatcher([]string{"./test"}, nil)
 	defer watcher.Close()
 
 	if watcher == nil {
 		t.Fatal("Expected watcher to handle relative paths")
 	}
 }
+
+// waitForEvent returns the first watcher event for path, failing the test on timeout
+func waitForEvent(t *testing.T, watcher *fsnotify.Watcher, path string) fsnotify.Event {
+	t.Helper()
+
+	timeout := time.After(2 * time.Second)
+	for {
+		select {
+		case event := <-watcher.Events:
+			if event.Name == path {
+				return event
+			}
+		case err := <-watcher.Errors:
+			t.Fatalf("Watcher error: %v", err)
+		case <-timeout:
+			t.Fatalf("Timed out waiting for event on %s", path)
+		}
+	}
+}
+
+func TestIsIndexableWrite(t *testing.T) {
+	tmpDir := t.TempDir()
+	testFile := filepath.Join(tmpDir, "test.txt")
+	if err := os.WriteFile(testFile, []byte("test"), 0644); err != nil {
+		t.Fatalf("Failed to create test file: %v", err)
+	}
+
+	if !isIndexable(fsnotify.Event{Name: testFile, Op: fsnotify.Write}) {
+		t.Error("Expected write event to be indexable")
+	}
+}
+
+func TestIsIndexableCreate(t *testing.T) {
+	tmpDir := t.TempDir()
+
+	watcher := createWatcher([]string{tmpDir}, nil)
+	defer watcher.Close()
+
+	testFile := filepath.Join(tmpDir, "new.txt")
+	if err := os.WriteFile(testFile, []byte("test"), 0644); err != nil {
+		t.Fatalf("Failed to create test file: %v", err)
+	}
+
+	event := waitForEvent(t, watcher, testFile)
+	if !event.Has(fsnotify.Create) {
+		t.Fatalf("Expected create event, got %s", event.Op)
+	}
+
+	if !isIndexable(event) {
+		t.Error("Expected create event to be indexable")
+	}
+}
+
+func TestIsIndexableRenameIn(t *testing.T) {
+	watchedDir := t.TempDir()
+	outsideDir := t.TempDir()
+
+	outsideFile := filepath.Join(outsideDir, "moved.txt")
+	if err := os.WriteFile(outsideFile, []byte("test"), 0644); err != nil {
+		t.Fatalf("Failed to create test file: %v", err)
+	}
+
+	watcher := createWatcher([]string{watchedDir}, nil)
+	defer watcher.Close()
+
+	// Moving a file into a watched directory is reported as a create
+	movedFile := filepath.Join(watchedDir, "moved.txt")
+	if err := os.Rename(outsideFile, movedFile); err != nil {
+		t.Fatalf("Failed to move file: %v", err)
+	}
+
+	event := waitForEvent(t, watcher, movedFile)
+	if !isIndexable(event) {
+		t.Errorf("Expected rename-in event (%s) to be indexable", event.Op)
+	}
+}
+
+func TestIsIndexableChmod(t *testing.T) {
+	tmpDir := t.TempDir()
+	testFile := filepath.Join(tmpDir, "test.txt")
+	if err := os.WriteFile(testFile, []byte("test"), 0000); err != nil {
+		t.Fatalf("Failed to create test file: %v", err)
+	}
+
+	if isIndexable(fsnotify.Event{Name: testFile, Op: fsnotify.Chmod}) {
+		t.Error("Expected unreadable file not to be indexable")
+	}
+
+	watcher := createWatcher([]string{tmpDir}, nil)
+	defer watcher.Close()
+
+	if err := os.Chmod(testFile, 0644); err != nil {
+		t.Fatalf("Failed to chmod test file: %v", err)
+	}
+
+	event := waitForEvent(t, watcher, testFile)
+	if !event.Has(fsnotify.Chmod) {
+		t.Fatalf("Expected chmod event, got %s", event.Op)
+	}
+
+	if !isIndexable(event) {
+		t.Error("Expected chmod-to-readable event to be indexable")
+	}
+}
+
+func TestIsIndexableIgnoredEvents(t *testing.T) {
+	tmpDir := t.TempDir()
+	testFile := filepath.Join(tmpDir, "test.txt")
+	swapFile := filepath.Join(tmpDir, ".test.txt.swp")
+	partFile := filepath.Join(tmpDir, "download.txt"+api.PartialSuffix)
+	for _, path := range []string{testFile, swapFile, partFile} {
+		if err := os.WriteFile(path, []byte("test"), 0644); err != nil {
+			t.Fatalf("Failed to create test file: %v", err)
+		}
+	}
+
+	tests := []struct {
+		name  string
+		event fsnotify.Event
+	}{
+		{name: "remove", event: fsnotify.Event{Name: testFile, Op: fsnotify.Remove}},
+		{name: "swap file", event: fsnotify.Event{Name: swapFile, Op: fsnotify.Write}},
+		{name: "partial download", event: fsnotify.Event{Name: partFile, Op: fsnotify.Write}},
+		{name: "directory", event: fsnotify.Event{Name: tmpDir, Op: fsnotify.Create}},
+		{name: "missing file", event: fsnotify.Event{Name: filepath.Join(tmpDir, "gone.txt"), Op: fsnotify.Create}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if isIndexable(tt.event) {
+				t.Errorf("Expected %s event not to be indexable", tt.name)
+			}
+		})
+	}
+}
+
+func TestDebounce(t *testing.T) {
+	var count int
+	var countMutex sync.Mutex
+
+	for i := 0; i < 5; i++ {
+		debounce("/tmp/debounce.txt", 50*time.Millisecond, func() {
+			countMutex.Lock()
+			count++
+			countMutex.Unlock()
+		})
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	time.Sleep(100 * time.Millisecond)
+
+	countMutex.Lock()
+	defer countMutex.Unlock()
+	if count != 1 {
+		t.Errorf("Expected 1 call, got %d", count)
+	}
+}
+
+func TestCreateWatcherSkipsIgnoredDirectories(t *testing.T) {
+	tmpDir := t.TempDir()
+	for _, dir := range []string{"src", "node_modules/pkg", ".git/objects"} {
+		if err := os.MkdirAll(filepath.Join(tmpDir, dir), 0755); err != nil {
+			t.Fatalf("Failed to create test directory: %v", err)
+		}
+	}
+	if err := os.WriteFile(filepath.Join(tmpDir, ignore.FileName), []byte("node_modules/\n"), 0644); err != nil {
+		t.Fatalf("Failed to write ignore file: %v", err)
+	}
+
+	matcher := ignore.New([]string{tmpDir}, []string{".git/"})
+	watcher := createWatcher([]string{tmpDir}, matcher)
+	defer watcher.Close()
+
+	watched := watcher.WatchList()
+	if !slices.Contains(watched, filepath.Join(tmpDir, "src")) {
+		t.Error("Expected src to be watched")
+	}
+	for _, dir := range []string{"node_modules", "node_modules/pkg", ".git", ".git/objects"} {
+		if slices.Contains(watched, filepath.Join(tmpDir, dir)) {
+			t.Errorf("Expected %s not to be watched", dir)
+		}
+	}
+}
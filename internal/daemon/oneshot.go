@@ -0,0 +1,131 @@
+package daemon
+
+import (
+	"context"
+	"fmt"
+	"os"
+
+	"github.com/ThiagoAVicente/sfs-cli/internal/api"
+	"github.com/ThiagoAVicente/sfs-cli/internal/config"
+	"github.com/ThiagoAVicente/sfs-cli/internal/history"
+	"github.com/ThiagoAVicente/sfs-cli/internal/ignore"
+	"github.com/ThiagoAVicente/sfs-cli/internal/pool"
+	"github.com/ThiagoAVicente/sfs-cli/internal/state"
+)
+
+// ChangeKind says how a file differs between a directory and the index
+type ChangeKind string
+
+const (
+	// ChangeUpload is a file the index doesn't have
+	ChangeUpload ChangeKind = "upload"
+	// ChangeUpdate is a file that changed since it was last synced
+	ChangeUpdate ChangeKind = "update"
+	// ChangeDelete is an indexed file that no longer exists locally or is
+	// now ignored
+	ChangeDelete ChangeKind = "delete"
+)
+
+// Change is a difference between a directory and the index
+type Change struct {
+	Kind ChangeKind
+	// Path is the local path, or "" for a delete of a file whose local path
+	// isn't known
+	Path    string
+	Name    string
+	Profile string
+}
+
+// Plan is what syncing a directory changes
+type Plan struct {
+	Dir     config.WatchDir
+	Changes []Change
+	// Unchanged counts the files already in sync
+	Unchanged int
+
+	// remote holds the names the index has under Dir
+	remote map[string]bool
+}
+
+// Oneshot syncs directories once, without the daemon. It compares them with
+// the index and the sync state the same way the daemon does when it starts,
+// and makes the changes with the same uploads and deletes.
+type Oneshot struct {
+	s *syncer
+}
+
+// NewOneshot opens the sync state to sync dirs. Files are ignored by the
+// same rules as in the daemon, and jobs are recorded in jobs as submitted by
+// the CLI.
+func NewOneshot(dirs []config.WatchDir, jobs *history.Log) (*Oneshot, error) {
+	store, err := state.OpenDefault()
+	if err != nil {
+		return nil, fmt.Errorf("failed to open sync state: %w", err)
+	}
+
+	var roots []string
+	for _, dir := range append(config.GetAllWatchDirs(), dirs...) {
+		roots = append(roots, dir.Path)
+	}
+
+	s := &syncer{store: store, history: jobs, source: history.SourceCLI}
+	s.setMatcher(ignore.New(roots, config.GetIgnorePatterns()))
+	s.setWatchDirs(dirs)
+	return &Oneshot{s: s}, nil
+}
+
+// Plan compares a directory with the index of its profile and the sync
+// state. Nothing is changed, except that touched but identical files get
+// their recorded size and mtime refreshed.
+func (o *Oneshot) Plan(ctx context.Context, dir config.WatchDir) (Plan, error) {
+	cli, err := api.NewProfileClient(dir.Profile)
+	if err != nil {
+		return Plan{Dir: dir}, err
+	}
+	return o.s.scan(ctx, cli, dir)
+}
+
+// Apply makes the changes of plan, running up to opts.Workers of them at
+// once, and calls done after each one. It returns the error of each change;
+// cancelling ctx stops new changes from starting, which get
+// pool.ErrNotStarted, and lets running ones finish.
+func (o *Oneshot) Apply(ctx context.Context, plan Plan, opts pool.Options, done func(Change, error)) []error {
+	cli, err := api.NewProfileClient(plan.Dir.Profile)
+	if err != nil {
+		errs := make([]error, len(plan.Changes))
+		for i, c := range plan.Changes {
+			errs[i] = err
+			if done != nil {
+				done(c, err)
+			}
+		}
+		return errs
+	}
+
+	runCtx := context.WithoutCancel(ctx)
+	errs := pool.Run(ctx, opts, plan.Changes, func(c Change) error {
+		err := o.apply(runCtx, cli, c)
+		if done != nil {
+			done(c, err)
+		}
+		return err
+	})
+
+	o.s.forgetVanished(plan)
+	return errs
+}
+
+// apply makes a single change
+func (o *Oneshot) apply(ctx context.Context, cli api.Service, c Change) error {
+	op := o.s.prepare(c)
+	if op.Kind == opDelete {
+		return o.s.remove(ctx, cli, op.Name, op.profile())
+	}
+
+	// The file may have vanished since the plan was made
+	info, err := os.Stat(op.Path)
+	if err != nil {
+		return fmt.Errorf("failed to read file: %w", err)
+	}
+	return o.s.upload(ctx, cli, op.Path, op.profile(), info)
+}
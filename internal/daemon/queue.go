@@ -0,0 +1,397 @@
+package daemon
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/rand/v2"
+	"os"
+	"path/filepath"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/ThiagoAVicente/sfs-cli/internal/api"
+	"github.com/ThiagoAVicente/sfs-cli/internal/config"
+)
+
+// QueueFileName is the name of the pending operations file inside the config
+// directory
+const QueueFileName = "queue.jsonl"
+
+const (
+	retryBaseDelay = time.Second
+	retryMaxDelay  = 5 * time.Minute
+)
+
+// queueCompactLines is how long the queue file may grow before it is
+// rewritten with one line per pending operation
+const queueCompactLines = 1000
+
+type opKind string
+
+const (
+	opUpload    opKind = "upload"
+	opDelete    opKind = "delete"
+	opDeleteDir opKind = "delete_dir"
+)
+
+// operation is a pending change to the index
+type operation struct {
+	Seq        uint64    `json:"seq"`
+	Kind       opKind    `json:"kind"`
+	Path       string    `json:"path,omitempty"`
+	Name       string    `json:"name,omitempty"`
+	Profile    string    `json:"profile,omitempty"`
+	Attempts   int       `json:"attempts"`
+	EnqueuedAt time.Time `json:"enqueued_at"`
+}
+
+// record is a line of the queue file: an operation as queued or last
+// retried, or with Done set, the end of the operation with that Seq
+type record struct {
+	operation
+	Done bool `json:"done,omitempty"`
+}
+
+// doneRecord is how the end of an operation is written to the queue file
+type doneRecord struct {
+	Seq  uint64 `json:"seq"`
+	Done bool   `json:"done"`
+}
+
+// key identifies the file an operation applies to, so that newer operations
+// on the same file replace older ones
+func (op operation) key() string {
+	if op.Path != "" {
+		return op.Path
+	}
+	return op.Name
+}
+
+// remote returns the server-side name of the file an operation applies to
+func (op operation) remote() string {
+	if op.Name != "" {
+		return op.Name
+	}
+	return api.RemoteName(op.Path)
+}
+
+// profile returns the profile whose server the operation goes to. Operations
+// queued before profiles existed belong to the default profile.
+func (op operation) profile() string {
+	if op.Profile == "" {
+		return config.DefaultProfile
+	}
+	return op.Profile
+}
+
+// permanentError marks a failure that retrying won't fix
+type permanentError struct {
+	err error
+}
+
+func (e *permanentError) Error() string { return e.err.Error() }
+func (e *permanentError) Unwrap() error { return e.err }
+
+// permanent wraps err so the queue drops the operation instead of retrying
+func permanent(err error) error {
+	if err == nil {
+		return nil
+	}
+	return &permanentError{err: err}
+}
+
+// isPermanent reports whether err was marked with permanent
+func isPermanent(err error) bool {
+	var pe *permanentError
+	return errors.As(err, &pe)
+}
+
+// queue is a durable FIFO of pending operations, persisted as JSON lines so
+// changes made while the API is unreachable survive daemon restarts. Changes
+// are appended to the file, which is rewritten once it holds mostly finished
+// operations.
+type queue struct {
+	mu     sync.Mutex
+	path   string
+	ops    []operation
+	seq    uint64
+	notify chan struct{}
+	// lines counts the lines in the file
+	lines int
+	// pausedUntil is when the queue is due to be tried again after a
+	// failure. It isn't saved, so a restarted daemon tries right away.
+	pausedUntil time.Time
+}
+
+// openQueue loads the queue at path, creating it if it doesn't exist. Lines
+// of finished operations are dropped from the file.
+func openQueue(path string) (*queue, error) {
+	q := &queue{
+		path:   path,
+		notify: make(chan struct{}, 1),
+	}
+
+	file, err := os.Open(path)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, fmt.Errorf("failed to open queue: %w", err)
+	}
+
+	if err == nil {
+		defer file.Close()
+
+		scanner := bufio.NewScanner(file)
+		for scanner.Scan() {
+			var rec record
+			if err := json.Unmarshal(scanner.Bytes(), &rec); err != nil {
+				continue
+			}
+			q.lines++
+			q.seq = max(q.seq, rec.Seq)
+			q.replay(rec)
+		}
+		if err := scanner.Err(); err != nil {
+			return nil, fmt.Errorf("failed to read queue: %w", err)
+		}
+	}
+
+	if q.lines > len(q.ops) {
+		if err := q.save(); err != nil {
+			return nil, err
+		}
+	}
+	return q, nil
+}
+
+// replay applies a line of the queue file the way the change it records was
+// made: a new operation replaces any on the same file, a retried one keeps
+// its place and a done one is removed
+func (q *queue) replay(rec record) {
+	i := slices.IndexFunc(q.ops, func(op operation) bool { return op.Seq == rec.Seq })
+	switch {
+	case rec.Done:
+		if i >= 0 {
+			q.ops = slices.Delete(q.ops, i, i+1)
+		}
+	case i >= 0:
+		q.ops[i] = rec.operation
+	default:
+		q.removeKey(rec.key())
+		q.ops = append(q.ops, rec.operation)
+	}
+}
+
+// push appends op, replacing any pending operation on the same file
+func (q *queue) push(op operation) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	q.seq++
+	op.Seq = q.seq
+	if op.EnqueuedAt.IsZero() {
+		op.EnqueuedAt = time.Now()
+	}
+
+	q.removeKey(op.key())
+	q.ops = append(q.ops, op)
+
+	if err := q.append(op); err != nil {
+		return err
+	}
+
+	select {
+	case q.notify <- struct{}{}:
+	default:
+	}
+	return nil
+}
+
+// cancel drops any pending operation on the given file
+func (q *queue) cancel(key string) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	for _, seq := range q.removeKey(key) {
+		if err := q.append(doneRecord{Seq: seq, Done: true}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// head returns up to n of the oldest pending operations, or none while the
+// queue is backing off after a failure. It stops before an operation on a
+// server-side name already taken, so the operations returned can be executed
+// concurrently and changes to a file always run in the order they were made.
+func (q *queue) head(n int) []operation {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	if time.Now().Before(q.pausedUntil) {
+		return nil
+	}
+
+	var ops []operation
+	names := make(map[string]bool)
+	for _, op := range q.ops {
+		if len(ops) == n || names[op.remote()] {
+			break
+		}
+		names[op.remote()] = true
+		ops = append(ops, op)
+	}
+	return ops
+}
+
+// nextAttempt returns when the queue is due to be tried again, if it is
+// backing off
+func (q *queue) nextAttempt() (time.Time, bool) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	return q.pausedUntil, time.Now().Before(q.pausedUntil)
+}
+
+// done removes the operation with the given sequence number. It is a no-op
+// if the operation was already replaced by a newer one.
+func (q *queue) done(seq uint64) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	for i, op := range q.ops {
+		if op.Seq == seq {
+			q.ops = append(q.ops[:i], q.ops[i+1:]...)
+			return q.append(doneRecord{Seq: seq, Done: true})
+		}
+	}
+	return nil
+}
+
+// retry records a failed attempt of the operation with the given sequence
+// number, which keeps its place, and pauses the whole queue for a backoff so
+// nothing queued behind it runs first. It returns the updated attempt count
+// and the backoff.
+func (q *queue) retry(seq uint64) (int, time.Duration, error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	for i := range q.ops {
+		if q.ops[i].Seq == seq {
+			op := &q.ops[i]
+			op.Attempts++
+			wait := backoff(op.Attempts)
+			if until := time.Now().Add(wait); until.After(q.pausedUntil) {
+				q.pausedUntil = until
+			}
+			return op.Attempts, wait, q.append(*op)
+		}
+	}
+	return 0, 0, nil
+}
+
+// len returns the number of pending operations
+func (q *queue) len() int {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	return len(q.ops)
+}
+
+// removeKey drops pending operations on the given file and returns their
+// sequence numbers. Callers must hold mu.
+func (q *queue) removeKey(key string) []uint64 {
+	var removed []uint64
+	kept := q.ops[:0]
+	for _, op := range q.ops {
+		if op.key() == key {
+			removed = append(removed, op.Seq)
+			continue
+		}
+		kept = append(kept, op)
+	}
+	q.ops = kept
+	return removed
+}
+
+// append adds a line recording a change to the queue file, rewriting the
+// file instead once it holds mostly finished operations. Callers must hold
+// mu.
+func (q *queue) append(v any) error {
+	if q.lines >= queueCompactLines && q.lines > 2*len(q.ops) {
+		return q.save()
+	}
+
+	if err := os.MkdirAll(filepath.Dir(q.path), 0755); err != nil {
+		return fmt.Errorf("failed to create queue directory: %w", err)
+	}
+	data, err := json.Marshal(v)
+	if err != nil {
+		return fmt.Errorf("failed to encode queue entry: %w", err)
+	}
+
+	file, err := os.OpenFile(q.path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0600)
+	if err != nil {
+		return fmt.Errorf("failed to open queue: %w", err)
+	}
+	if _, err := file.Write(append(data, '\n')); err != nil {
+		file.Close()
+		return fmt.Errorf("failed to write queue: %w", err)
+	}
+	if err := file.Close(); err != nil {
+		return fmt.Errorf("failed to write queue: %w", err)
+	}
+	q.lines++
+	return nil
+}
+
+// save atomically rewrites the queue file with one line per pending
+// operation. Callers must hold mu.
+func (q *queue) save() error {
+	if err := os.MkdirAll(filepath.Dir(q.path), 0755); err != nil {
+		return fmt.Errorf("failed to create queue directory: %w", err)
+	}
+
+	tmpPath := q.path + ".tmp"
+	file, err := os.OpenFile(tmpPath, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0600)
+	if err != nil {
+		return fmt.Errorf("failed to create queue: %w", err)
+	}
+
+	writer := bufio.NewWriter(file)
+	encoder := json.NewEncoder(writer)
+	for _, op := range q.ops {
+		if err := encoder.Encode(op); err != nil {
+			file.Close()
+			return fmt.Errorf("failed to write queue: %w", err)
+		}
+	}
+
+	if err := writer.Flush(); err != nil {
+		file.Close()
+		return fmt.Errorf("failed to write queue: %w", err)
+	}
+	if err := file.Close(); err != nil {
+		return fmt.Errorf("failed to write queue: %w", err)
+	}
+
+	if err := os.Rename(tmpPath, q.path); err != nil {
+		return fmt.Errorf("failed to replace queue: %w", err)
+	}
+	q.lines = len(q.ops)
+	return nil
+}
+
+// backoff returns how long to wait after the given failed attempt (starting
+// at 1): an exponentially growing delay capped at retryMaxDelay, with jitter
+// so many clients don't hammer a recovering server in lockstep
+func backoff(attempt int) time.Duration {
+	delay := retryMaxDelay
+	if attempt < 20 {
+		delay = min(retryBaseDelay<<max(attempt-1, 0), retryMaxDelay)
+	}
+
+	// Wait somewhere between half and the full delay
+	return delay/2 + rand.N(delay/2+1)
+}
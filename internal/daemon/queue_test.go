@@ -0,0 +1,290 @@
+package daemon
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestQueuePushAndDone(t *testing.T) {
+	q, err := openQueue(filepath.Join(t.TempDir(), QueueFileName))
+	if err != nil {
+		t.Fatalf("Failed to open queue: %v", err)
+	}
+
+	q.push(operation{Kind: opUpload, Path: "/tmp/a.txt"})
+	q.push(operation{Kind: opUpload, Path: "/tmp/b.txt"})
+
+	ops := q.head(1)
+	if len(ops) != 1 || ops[0].Path != "/tmp/a.txt" {
+		t.Fatalf("Expected /tmp/a.txt at the head, got %+v", ops)
+	}
+
+	if err := q.done(ops[0].Seq); err != nil {
+		t.Fatalf("Failed to complete operation: %v", err)
+	}
+
+	ops = q.head(1)
+	if len(ops) != 1 || ops[0].Path != "/tmp/b.txt" {
+		t.Fatalf("Expected /tmp/b.txt at the head, got %+v", ops)
+	}
+}
+
+func TestQueueCoalesce(t *testing.T) {
+	q, err := openQueue(filepath.Join(t.TempDir(), QueueFileName))
+	if err != nil {
+		t.Fatalf("Failed to open queue: %v", err)
+	}
+
+	q.push(operation{Kind: opUpload, Path: "/tmp/a.txt"})
+	q.push(operation{Kind: opUpload, Path: "/tmp/b.txt"})
+	q.push(operation{Kind: opDelete, Path: "/tmp/a.txt", Name: "tmp_a.txt"})
+
+	if n := q.len(); n != 2 {
+		t.Fatalf("Expected 2 operations, got %d", n)
+	}
+
+	// The delete replaced the upload and moved to the back of the queue
+	if ops := q.head(1); ops[0].Path != "/tmp/b.txt" {
+		t.Errorf("Expected /tmp/b.txt at the head, got %+v", ops)
+	}
+
+	q.cancel("/tmp/a.txt")
+	if n := q.len(); n != 1 {
+		t.Errorf("Expected 1 operation after cancel, got %d", n)
+	}
+}
+
+func TestQueueDoneAfterReplace(t *testing.T) {
+	q, err := openQueue(filepath.Join(t.TempDir(), QueueFileName))
+	if err != nil {
+		t.Fatalf("Failed to open queue: %v", err)
+	}
+
+	q.push(operation{Kind: opUpload, Path: "/tmp/a.txt"})
+	inFlight := q.head(1)[0]
+
+	// A newer change arrives while the first upload is running
+	q.push(operation{Kind: opUpload, Path: "/tmp/a.txt"})
+	q.done(inFlight.Seq)
+
+	if n := q.len(); n != 1 {
+		t.Errorf("Expected the newer operation to survive, got %d operations", n)
+	}
+}
+
+func TestQueuePersistence(t *testing.T) {
+	path := filepath.Join(t.TempDir(), QueueFileName)
+
+	q, err := openQueue(path)
+	if err != nil {
+		t.Fatalf("Failed to open queue: %v", err)
+	}
+
+	q.push(operation{Kind: opUpload, Path: "/tmp/a.txt"})
+	q.push(operation{Kind: opDelete, Name: "tmp_b.txt"})
+	if attempts, _, _ := q.retry(1); attempts != 1 {
+		t.Errorf("Expected 1 attempt, got %d", attempts)
+	}
+
+	// Reopen as if the daemon restarted
+	q, err = openQueue(path)
+	if err != nil {
+		t.Fatalf("Failed to reopen queue: %v", err)
+	}
+
+	if n := q.len(); n != 2 {
+		t.Fatalf("Expected 2 operations after restart, got %d", n)
+	}
+
+	// A restarted daemon retries failed operations right away
+	op := q.head(1)[0]
+	if op.Kind != opUpload || op.Path != "/tmp/a.txt" || op.Attempts != 1 {
+		t.Errorf("Unexpected head after restart: %+v", op)
+	}
+
+	// New operations keep counting from the persisted sequence
+	q.push(operation{Kind: opUpload, Path: "/tmp/c.txt"})
+	q.done(op.Seq)
+	q.done(op.Seq + 1)
+	if ops := q.head(1); ops[0].Path != "/tmp/c.txt" {
+		t.Errorf("Expected /tmp/c.txt at the head, got %+v", ops)
+	}
+}
+
+func TestBackoff(t *testing.T) {
+	for attempt := 1; attempt <= 30; attempt++ {
+		delay := min(retryBaseDelay<<min(attempt-1, 20), retryMaxDelay)
+
+		wait := backoff(attempt)
+		if wait < delay/2 || wait > delay {
+			t.Errorf("Attempt %d: expected wait between %s and %s, got %s", attempt, delay/2, delay, wait)
+		}
+	}
+
+	if backoff(100) > retryMaxDelay {
+		t.Errorf("Expected backoff to be capped at %s", retryMaxDelay)
+	}
+}
+
+func TestPermanent(t *testing.T) {
+	if isPermanent(errors.New("connection refused")) {
+		t.Error("Expected plain error not to be permanent")
+	}
+
+	err := permanent(errors.New("file vanished"))
+	if !isPermanent(err) {
+		t.Error("Expected wrapped error to be permanent")
+	}
+
+	if permanent(nil) != nil {
+		t.Error("Expected permanent(nil) to be nil")
+	}
+}
+
+func TestQueueHead(t *testing.T) {
+	q, err := openQueue(filepath.Join(t.TempDir(), QueueFileName))
+	if err != nil {
+		t.Fatalf("Failed to open queue: %v", err)
+	}
+
+	if ops := q.head(4); len(ops) != 0 {
+		t.Errorf("Expected empty head, got %+v", ops)
+	}
+
+	q.push(operation{Kind: opUpload, Path: "/tmp/a.txt"})
+	q.push(operation{Kind: opUpload, Path: "/tmp/b.txt"})
+	q.push(operation{Kind: opUpload, Path: "/tmp/c.txt"})
+
+	ops := q.head(2)
+	if len(ops) != 2 || ops[0].Path != "/tmp/a.txt" || ops[1].Path != "/tmp/b.txt" {
+		t.Errorf("Expected the two oldest operations, got %+v", ops)
+	}
+
+	// The returned slice is a copy
+	q.done(ops[0].Seq)
+	if ops[0].Path != "/tmp/a.txt" {
+		t.Error("Expected head to be unaffected by later queue changes")
+	}
+}
+
+func TestQueueRetryBacksOff(t *testing.T) {
+	q, err := openQueue(filepath.Join(t.TempDir(), QueueFileName))
+	if err != nil {
+		t.Fatalf("Failed to open queue: %v", err)
+	}
+
+	q.push(operation{Kind: opUpload, Path: "/tmp/a.txt"})
+	q.push(operation{Kind: opUpload, Path: "/tmp/b.txt"})
+	if _, ok := q.nextAttempt(); ok {
+		t.Error("Expected the queue not to be backing off")
+	}
+
+	attempts, wait, err := q.retry(1)
+	if err != nil || attempts != 1 || wait <= 0 {
+		t.Fatalf("Expected a first attempt with a backoff, got %d, %s, %v", attempts, wait, err)
+	}
+
+	// Nothing runs ahead of the failed operation, not even newer changes
+	q.push(operation{Kind: opUpload, Path: "/tmp/c.txt"})
+	if ops := q.head(4); len(ops) != 0 {
+		t.Errorf("Expected nothing to be due while backing off, got %+v", ops)
+	}
+	if next, ok := q.nextAttempt(); !ok || time.Until(next) > wait {
+		t.Errorf("Expected the queue to be due within %s, got %s", wait, next)
+	}
+
+	// Once due, the failed operation is still first
+	q.pausedUntil = time.Now()
+	ops := q.head(4)
+	if len(ops) != 3 || ops[0].Path != "/tmp/a.txt" || ops[0].Attempts != 1 {
+		t.Errorf("Expected /tmp/a.txt to be retried first, got %+v", ops)
+	}
+}
+
+func TestQueueHeadSameName(t *testing.T) {
+	q, err := openQueue(filepath.Join(t.TempDir(), QueueFileName))
+	if err != nil {
+		t.Fatalf("Failed to open queue: %v", err)
+	}
+
+	// A delete by name doesn't replace the upload of the file stored under
+	// it, so it must wait for the upload to finish
+	q.push(operation{Kind: opUpload, Path: "/tmp/a_b.txt"})
+	q.push(operation{Kind: opDelete, Name: "tmp_a_b.txt"})
+	q.push(operation{Kind: opUpload, Path: "/tmp/c.txt"})
+
+	ops := q.head(4)
+	if len(ops) != 1 || ops[0].Kind != opUpload {
+		t.Fatalf("Expected only the upload to be due, got %+v", ops)
+	}
+	q.done(ops[0].Seq)
+	if ops := q.head(4); len(ops) != 2 || ops[0].Kind != opDelete {
+		t.Errorf("Expected the delete to be due next, got %+v", ops)
+	}
+}
+
+func TestQueueAppends(t *testing.T) {
+	path := filepath.Join(t.TempDir(), QueueFileName)
+	q, err := openQueue(path)
+	if err != nil {
+		t.Fatalf("Failed to open queue: %v", err)
+	}
+
+	q.push(operation{Kind: opUpload, Path: "/tmp/a.txt"})
+	q.push(operation{Kind: opUpload, Path: "/tmp/b.txt"})
+	q.retry(2)
+	q.push(operation{Kind: opUpload, Path: "/tmp/a.txt"})
+	q.done(3)
+	q.push(operation{Kind: opUpload, Path: "/tmp/c.txt"})
+	q.cancel("/tmp/c.txt")
+
+	// Every change is a line of its own
+	if lines := countLines(t, path); lines != 7 {
+		t.Errorf("Expected 7 lines, got %d", lines)
+	}
+
+	// Reopening replays them and drops the finished ones
+	q, err = openQueue(path)
+	if err != nil {
+		t.Fatalf("Failed to reopen queue: %v", err)
+	}
+	ops := q.head(4)
+	if len(ops) != 1 || ops[0].Path != "/tmp/b.txt" || ops[0].Attempts != 1 {
+		t.Errorf("Expected only the retried /tmp/b.txt, got %+v", ops)
+	}
+	if lines := countLines(t, path); lines != 1 {
+		t.Errorf("Expected 1 line after reopening, got %d", lines)
+	}
+
+	// A long-running daemon rewrites the file once it is mostly finished
+	// operations
+	for i := range queueCompactLines {
+		q.push(operation{Kind: opUpload, Path: fmt.Sprintf("/tmp/%d.txt", i)})
+		q.done(q.head(2)[1].Seq)
+	}
+	if lines := countLines(t, path); lines >= queueCompactLines {
+		t.Errorf("Expected the file to be compacted, got %d lines", lines)
+	}
+	q, err = openQueue(path)
+	if err != nil {
+		t.Fatalf("Failed to reopen queue: %v", err)
+	}
+	if ops := q.head(4); len(ops) != 1 || ops[0].Path != "/tmp/b.txt" {
+		t.Errorf("Expected only /tmp/b.txt after compaction, got %+v", ops)
+	}
+}
+
+// countLines returns the number of lines in the file at path
+func countLines(t *testing.T, path string) int {
+	t.Helper()
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("Failed to read queue: %v", err)
+	}
+	return strings.Count(string(data), "\n")
+}
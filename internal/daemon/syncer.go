@@ -0,0 +1,694 @@
+package daemon
+
+import (
+	"context"
+	"errors"
+	"io/fs"
+	"log"
+	"os"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/ThiagoAVicente/sfs-cli/internal/api"
+	"github.com/ThiagoAVicente/sfs-cli/internal/config"
+	"github.com/ThiagoAVicente/sfs-cli/internal/history"
+	"github.com/ThiagoAVicente/sfs-cli/internal/ignore"
+	"github.com/ThiagoAVicente/sfs-cli/internal/pool"
+	"github.com/ThiagoAVicente/sfs-cli/internal/state"
+)
+
+// syncer turns file changes into queued index operations, executes them and
+// keeps the local sync state in step
+type syncer struct {
+	store   *state.Store
+	queue   *queue
+	history *history.Log
+	ignore  atomic.Pointer[ignore.Matcher]
+	dirs    atomic.Pointer[[]config.WatchDir]
+
+	// source is recorded as the submitter of jobs, the daemon if empty
+	source string
+
+	// reconcileMutex guards reconciling and reconcilePending, which keep
+	// reconciliation passes from overlapping or piling up
+	reconcileMutex   sync.Mutex
+	reconciling      bool
+	reconcilePending bool
+}
+
+// jobCheckInterval is how often the daemon checks on indexing jobs
+const jobCheckInterval = time.Minute
+
+// reconcileSummary counts what a reconciliation pass found
+type reconcileSummary struct {
+	Uploads   int
+	Updates   int
+	Deletes   int
+	Unchanged int
+}
+
+// matcher returns the current ignore rules
+func (s *syncer) matcher() *ignore.Matcher {
+	return s.ignore.Load()
+}
+
+// setMatcher replaces the ignore rules, e.g. after a config reload
+func (s *syncer) setMatcher(matcher *ignore.Matcher) {
+	s.ignore.Store(matcher)
+}
+
+// setWatchDirs replaces the watched directories, e.g. after a config reload
+func (s *syncer) setWatchDirs(dirs []config.WatchDir) {
+	s.dirs.Store(&dirs)
+}
+
+// watchDirs returns the watched directories
+func (s *syncer) watchDirs() []config.WatchDir {
+	if dirs := s.dirs.Load(); dirs != nil {
+		return *dirs
+	}
+	return nil
+}
+
+// profileFor returns the profile of the innermost watched directory holding
+// path, or the default profile if none does
+func (s *syncer) profileFor(path string) string {
+	return config.ProfileFor(s.watchDirs(), path)
+}
+
+// scheduleSync debounces a sync of the given path with the index
+func (s *syncer) scheduleSync(path string) {
+	debounce(path, debounceDelay, func() {
+		s.syncPath(path)
+	})
+}
+
+// scheduleDirRemoval debounces the removal of every indexed file under a
+// directory that was deleted or moved out of the watched tree
+func (s *syncer) scheduleDirRemoval(path string) {
+	debounceMutex.Lock()
+	removedDirs[path] = true
+	debounceMutex.Unlock()
+
+	s.scheduleSync(path)
+}
+
+// syncPath queues whatever brings the index in line with the current state
+// of path: regular files are uploaded and paths that no longer exist are
+// deleted. Deciding at fire time rather than per event keeps editors that
+// save via rename-and-recreate from bouncing a file out of the index.
+func (s *syncer) syncPath(path string) {
+	debounceMutex.Lock()
+	wasDir := removedDirs[path]
+	delete(removedDirs, path)
+	debounceMutex.Unlock()
+
+	info, err := os.Stat(path)
+	switch {
+	case err == nil && info.Mode().IsRegular():
+		if !s.needsUpload(path, info) {
+			log.Printf("Unchanged, skipping: %s", path)
+			return
+		}
+		s.enqueue(operation{Kind: opUpload, Path: path, Profile: s.profileFor(path)})
+
+	case os.IsNotExist(err) && wasDir:
+		s.enqueue(operation{Kind: opDeleteDir, Path: path, Profile: s.profileFor(path)})
+
+	case os.IsNotExist(err):
+		// A file the sync state doesn't know may still have been uploaded,
+		// e.g. with sfs upload, so it is deleted unless its name belongs to
+		// another file; a server that doesn't have it is as good as done
+		name, profile := api.RemoteName(path), s.profileFor(path)
+		if _, tracked := s.store.Get(path); !tracked && s.claimed(name, path, profile) {
+			if err := s.queue.cancel(path); err != nil {
+				log.Printf("Warning: Could not update queue: %v", err)
+			}
+			return
+		}
+		s.enqueue(operation{Kind: opDelete, Path: path, Name: name, Profile: profile})
+	}
+}
+
+// enqueue adds op to the pending operations queue
+func (s *syncer) enqueue(op operation) {
+	if err := s.queue.push(op); err != nil {
+		log.Printf("Failed to queue %s of %s: %v", op.Kind, op.key(), err)
+	}
+}
+
+// drain executes queued operations in order until ctx is cancelled, running
+// up to upload_concurrency of them at once. Failed operations keep their
+// place at the head of the queue, which backs off before trying them again,
+// so nothing is lost while the API is unreachable and changes are applied in
+// the order they were made. Cancelling ctx aborts running operations, which
+// stay queued for the next run.
+func (s *syncer) drain(ctx context.Context) {
+	var limiter *pool.Limiter
+	rate := 0.0
+
+	for {
+		workers := config.GetUploadConcurrency()
+		ops := s.queue.head(workers)
+		if len(ops) == 0 {
+			// Wait for a new operation, or for the queue to be due again
+			var due <-chan time.Time
+			if next, ok := s.queue.nextAttempt(); ok {
+				due = time.After(time.Until(next))
+			}
+			select {
+			case <-s.queue.notify:
+			case <-due:
+			case <-ctx.Done():
+				return
+			}
+			continue
+		}
+
+		if r := config.GetUploadRateLimit(); limiter == nil || r != rate {
+			rate, limiter = r, pool.NewLimiter(r)
+		}
+
+		// Operations go to the server of their profile
+		clients := make(map[string]api.Service)
+		clientErrs := make(map[string]error)
+		for _, op := range ops {
+			profile := op.profile()
+			if _, ok := clients[profile]; !ok && clientErrs[profile] == nil {
+				cli, err := api.NewProfileClient(profile)
+				if err != nil {
+					clientErrs[profile] = err
+				} else {
+					clients[profile] = cli
+				}
+			}
+		}
+
+		errs := pool.Run(ctx, pool.Options{Workers: workers, Limiter: limiter}, ops, func(op operation) error {
+			if err := clientErrs[op.profile()]; err != nil {
+				return err
+			}
+			return s.execute(ctx, clients[op.profile()], op)
+		})
+
+		if ctx.Err() != nil {
+			return
+		}
+
+		for i, op := range ops {
+			err := errs[i]
+			if errors.Is(err, pool.ErrNotStarted) {
+				continue
+			}
+
+			// Requests the server rejected outright would fail the same way again
+			if err == nil || isPermanent(err) || api.IsClientError(err) {
+				if err != nil {
+					log.Printf("Dropping %s of %s: %v", op.Kind, op.key(), err)
+				}
+				if err := s.queue.done(op.Seq); err != nil {
+					log.Printf("Warning: Could not update queue: %v", err)
+				}
+				continue
+			}
+
+			n, wait, qerr := s.queue.retry(op.Seq)
+			if qerr != nil {
+				log.Printf("Warning: Could not update queue: %v", qerr)
+			}
+			log.Printf("Failed to %s %s (attempt %d, retrying in %s): %v", op.Kind, op.key(), n, wait.Round(time.Second), err)
+		}
+	}
+}
+
+// execute performs a single queued operation
+func (s *syncer) execute(ctx context.Context, cli api.Service, op operation) error {
+	switch op.Kind {
+	case opUpload:
+		// The file may have changed or vanished since it was queued
+		info, err := os.Stat(op.Path)
+		if err != nil || !info.Mode().IsRegular() || !s.needsUpload(op.Path, info) {
+			return nil
+		}
+		if err := s.upload(ctx, cli, op.Path, op.profile(), info); err != nil {
+			return err
+		}
+		log.Printf("Uploaded file: %s", op.Path)
+
+	case opDelete:
+		if err := s.remove(ctx, cli, op.Name, op.profile()); err != nil {
+			return err
+		}
+		log.Printf("Deleted file: %s", op.Name)
+
+	case opDeleteDir:
+		return s.removeDir(ctx, cli, op.Path, op.profile())
+	}
+	return nil
+}
+
+// needsUpload reports whether a file differs from what was last synced.
+// Touched but identical files get their recorded size and mtime refreshed so
+// the hash isn't recomputed next time.
+func (s *syncer) needsUpload(path string, info fs.FileInfo) bool {
+	entry, tracked := s.store.Get(path)
+	if !tracked || !entry.Synced() || !entry.Matches(path, info) {
+		return true
+	}
+
+	if !entry.Unchanged(info) {
+		entry.Size = info.Size()
+		entry.ModTime = info.ModTime()
+		if err := s.store.Put(entry); err != nil {
+			log.Printf("Warning: Could not record sync state for %s: %v", path, err)
+		}
+	}
+	return false
+}
+
+// upload sends a file to the index and records the outcome in the sync state
+func (s *syncer) upload(ctx context.Context, cli api.Service, path, profile string, info fs.FileInfo) error {
+	name := api.RemoteName(path)
+
+	entry, err := state.NewEntry(path, name, info)
+	if err != nil {
+		return permanent(err)
+	}
+
+	result, err := cli.UploadFile(ctx, path, true)
+	if err != nil {
+		// An upload cut short by shutdown didn't fail, it is still pending
+		if ctx.Err() != nil {
+			return err
+		}
+
+		// Keep the last good contents on record so the retry isn't skipped
+		failed, tracked := s.store.Get(path)
+		if !tracked {
+			failed = state.Entry{Path: path, RemoteName: name}
+		}
+		failed.Error = err.Error()
+		if err := s.store.Put(failed); err != nil {
+			log.Printf("Warning: Could not record sync state for %s: %v", path, err)
+		}
+		return err
+	}
+
+	entry.JobID = result.JobID
+	entry.JobStatus = state.JobSubmitted
+	entry.SyncedAt = time.Now()
+	if err := s.store.Put(entry); err != nil {
+		log.Printf("Warning: Could not record sync state for %s: %v", path, err)
+	}
+
+	s.recordJob(history.Job{ID: result.JobID, Op: history.OpUpload, Path: path, Name: name, Profile: profile})
+	return nil
+}
+
+// recordJob adds a job submitted by the syncer to the job history
+func (s *syncer) recordJob(job history.Job) {
+	job.Source = s.source
+	if job.Source == "" {
+		job.Source = history.SourceDaemon
+	}
+	if err := s.history.Add(job); err != nil {
+		log.Printf("Warning: Could not record job %s: %v", job.ID, err)
+	}
+}
+
+// watchJobs checks on the indexing jobs of uploaded files every
+// jobCheckInterval until ctx is cancelled
+func (s *syncer) watchJobs(ctx context.Context) {
+	ticker := time.NewTicker(jobCheckInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			s.checkJobs(ctx)
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// checkJobs asks the server how the indexing jobs of uploaded files turned
+// out and records the outcomes in the sync state and the job history. Files
+// whose job failed no longer count as synced, so the next reconciliation or
+// change to them uploads them again.
+func (s *syncer) checkJobs(ctx context.Context) {
+	clients := make(map[string]api.Service)
+	for _, entry := range s.store.List() {
+		if entry.JobID == "" || entry.JobStatus != state.JobSubmitted {
+			continue
+		}
+
+		profile := s.profileFor(entry.Path)
+		cli, ok := clients[profile]
+		if !ok {
+			c, err := api.NewProfileClient(profile)
+			if err != nil {
+				log.Printf("Warning: Could not check indexing jobs: %v", err)
+			} else {
+				cli = c
+			}
+			clients[profile] = cli
+		}
+		if cli == nil {
+			continue
+		}
+
+		status, err := cli.GetJobStatus(ctx, entry.JobID)
+		if ctx.Err() != nil {
+			return
+		}
+		if err != nil {
+			log.Printf("Warning: Could not check job %s: %v", entry.JobID, err)
+			continue
+		}
+		if !status.IsTerminal() {
+			continue
+		}
+
+		if status.Failed() {
+			log.Printf("Indexing failed: %s (job %s %s)", entry.Path, entry.JobID, status.Status)
+		}
+		if err := s.store.FinishJob(entry.JobID, status.Failed()); err != nil {
+			log.Printf("Warning: Could not record sync state for %s: %v", entry.Path, err)
+		}
+		if err := s.history.Update(history.Job{ID: entry.JobID, Status: status.Status}); err != nil {
+			log.Printf("Warning: Could not record job %s: %v", entry.JobID, err)
+		}
+	}
+}
+
+// remove deletes a file from the index and forgets its sync state
+func (s *syncer) remove(ctx context.Context, cli api.Service, name, profile string) error {
+	result, err := cli.DeleteFile(ctx, name)
+	if err != nil && !api.IsNotFound(err) {
+		return err
+	}
+
+	// A file the server doesn't know is as good as deleted, but there is no
+	// job to record
+	var job history.Job
+	if err == nil {
+		job = history.Job{ID: result.JobID, Op: history.OpDelete, Name: name, Profile: profile}
+	}
+	if entry, tracked := s.store.FindRemote(name); tracked {
+		job.Path = entry.Path
+		if err := s.store.Delete(entry.Path); err != nil {
+			log.Printf("Warning: Could not record sync state for %s: %v", entry.Path, err)
+		}
+	}
+	if job.ID != "" {
+		s.recordJob(job)
+	}
+	return nil
+}
+
+// removeDir queues the deletion of every indexed file the sync state places
+// under the given directory
+func (s *syncer) removeDir(ctx context.Context, cli api.Service, path, profile string) error {
+	result, err := cli.ListFiles(ctx, api.RemoteName(path)+"_")
+	if err != nil {
+		return err
+	}
+
+	uploads := s.uploads(profile)
+	for _, name := range result.Files {
+		if _, ok := s.owned(name, path, uploads); ok {
+			s.enqueue(s.deleteOp(name, profile))
+		}
+	}
+	return nil
+}
+
+// owned returns the local path of the stored file called name if it was
+// uploaded from inside dir, as known from the sync state or else from
+// uploads. Listing the index by the prefix of dir also finds files of
+// sibling directories, since /home/user/docs_old/a.txt and
+// /home/user/docs/old_a.txt are both stored as home_user_docs_old_a.txt, so
+// files of unknown origin are never deleted.
+func (s *syncer) owned(name, dir string, uploads map[string]string) (string, bool) {
+	path, known := uploads[name]
+	if entry, tracked := s.store.FindRemote(name); tracked {
+		path, known = entry.Path, true
+	}
+	if !known || !config.Within(dir, path) {
+		return "", false
+	}
+	return path, true
+}
+
+// claimed reports whether the sync state or the job history places the
+// stored file called name at a local path other than path
+func (s *syncer) claimed(name, path, profile string) bool {
+	if entry, tracked := s.store.FindRemote(name); tracked {
+		return entry.Path != path
+	}
+	owner, known := s.uploads(profile)[name]
+	return known && owner != path
+}
+
+// uploads maps the server-side names of the files of a profile that the job
+// history last saw uploaded, with sfs upload or by the syncer, to their
+// local paths
+func (s *syncer) uploads(profile string) map[string]string {
+	paths := make(map[string]string)
+	jobs, err := s.history.List()
+	if err != nil {
+		log.Printf("Warning: Could not read job history: %v", err)
+		return paths
+	}
+
+	for _, job := range jobs {
+		if job.Name == "" || job.ProfileName() != profile {
+			continue
+		}
+		switch job.Op {
+		case history.OpUpload:
+			if job.Path != "" {
+				paths[job.Name] = job.Path
+			}
+		case history.OpDelete:
+			delete(paths, job.Name)
+		}
+	}
+	return paths
+}
+
+// deleteOp builds a delete operation for a server-side name, keyed by the
+// local path when the sync state knows it so it replaces pending uploads
+func (s *syncer) deleteOp(name, profile string) operation {
+	op := operation{Kind: opDelete, Name: name, Profile: profile}
+	if entry, tracked := s.store.FindRemote(name); tracked {
+		op.Path = entry.Path
+	}
+	return op
+}
+
+// requestReconcile reconciles the watched directories in the background.
+// Requests made while a pass is running are coalesced into a single pass
+// that starts after it, over the directories watched by then.
+func (s *syncer) requestReconcile(ctx context.Context) {
+	s.reconcileMutex.Lock()
+	defer s.reconcileMutex.Unlock()
+
+	if s.reconciling {
+		s.reconcilePending = true
+		return
+	}
+	s.reconciling = true
+
+	go func() {
+		for {
+			s.reconcileAll(ctx, s.watchDirs())
+
+			s.reconcileMutex.Lock()
+			if !s.reconcilePending || ctx.Err() != nil {
+				s.reconciling, s.reconcilePending = false, false
+				s.reconcileMutex.Unlock()
+				return
+			}
+			s.reconcilePending = false
+			s.reconcileMutex.Unlock()
+		}
+	}()
+}
+
+// reconcileAll runs a reconciliation pass over each directory, retrying with
+// backoff while the API is unreachable, until every pass succeeded or ctx
+// is cancelled
+func (s *syncer) reconcileAll(ctx context.Context, dirs []config.WatchDir) {
+	for attempt := 1; len(dirs) > 0; attempt++ {
+		var failed []config.WatchDir
+
+		for _, dir := range dirs {
+			absDir, err := filepath.Abs(dir.Path)
+			if err != nil {
+				log.Printf("Warning: Could not resolve path %s: %v", dir.Path, err)
+				continue
+			}
+
+			summary, err := s.reconcile(ctx, config.WatchDir{Path: absDir, Profile: dir.Profile})
+			if ctx.Err() != nil {
+				return
+			}
+			if err != nil {
+				log.Printf("Failed to reconcile %s: %v", absDir, err)
+				failed = append(failed, dir)
+				continue
+			}
+
+			log.Printf("Reconciled %s: %d to upload, %d to update, %d to delete, %d unchanged",
+				absDir, summary.Uploads, summary.Updates, summary.Deletes, summary.Unchanged)
+		}
+
+		dirs = failed
+		if len(dirs) == 0 {
+			return
+		}
+
+		wait := backoff(attempt)
+		log.Printf("Retrying reconciliation in %s", wait.Round(time.Second))
+		select {
+		case <-time.After(wait):
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// reconcile compares a watched directory against the index of its profile
+// and the local sync state, queueing uploads of new or changed files and
+// deletes of vanished or ignored ones
+func (s *syncer) reconcile(ctx context.Context, watched config.WatchDir) (reconcileSummary, error) {
+	var summary reconcileSummary
+
+	cli, err := api.NewProfileClient(watched.Profile)
+	if err != nil {
+		return summary, err
+	}
+
+	plan, err := s.scan(ctx, cli, watched)
+	if err != nil {
+		return summary, err
+	}
+
+	summary.Unchanged = plan.Unchanged
+	for _, c := range plan.Changes {
+		switch c.Kind {
+		case ChangeUpload:
+			summary.Uploads++
+		case ChangeUpdate:
+			summary.Updates++
+		case ChangeDelete:
+			summary.Deletes++
+		}
+		s.enqueue(s.prepare(c))
+	}
+
+	s.forgetVanished(plan)
+	return summary, nil
+}
+
+// scan works out what brings the index in line with a watched directory:
+// uploads of files the index doesn't have or that changed since they were
+// last synced, and deletes of indexed files that no longer exist locally or
+// are now ignored
+func (s *syncer) scan(ctx context.Context, cli api.Service, watched config.WatchDir) (Plan, error) {
+	plan := Plan{Dir: watched}
+	dir := watched.Path
+
+	result, err := cli.ListFiles(ctx, api.RemoteName(dir)+"_")
+	if err != nil {
+		return plan, err
+	}
+
+	plan.remote = make(map[string]bool, len(result.Files))
+	for _, name := range result.Files {
+		plan.remote[name] = true
+	}
+
+	// Upload new and changed files
+	local := make(map[string]bool)
+	filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			log.Printf("Error walking %s: %v", path, err)
+			return nil
+		}
+		if s.matcher().Ignored(path, d.IsDir()) {
+			if d.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if d.IsDir() || !d.Type().IsRegular() || d.Name() == ignore.FileName || isTempFile(path) {
+			return nil
+		}
+
+		info, err := d.Info()
+		if err != nil || info.Mode().Perm()&0400 == 0 {
+			return nil
+		}
+
+		name := api.RemoteName(path)
+		local[name] = true
+
+		change := Change{Path: path, Name: name, Profile: watched.Profile}
+		switch {
+		case !plan.remote[name]:
+			change.Kind = ChangeUpload
+		case s.needsUpload(path, info):
+			change.Kind = ChangeUpdate
+		default:
+			plan.Unchanged++
+			return nil
+		}
+		plan.Changes = append(plan.Changes, change)
+		return nil
+	})
+
+	// Delete files that no longer exist locally or are now ignored, leaving
+	// alone files the prefix matched that belong to other directories
+	uploads := s.uploads(watched.Profile)
+	for _, name := range result.Files {
+		if local[name] {
+			continue
+		}
+		if path, ok := s.owned(name, dir, uploads); ok {
+			plan.Changes = append(plan.Changes, Change{Kind: ChangeDelete, Path: path, Name: name, Profile: watched.Profile})
+		}
+	}
+
+	return plan, nil
+}
+
+// prepare returns the operation that makes a change. New files have their
+// sync state dropped first: whatever it says, the index no longer has them.
+func (s *syncer) prepare(c Change) operation {
+	switch c.Kind {
+	case ChangeDelete:
+		return s.deleteOp(c.Name, c.Profile)
+	case ChangeUpload:
+		if err := s.store.Delete(c.Path); err != nil {
+			log.Printf("Warning: Could not record sync state for %s: %v", c.Path, err)
+		}
+	}
+	return operation{Kind: opUpload, Path: c.Path, Profile: c.Profile}
+}
+
+// forgetVanished drops the sync state of files under the scanned directory
+// that vanished without ever reaching the index
+func (s *syncer) forgetVanished(plan Plan) {
+	for _, entry := range s.store.Under(plan.Dir.Path) {
+		if _, err := os.Stat(entry.Path); os.IsNotExist(err) && !plan.remote[entry.RemoteName] {
+			if err := s.store.Delete(entry.Path); err != nil {
+				log.Printf("Warning: Could not record sync state for %s: %v", entry.Path, err)
+			}
+		}
+	}
+}
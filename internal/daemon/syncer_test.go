@@ -0,0 +1,479 @@
+package daemon
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"slices"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/ThiagoAVicente/sfs-cli/internal/api"
+	"github.com/ThiagoAVicente/sfs-cli/internal/api/apitest"
+	"github.com/ThiagoAVicente/sfs-cli/internal/config"
+	"github.com/ThiagoAVicente/sfs-cli/internal/history"
+	"github.com/ThiagoAVicente/sfs-cli/internal/ignore"
+	"github.com/ThiagoAVicente/sfs-cli/internal/pool"
+	"github.com/ThiagoAVicente/sfs-cli/internal/state"
+	"github.com/spf13/viper"
+)
+
+// newTestSyncer returns a syncer with its state in a temp dir, configured to
+// talk to a fake API server
+func newTestSyncer(t *testing.T) (*syncer, *apitest.Server) {
+	viper.Reset()
+	home := os.Getenv("HOME")
+	os.Setenv("HOME", t.TempDir())
+	t.Cleanup(func() {
+		os.Setenv("HOME", home)
+	})
+	if err := config.InitConfig(); err != nil {
+		t.Fatalf("Failed to init config: %v", err)
+	}
+
+	server := apitest.NewServer()
+	t.Cleanup(server.Close)
+	config.Set("api_url", server.URL)
+	config.Set("api_key", apitest.APIKey)
+	config.Set("retry_delay", "1ms")
+
+	dir := t.TempDir()
+	store, err := state.Open(filepath.Join(dir, "state.jsonl"))
+	if err != nil {
+		t.Fatalf("Failed to open state: %v", err)
+	}
+	q, err := openQueue(filepath.Join(dir, QueueFileName))
+	if err != nil {
+		t.Fatalf("Failed to open queue: %v", err)
+	}
+	jobs, err := history.Open(filepath.Join(dir, history.FileName))
+	if err != nil {
+		t.Fatalf("Failed to open history: %v", err)
+	}
+
+	return &syncer{store: store, queue: q, history: jobs}, server
+}
+
+func TestSyncerUploadAndDelete(t *testing.T) {
+	s, server := newTestSyncer(t)
+	ctx := context.Background()
+	cli, err := api.NewClient()
+	if err != nil {
+		t.Fatalf("Failed to create client: %v", err)
+	}
+
+	path := filepath.Join(t.TempDir(), "notes.txt")
+	os.WriteFile(path, []byte("hello"), 0644)
+	name := api.RemoteName(path)
+
+	if err := s.execute(ctx, cli, operation{Kind: opUpload, Path: path}); err != nil {
+		t.Fatalf("Failed to upload: %v", err)
+	}
+	if data, ok := server.File(name); !ok || string(data) != "hello" {
+		t.Errorf("Expected %s on the server, got %q", name, data)
+	}
+	if entry, ok := s.store.Get(path); !ok || !entry.Synced() || entry.JobID == "" {
+		t.Errorf("Expected %s to be recorded as synced, got %+v", path, entry)
+	}
+
+	os.Remove(path)
+	if err := s.execute(ctx, cli, operation{Kind: opDelete, Path: path, Name: name}); err != nil {
+		t.Fatalf("Failed to delete: %v", err)
+	}
+	if _, ok := server.File(name); ok {
+		t.Errorf("Expected %s to be deleted from the server", name)
+	}
+	if _, ok := s.store.Get(path); ok {
+		t.Errorf("Expected the sync state of %s to be forgotten", path)
+	}
+
+	// Deleting a file the server no longer has counts as done
+	if err := s.execute(ctx, cli, operation{Kind: opDelete, Path: path, Name: name}); err != nil {
+		t.Errorf("Expected deleting a missing file to succeed, got %v", err)
+	}
+
+	jobs, _ := s.history.List()
+	if len(jobs) != 2 || jobs[0].Op != history.OpUpload || jobs[1].Op != history.OpDelete || jobs[1].Path != path {
+		t.Errorf("Expected an upload and a delete job, got %+v", jobs)
+	}
+}
+
+func TestSyncerCheckJobs(t *testing.T) {
+	s, server := newTestSyncer(t)
+	ctx := context.Background()
+	cli, err := api.NewClient()
+	if err != nil {
+		t.Fatalf("Failed to create client: %v", err)
+	}
+
+	dir := t.TempDir()
+	good, bad := filepath.Join(dir, "good.txt"), filepath.Join(dir, "bad.txt")
+	os.WriteFile(good, []byte("good"), 0644)
+	os.WriteFile(bad, []byte("bad"), 0644)
+
+	if err := s.execute(ctx, cli, operation{Kind: opUpload, Path: good}); err != nil {
+		t.Fatalf("Failed to upload: %v", err)
+	}
+	server.SetJobStatus(apitest.StatusFailed)
+	if err := s.execute(ctx, cli, operation{Kind: opUpload, Path: bad}); err != nil {
+		t.Fatalf("Failed to upload: %v", err)
+	}
+
+	s.checkJobs(ctx)
+
+	if entry, _ := s.store.Get(good); entry.JobStatus != state.JobComplete || !entry.Synced() {
+		t.Errorf("Expected %s to be recorded as indexed, got %+v", good, entry)
+	}
+	entry, _ := s.store.Get(bad)
+	if entry.JobStatus != state.JobFailed || entry.Synced() {
+		t.Errorf("Expected %s to be recorded as failed, got %+v", bad, entry)
+	}
+	jobs, _ := s.history.List()
+	if i := slices.IndexFunc(jobs, func(j history.Job) bool { return j.ID == entry.JobID }); i < 0 || jobs[i].Status != apitest.StatusFailed {
+		t.Errorf("Expected the failed job in the history, got %+v", jobs)
+	}
+
+	// The failed file is uploaded again on the next reconciliation
+	summary, err := s.reconcile(ctx, config.WatchDir{Path: dir, Profile: config.DefaultProfile})
+	if err != nil {
+		t.Fatalf("Failed to reconcile: %v", err)
+	}
+	if summary.Updates != 1 || summary.Unchanged != 1 {
+		t.Errorf("Expected the failed file to be updated, got %+v", summary)
+	}
+}
+
+func TestSyncerReconcile(t *testing.T) {
+	s, server := newTestSyncer(t)
+
+	dir := t.TempDir()
+	os.WriteFile(filepath.Join(dir, "new.txt"), []byte("new"), 0644)
+	os.WriteFile(filepath.Join(dir, ignore.FileName), []byte("*.log\n"), 0644)
+	gone := filepath.Join(dir, "gone.txt")
+	server.PutFile(api.RemoteName(gone), []byte("gone"))
+	s.store.Put(state.Entry{Path: gone, RemoteName: api.RemoteName(gone)})
+	server.PutFile("unrelated.txt", []byte("other"))
+
+	summary, err := s.reconcile(context.Background(), config.WatchDir{Path: dir, Profile: config.DefaultProfile})
+	if err != nil {
+		t.Fatalf("Failed to reconcile: %v", err)
+	}
+	if summary.Uploads != 1 || summary.Deletes != 1 || summary.Updates != 0 {
+		t.Errorf("Expected one upload and one delete, got %+v", summary)
+	}
+
+	ops := s.queue.head(10)
+	if len(ops) != 2 || ops[0].Kind != opUpload || ops[1].Kind != opDelete {
+		t.Errorf("Expected an upload and a delete to be queued, got %+v", ops)
+	}
+}
+
+func TestSyncerUntrackedDelete(t *testing.T) {
+	s, server := newTestSyncer(t)
+	ctx := context.Background()
+	cli, err := api.NewClient()
+	if err != nil {
+		t.Fatalf("Failed to create client: %v", err)
+	}
+
+	// Files uploaded with sfs upload have no sync state, only a job
+	dir := t.TempDir()
+	gone, kept := filepath.Join(dir, "gone.txt"), filepath.Join(dir, "kept.txt")
+	for _, path := range []string{gone, kept} {
+		server.PutFile(api.RemoteName(path), []byte("uploaded"))
+		s.history.Add(history.Job{ID: "job-" + filepath.Base(path), Op: history.OpUpload, Path: path, Name: api.RemoteName(path), Source: history.SourceCLI})
+	}
+
+	s.syncPath(gone)
+	ops := s.queue.head(10)
+	if len(ops) != 1 || ops[0].Kind != opDelete || ops[0].Name != api.RemoteName(gone) {
+		t.Fatalf("Expected a delete of %s to be queued, got %+v", gone, ops)
+	}
+	if err := s.execute(ctx, cli, ops[0]); err != nil {
+		t.Fatalf("Failed to delete: %v", err)
+	}
+	s.queue.done(ops[0].Seq)
+	if _, ok := server.File(api.RemoteName(gone)); ok {
+		t.Errorf("Expected %s to be deleted from the server", gone)
+	}
+
+	// Reconciling finds the other one missing too
+	summary, err := s.reconcile(ctx, config.WatchDir{Path: dir, Profile: config.DefaultProfile})
+	if err != nil {
+		t.Fatalf("Failed to reconcile: %v", err)
+	}
+	if summary.Deletes != 1 {
+		t.Errorf("Expected %s to be deleted, got %+v", kept, summary)
+	}
+	if ops := s.queue.head(10); len(ops) != 1 || ops[0].Name != api.RemoteName(kept) {
+		t.Errorf("Expected a delete of %s to be queued, got %+v", kept, ops)
+	}
+}
+
+func TestSyncerDeleteClaimedName(t *testing.T) {
+	s, _ := newTestSyncer(t)
+
+	// docs/old_a.txt would be stored under the name of docs_old/a.txt
+	parent := t.TempDir()
+	old := filepath.Join(parent, "docs_old", "a.txt")
+	path := filepath.Join(parent, "docs", "old_a.txt")
+	s.store.Put(state.Entry{Path: old, RemoteName: api.RemoteName(path)})
+
+	s.enqueue(operation{Kind: opUpload, Path: path})
+	s.syncPath(path)
+	if ops := s.queue.head(10); len(ops) != 0 {
+		t.Errorf("Expected only the pending upload to be dropped, got %+v", ops)
+	}
+}
+
+func TestSyncerReconcileCoalesced(t *testing.T) {
+	s, _ := newTestSyncer(t)
+
+	// The first pass hangs on listing the index until released
+	var lists atomic.Int32
+	release := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if lists.Add(1) == 1 {
+			<-release
+		}
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprint(w, `{"files": [], "count": 0}`)
+	}))
+	defer server.Close()
+	config.Set("api_url", server.URL)
+
+	s.setWatchDirs([]config.WatchDir{{Path: t.TempDir(), Profile: config.DefaultProfile}})
+	ctx := context.Background()
+	s.requestReconcile(ctx)
+	waitFor(t, func() bool { return lists.Load() == 1 })
+
+	// Reloads during the pass add up to a single follow-up pass
+	for range 3 {
+		s.requestReconcile(ctx)
+	}
+	close(release)
+	waitFor(t, func() bool {
+		s.reconcileMutex.Lock()
+		defer s.reconcileMutex.Unlock()
+		return !s.reconciling
+	})
+	if n := lists.Load(); n != 2 {
+		t.Errorf("Expected 2 reconciliation passes, got %d", n)
+	}
+}
+
+// waitFor polls cond until it holds, failing the test after a few seconds
+func waitFor(t *testing.T, cond func() bool) {
+	t.Helper()
+	for deadline := time.Now().Add(5 * time.Second); !cond(); {
+		if time.Now().After(deadline) {
+			t.Fatal("Timed out waiting")
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestSyncerSiblingDirs(t *testing.T) {
+	s, server := newTestSyncer(t)
+	ctx := context.Background()
+	cli, err := api.NewClient()
+	if err != nil {
+		t.Fatalf("Failed to create client: %v", err)
+	}
+
+	// docs_old files share the server-side prefix of docs
+	parent := t.TempDir()
+	docs, docsOld := filepath.Join(parent, "docs"), filepath.Join(parent, "docs_old")
+	os.Mkdir(docs, 0755)
+	os.Mkdir(docsOld, 0755)
+	old := filepath.Join(docsOld, "a.txt")
+	os.WriteFile(old, []byte("old"), 0644)
+	if err := s.execute(ctx, cli, operation{Kind: opUpload, Path: old}); err != nil {
+		t.Fatalf("Failed to upload: %v", err)
+	}
+	// Nor is an untracked file under the prefix ever deleted
+	server.PutFile(api.RemoteName(docs)+"_untracked.txt", []byte("other"))
+
+	summary, err := s.reconcile(ctx, config.WatchDir{Path: docs, Profile: config.DefaultProfile})
+	if err != nil {
+		t.Fatalf("Failed to reconcile: %v", err)
+	}
+	if summary.Deletes != 0 || s.queue.len() != 0 {
+		t.Errorf("Expected nothing to be deleted, got %+v and %+v", summary, s.queue.head(10))
+	}
+
+	if err := s.removeDir(ctx, cli, docs, config.DefaultProfile); err != nil {
+		t.Fatalf("Failed to remove directory: %v", err)
+	}
+	if ops := s.queue.head(10); len(ops) != 0 {
+		t.Errorf("Expected removing docs to leave docs_old alone, got %+v", ops)
+	}
+}
+
+func TestSyncerProfiles(t *testing.T) {
+	s, server := newTestSyncer(t)
+
+	team := apitest.NewServer()
+	defer team.Close()
+	if err := config.AddProfile("team", team.URL); err != nil {
+		t.Fatalf("Failed to add profile: %v", err)
+	}
+	config.SelectProfile("team")
+	defer config.SelectProfile("")
+	config.Set("api_key", apitest.APIKey)
+
+	personal, shared := t.TempDir(), t.TempDir()
+	nested := filepath.Join(personal, "team")
+	s.setWatchDirs([]config.WatchDir{
+		{Path: personal, Profile: config.DefaultProfile},
+		{Path: shared, Profile: "team"},
+		{Path: nested, Profile: "team"},
+	})
+
+	tests := map[string]string{
+		filepath.Join(personal, "a.txt"):        config.DefaultProfile,
+		filepath.Join(shared, "sub", "b.txt"):   "team",
+		filepath.Join(nested, "c.txt"):          "team",
+		filepath.Join(t.TempDir(), "other.txt"): config.DefaultProfile,
+	}
+	for path, want := range tests {
+		if got := s.profileFor(path); got != want {
+			t.Errorf("profileFor(%s) = %s, expected %s", path, got, want)
+		}
+	}
+
+	// Each operation is sent to the server of its profile
+	path := filepath.Join(shared, "b.txt")
+	os.WriteFile(path, []byte("team notes"), 0644)
+	s.syncPath(path)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		s.drain(ctx)
+		close(done)
+	}()
+	deadline := time.Now().Add(5 * time.Second)
+	for s.queue.len() > 0 && time.Now().Before(deadline) {
+		time.Sleep(5 * time.Millisecond)
+	}
+	cancel()
+	<-done
+
+	if _, ok := team.File(api.RemoteName(path)); !ok {
+		t.Errorf("Expected %s on the team server", path)
+	}
+	if files := server.Files(); len(files) != 0 {
+		t.Errorf("Expected nothing on the default server, got %v", files)
+	}
+
+	jobs, _ := s.history.List()
+	if len(jobs) != 1 || jobs[0].Profile != "team" {
+		t.Errorf("Expected one job for the team profile, got %+v", jobs)
+	}
+}
+
+func TestOneshot(t *testing.T) {
+	_, server := newTestSyncer(t)
+	ctx := context.Background()
+
+	dir := t.TempDir()
+	path := filepath.Join(dir, "new.txt")
+	os.WriteFile(path, []byte("new"), 0644)
+	gone := api.RemoteName(filepath.Join(dir, "gone.txt"))
+	server.PutFile(gone, []byte("gone"))
+
+	watched := config.WatchDir{Path: dir, Profile: config.DefaultProfile}
+	jobLog, _ := history.OpenDefault()
+	oneshot, err := NewOneshot([]config.WatchDir{watched}, jobLog)
+	if err != nil {
+		t.Fatalf("Failed to create one-shot sync: %v", err)
+	}
+	oneshot.s.store.Put(state.Entry{Path: filepath.Join(dir, "gone.txt"), RemoteName: gone})
+
+	plan, err := oneshot.Plan(ctx, watched)
+	if err != nil {
+		t.Fatalf("Failed to plan: %v", err)
+	}
+	if len(plan.Changes) != 2 || plan.Changes[0].Kind != ChangeUpload || plan.Changes[1].Kind != ChangeDelete {
+		t.Fatalf("Expected an upload and a delete, got %+v", plan.Changes)
+	}
+	if files := server.Files(); len(files) != 1 {
+		t.Errorf("Expected planning to leave the server alone, got %v", files)
+	}
+
+	var done []Change
+	errs := oneshot.Apply(ctx, plan, pool.Options{Workers: 1}, func(c Change, err error) {
+		done = append(done, c)
+	})
+	for _, err := range errs {
+		if err != nil {
+			t.Errorf("Failed to apply change: %v", err)
+		}
+	}
+	if len(done) != 2 {
+		t.Errorf("Expected to be told about both changes, got %+v", done)
+	}
+	if _, ok := server.File(api.RemoteName(path)); !ok {
+		t.Errorf("Expected %s on the server", path)
+	}
+	if _, ok := server.File(gone); ok {
+		t.Errorf("Expected %s to be deleted from the server", gone)
+	}
+
+	jobs, _ := oneshot.s.history.List()
+	if len(jobs) != 2 || jobs[0].Source != history.SourceCLI {
+		t.Errorf("Expected two jobs submitted by the CLI, got %+v", jobs)
+	}
+
+	// Once synced, there is nothing left to do
+	plan, err = oneshot.Plan(ctx, watched)
+	if err != nil {
+		t.Fatalf("Failed to plan: %v", err)
+	}
+	if len(plan.Changes) != 0 || plan.Unchanged != 1 {
+		t.Errorf("Expected nothing to change, got %+v", plan)
+	}
+}
+
+func TestOneshotDryRunSiblingDirs(t *testing.T) {
+	_, server := newTestSyncer(t)
+	ctx := context.Background()
+
+	// docs_old was synced, docs has nothing yet
+	parent := t.TempDir()
+	docs, docsOld := filepath.Join(parent, "docs"), filepath.Join(parent, "docs_old")
+	os.Mkdir(docs, 0755)
+	os.Mkdir(docsOld, 0755)
+	os.WriteFile(filepath.Join(docsOld, "a.txt"), []byte("old"), 0644)
+
+	dirs := []config.WatchDir{
+		{Path: docs, Profile: config.DefaultProfile},
+		{Path: docsOld, Profile: config.DefaultProfile},
+	}
+	oneshot, err := NewOneshot(dirs, nil)
+	if err != nil {
+		t.Fatalf("Failed to create one-shot sync: %v", err)
+	}
+	plan, err := oneshot.Plan(ctx, dirs[1])
+	if err != nil {
+		t.Fatalf("Failed to plan: %v", err)
+	}
+	oneshot.Apply(ctx, plan, pool.Options{Workers: 1}, nil)
+
+	// Planning docs, as sync --dry-run does, must not pick up docs_old
+	plan, err = oneshot.Plan(ctx, dirs[0])
+	if err != nil {
+		t.Fatalf("Failed to plan: %v", err)
+	}
+	if len(plan.Changes) != 0 {
+		t.Errorf("Expected no changes to docs, got %+v", plan.Changes)
+	}
+	if files := server.Files(); len(files) != 1 {
+		t.Errorf("Expected docs_old/a.txt to stay on the server, got %v", files)
+	}
+}
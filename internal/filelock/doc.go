@@ -0,0 +1,4 @@
+// Package filelock serializes access to files shared by the CLI and the
+// daemon. Appends and compactions of the same file take the same lock, so a
+// compaction never drops lines appended while it runs.
+package filelock
@@ -0,0 +1,342 @@
+package history
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/ThiagoAVicente/sfs-cli/internal/api"
+	"github.com/ThiagoAVicente/sfs-cli/internal/config"
+	"github.com/ThiagoAVicente/sfs-cli/internal/filelock"
+)
+
+// FileName is the name of the job history file inside the config directory
+const FileName = "history.jsonl"
+
+// MaxJobs is the number of most recent jobs kept when the history is compacted
+const MaxJobs = 10000
+
+// Operations that submit a job
+const (
+	OpUpload = "upload"
+	OpDelete = "delete"
+)
+
+// Sources of a job
+const (
+	SourceCLI    = "cli"
+	SourceDaemon = "daemon"
+)
+
+// StatusSubmitted is the status of a job whose outcome isn't known yet
+const StatusSubmitted = "submitted"
+
+// Job is a recorded indexing job
+type Job struct {
+	ID            string    `json:"id"`
+	Op            string    `json:"op,omitempty"`
+	Path          string    `json:"path,omitempty"`
+	Name          string    `json:"name,omitempty"`
+	Source        string    `json:"source,omitempty"`
+	Profile       string    `json:"profile,omitempty"`
+	Status        string    `json:"status,omitempty"`
+	SubmittedAt   time.Time `json:"submitted_at,omitzero"`
+	UpdatedAt     time.Time `json:"updated_at,omitzero"`
+	ResubmittedAs string    `json:"resubmitted_as,omitempty"`
+}
+
+// Pending reports whether the job's final status is still unknown
+func (j Job) Pending() bool {
+	return !api.IsTerminalStatus(j.Status)
+}
+
+// ProfileName returns the profile the job was submitted to. Jobs recorded
+// before profiles existed belong to the default profile.
+func (j Job) ProfileName() string {
+	if j.Profile == "" {
+		return config.DefaultProfile
+	}
+	return j.Profile
+}
+
+// Failed reports whether the job finished unsuccessfully
+func (j Job) Failed() bool {
+	return api.IsFailedStatus(j.Status)
+}
+
+// merge applies the non-empty fields of patch to j
+func (j *Job) merge(patch Job) {
+	if patch.Op != "" {
+		j.Op = patch.Op
+	}
+	if patch.Path != "" {
+		j.Path = patch.Path
+	}
+	if patch.Name != "" {
+		j.Name = patch.Name
+	}
+	if patch.Source != "" {
+		j.Source = patch.Source
+	}
+	if patch.Profile != "" {
+		j.Profile = patch.Profile
+	}
+	if patch.Status != "" {
+		j.Status = patch.Status
+	}
+	if !patch.SubmittedAt.IsZero() {
+		j.SubmittedAt = patch.SubmittedAt
+	}
+	if !patch.UpdatedAt.IsZero() {
+		j.UpdatedAt = patch.UpdatedAt
+	}
+	if patch.ResubmittedAs != "" {
+		j.ResubmittedAs = patch.ResubmittedAs
+	}
+}
+
+// Log is an append-only JSON-lines history of submitted jobs.
+//
+// New jobs and later status changes are appended as lines, so the CLI and the
+// daemon can record jobs in the same file without coordinating. Reading the
+// history folds the lines back into one record per job and never changes the
+// file; only Compact rewrites it, which the daemon does when it starts and,
+// with AutoCompact, every MaxJobs lines. A nil Log records nothing.
+type Log struct {
+	mu   sync.Mutex
+	path string
+	// appended counts the lines written since the file was last compacted
+	appended    int
+	autoCompact bool
+}
+
+// DefaultPath returns the history file path inside the config directory
+func DefaultPath() (string, error) {
+	configDir, err := config.GetConfigDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(configDir, FileName), nil
+}
+
+// OpenDefault opens the history at DefaultPath
+func OpenDefault() (*Log, error) {
+	path, err := DefaultPath()
+	if err != nil {
+		return nil, err
+	}
+	return Open(path)
+}
+
+// Open returns the history stored at path, creating its directory if needed
+func Open(path string) (*Log, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return nil, fmt.Errorf("failed to create history directory: %w", err)
+	}
+	return &Log{path: path}, nil
+}
+
+// Add records a newly submitted job
+func (l *Log) Add(job Job) error {
+	if job.SubmittedAt.IsZero() {
+		job.SubmittedAt = time.Now()
+	}
+	if job.Status == "" {
+		job.Status = StatusSubmitted
+	}
+	return l.append(job)
+}
+
+// Update records changes to a job, such as its latest status. Only the
+// non-empty fields of patch are applied.
+func (l *Log) Update(patch Job) error {
+	if patch.UpdatedAt.IsZero() {
+		patch.UpdatedAt = time.Now()
+	}
+	return l.append(patch)
+}
+
+// List returns the MaxJobs most recent jobs, oldest first
+func (l *Log) List() ([]Job, error) {
+	if l == nil {
+		return nil, nil
+	}
+	jobs, _, err := load(l.path)
+	return jobs, err
+}
+
+// AutoCompact makes the log compact the file after every MaxJobs lines it
+// appends
+func (l *Log) AutoCompact() {
+	if l == nil {
+		return
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.autoCompact = true
+}
+
+// Compact rewrites the history file with one line per job, dropping jobs
+// beyond the MaxJobs most recent. The file is read again under a lock that
+// keeps other processes from appending meanwhile, so nothing they recorded
+// is lost.
+func (l *Log) Compact() error {
+	if l == nil {
+		return nil
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.compact()
+}
+
+// load folds the history file at path into the MaxJobs most recent jobs,
+// oldest first, and returns them with the number of lines read
+func load(path string) ([]Job, int, error) {
+	file, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return nil, 0, nil
+	}
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to open history: %w", err)
+	}
+	defer file.Close()
+
+	jobs := make(map[string]*Job)
+	lines := 0
+
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		var patch Job
+		if err := json.Unmarshal(scanner.Bytes(), &patch); err != nil || patch.ID == "" {
+			// A torn final line from a crash is not worth failing over
+			continue
+		}
+		lines++
+
+		if job, ok := jobs[patch.ID]; ok {
+			job.merge(patch)
+		} else {
+			jobs[patch.ID] = &patch
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, 0, fmt.Errorf("failed to read history: %w", err)
+	}
+
+	list := make([]Job, 0, len(jobs))
+	for _, job := range jobs {
+		// Status updates for jobs that were never added aren't worth listing
+		if job.Op != "" {
+			list = append(list, *job)
+		}
+	}
+	sort.SliceStable(list, func(i, j int) bool {
+		return list[i].SubmittedAt.Before(list[j].SubmittedAt)
+	})
+
+	if len(list) > MaxJobs {
+		list = list[len(list)-MaxJobs:]
+	}
+	return list, lines, nil
+}
+
+// append writes a single line to the end of the history file
+func (l *Log) append(job Job) error {
+	if l == nil {
+		return nil
+	}
+
+	line, err := json.Marshal(job)
+	if err != nil {
+		return fmt.Errorf("failed to encode history: %w", err)
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if err := l.write(line); err != nil {
+		return err
+	}
+	l.appended++
+	if l.autoCompact && l.appended >= MaxJobs {
+		// The job is already recorded and a failed compaction leaves the
+		// file as it was, so it is simply tried again on a later append
+		l.compact()
+	}
+	return nil
+}
+
+// write appends line to the history file under the lock. Callers must hold
+// mu.
+func (l *Log) write(line []byte) error {
+	unlock, err := filelock.Lock(l.path + ".lock")
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	file, err := os.OpenFile(l.path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+	if err != nil {
+		return fmt.Errorf("failed to open history: %w", err)
+	}
+	defer file.Close()
+
+	if _, err := file.Write(append(line, '\n')); err != nil {
+		return fmt.Errorf("failed to write history: %w", err)
+	}
+	return nil
+}
+
+// compact rewrites the history file with one line per job, as read again
+// under the lock. Callers must hold mu.
+func (l *Log) compact() error {
+	unlock, err := filelock.Lock(l.path + ".lock")
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	jobs, lines, err := load(l.path)
+	if err != nil {
+		return err
+	}
+	if lines == 0 {
+		// Nothing recorded yet, so there is no file to rewrite
+		return nil
+	}
+
+	tmpPath := l.path + ".tmp"
+	file, err := os.OpenFile(tmpPath, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0600)
+	if err != nil {
+		return fmt.Errorf("failed to create history: %w", err)
+	}
+
+	writer := bufio.NewWriter(file)
+	encoder := json.NewEncoder(writer)
+	for _, job := range jobs {
+		if err := encoder.Encode(job); err != nil {
+			file.Close()
+			return fmt.Errorf("failed to write history: %w", err)
+		}
+	}
+
+	if err := writer.Flush(); err != nil {
+		file.Close()
+		return fmt.Errorf("failed to write history: %w", err)
+	}
+	if err := file.Close(); err != nil {
+		return fmt.Errorf("failed to write history: %w", err)
+	}
+
+	if err := os.Rename(tmpPath, l.path); err != nil {
+		return fmt.Errorf("failed to replace history: %w", err)
+	}
+	l.appended = 0
+	return nil
+}
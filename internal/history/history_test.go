@@ -0,0 +1,181 @@
+package history
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestAddAndUpdate(t *testing.T) {
+	l, err := Open(filepath.Join(t.TempDir(), FileName))
+	if err != nil {
+		t.Fatalf("Failed to open history: %v", err)
+	}
+
+	if err := l.Add(Job{ID: "job-1", Op: OpUpload, Path: "/tmp/a.txt", Name: "tmp_a.txt", Source: SourceCLI}); err != nil {
+		t.Fatalf("Failed to add job: %v", err)
+	}
+	if err := l.Add(Job{ID: "job-2", Op: OpDelete, Name: "tmp_b.txt", Source: SourceDaemon}); err != nil {
+		t.Fatalf("Failed to add job: %v", err)
+	}
+	if err := l.Update(Job{ID: "job-1", Status: "failed"}); err != nil {
+		t.Fatalf("Failed to update job: %v", err)
+	}
+
+	jobs, err := l.List()
+	if err != nil {
+		t.Fatalf("Failed to list jobs: %v", err)
+	}
+	if len(jobs) != 2 {
+		t.Fatalf("Expected 2 jobs, got %d", len(jobs))
+	}
+
+	first := jobs[0]
+	if first.ID != "job-1" || first.Path != "/tmp/a.txt" || first.Source != SourceCLI {
+		t.Errorf("Expected update to keep the original fields, got %+v", first)
+	}
+	if !first.Failed() || first.Pending() || first.UpdatedAt.IsZero() {
+		t.Errorf("Expected job-1 to be failed, got %+v", first)
+	}
+
+	if second := jobs[1]; second.Status != StatusSubmitted || !second.Pending() {
+		t.Errorf("Expected job-2 to be pending, got %+v", second)
+	}
+}
+
+func TestUpdateUnknownJob(t *testing.T) {
+	l, err := Open(filepath.Join(t.TempDir(), FileName))
+	if err != nil {
+		t.Fatalf("Failed to open history: %v", err)
+	}
+
+	l.Add(Job{ID: "job-1", Op: OpUpload, Name: "a.txt"})
+	l.Update(Job{ID: "job-1", ResubmittedAs: "job-2"})
+
+	// Updates for jobs that were never added are ignored
+	l.Update(Job{ID: "unknown", Status: "complete"})
+
+	jobs, err := l.List()
+	if err != nil {
+		t.Fatalf("Failed to list jobs: %v", err)
+	}
+	if len(jobs) != 1 || jobs[0].ID != "job-1" {
+		t.Fatalf("Expected only job-1 to be listed, got %+v", jobs)
+	}
+	if jobs[0].ResubmittedAs != "job-2" {
+		t.Errorf("Expected job-1 to be resubmitted as job-2, got %+v", jobs[0])
+	}
+}
+
+func TestListOrder(t *testing.T) {
+	l, err := Open(filepath.Join(t.TempDir(), FileName))
+	if err != nil {
+		t.Fatalf("Failed to open history: %v", err)
+	}
+
+	now := time.Now()
+	l.Add(Job{ID: "late", Op: OpUpload, SubmittedAt: now})
+	l.Add(Job{ID: "early", Op: OpUpload, SubmittedAt: now.Add(-time.Hour)})
+
+	jobs, _ := l.List()
+	if len(jobs) != 2 || jobs[0].ID != "early" || jobs[1].ID != "late" {
+		t.Errorf("Expected jobs oldest first, got %+v", jobs)
+	}
+}
+
+func TestCompact(t *testing.T) {
+	path := filepath.Join(t.TempDir(), FileName)
+
+	file, err := os.Create(path)
+	if err != nil {
+		t.Fatalf("Failed to create history: %v", err)
+	}
+	writer := bufio.NewWriter(file)
+	encoder := json.NewEncoder(writer)
+	start := time.Now().Add(-time.Hour)
+	for i := range 2*MaxJobs + 1 {
+		encoder.Encode(Job{ID: fmt.Sprintf("job-%d", i), Op: OpUpload, SubmittedAt: start.Add(time.Duration(i) * time.Millisecond)})
+	}
+	writer.Flush()
+	file.Close()
+
+	l, _ := Open(path)
+	jobs, err := l.List()
+	if err != nil {
+		t.Fatalf("Failed to list jobs: %v", err)
+	}
+	if len(jobs) != MaxJobs {
+		t.Fatalf("Expected %d jobs, got %d", MaxJobs, len(jobs))
+	}
+	if last := jobs[len(jobs)-1].ID; last != fmt.Sprintf("job-%d", 2*MaxJobs) {
+		t.Errorf("Expected the most recent jobs to be listed, last is %s", last)
+	}
+
+	// Reading leaves the file alone
+	if lines := countLines(t, path); lines != 2*MaxJobs+1 {
+		t.Errorf("Expected List not to change the file, got %d lines", lines)
+	}
+
+	// A job recorded by another process before compacting is kept
+	other, _ := Open(path)
+	other.Add(Job{ID: "other", Op: OpDelete})
+
+	if err := l.Compact(); err != nil {
+		t.Fatalf("Failed to compact history: %v", err)
+	}
+	jobs, _ = l.List()
+	if lines := countLines(t, path); lines != MaxJobs || len(jobs) != MaxJobs {
+		t.Errorf("Expected %d lines after compaction, got %d", MaxJobs, lines)
+	}
+	if last := jobs[len(jobs)-1].ID; last != "other" {
+		t.Errorf("Expected the job added by the other process to be kept, last is %s", last)
+	}
+}
+
+func TestAutoCompact(t *testing.T) {
+	path := filepath.Join(t.TempDir(), FileName)
+	l, _ := Open(path)
+	l.AutoCompact()
+
+	l.Add(Job{ID: "job-1", Op: OpUpload})
+	for range MaxJobs - 1 {
+		l.Update(Job{ID: "job-1", Status: "processing"})
+	}
+
+	if lines := countLines(t, path); lines != 1 {
+		t.Errorf("Expected the file to be compacted to 1 line, got %d", lines)
+	}
+	if jobs, _ := l.List(); len(jobs) != 1 || jobs[0].Status != "processing" {
+		t.Errorf("Expected job-1 to survive compaction, got %+v", jobs)
+	}
+}
+
+// countLines returns the number of lines in the file at path
+func countLines(t *testing.T, path string) int {
+	t.Helper()
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("Failed to read history: %v", err)
+	}
+	lines := 0
+	for _, b := range data {
+		if b == '\n' {
+			lines++
+		}
+	}
+	return lines
+}
+
+func TestNilLog(t *testing.T) {
+	var l *Log
+	if err := l.Add(Job{ID: "job-1", Op: OpUpload}); err != nil {
+		t.Errorf("Expected nil log to ignore jobs, got %v", err)
+	}
+	if jobs, err := l.List(); err != nil || len(jobs) != 0 {
+		t.Errorf("Expected nil log to be empty, got %v, %v", jobs, err)
+	}
+}
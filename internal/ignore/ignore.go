@@ -0,0 +1,240 @@
+package ignore
+
+import (
+	"bufio"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/ThiagoAVicente/sfs-cli/internal/config"
+)
+
+// FileName is the name of per-directory ignore files
+const FileName = ".sfsignore"
+
+// pattern is a single parsed ignore rule
+type pattern struct {
+	segments []string
+	negate   bool
+	dirOnly  bool
+	anchored bool
+}
+
+// parsePattern parses one line of an ignore file using gitignore syntax.
+// It returns false for blank lines and comments.
+func parsePattern(line string) (pattern, bool) {
+	var p pattern
+
+	// Trailing spaces are ignored unless escaped
+	for strings.HasSuffix(line, " ") && !strings.HasSuffix(line, "\\ ") {
+		line = line[:len(line)-1]
+	}
+	if line == "" || strings.HasPrefix(line, "#") {
+		return p, false
+	}
+
+	if strings.HasPrefix(line, "!") {
+		p.negate = true
+		line = line[1:]
+	} else if strings.HasPrefix(line, "\\!") || strings.HasPrefix(line, "\\#") {
+		line = line[1:]
+	}
+
+	if strings.HasSuffix(line, "/") {
+		p.dirOnly = true
+		line = strings.TrimRight(line, "/")
+	}
+
+	// A slash anywhere but the end anchors the pattern to its directory
+	if strings.Contains(line, "/") {
+		p.anchored = true
+		line = strings.TrimPrefix(line, "/")
+	}
+
+	if line == "" {
+		return p, false
+	}
+
+	p.segments = strings.Split(line, "/")
+	return p, true
+}
+
+// match reports whether rel, a slash-separated path relative to the
+// directory the pattern was defined in, matches the pattern
+func (p pattern) match(rel string, isDir bool) bool {
+	if p.dirOnly && !isDir {
+		return false
+	}
+
+	if !p.anchored {
+		ok, _ := path.Match(p.segments[0], path.Base(rel))
+		return ok
+	}
+
+	return matchSegments(p.segments, strings.Split(rel, "/"))
+}
+
+// matchSegments matches path components against pattern segments, where a
+// "**" segment matches any number of components
+func matchSegments(segments, parts []string) bool {
+	if len(segments) == 0 {
+		return len(parts) == 0
+	}
+
+	if segments[0] == "**" {
+		// A trailing "**" matches everything inside, but not the directory itself
+		if len(segments) == 1 {
+			return len(parts) > 0
+		}
+		for i := 0; i <= len(parts); i++ {
+			if matchSegments(segments[1:], parts[i:]) {
+				return true
+			}
+		}
+		return false
+	}
+
+	if len(parts) == 0 {
+		return false
+	}
+	if ok, _ := path.Match(segments[0], parts[0]); !ok {
+		return false
+	}
+	return matchSegments(segments[1:], parts[1:])
+}
+
+// parseLines parses every pattern in lines
+func parseLines(lines []string) []pattern {
+	var patterns []pattern
+	for _, line := range lines {
+		if p, ok := parsePattern(line); ok {
+			patterns = append(patterns, p)
+		}
+	}
+	return patterns
+}
+
+// Matcher decides whether paths under a set of root directories are ignored.
+//
+// Global patterns apply relative to each root. Every directory may add its own
+// .sfsignore file whose patterns apply relative to that directory and take
+// precedence over those of its parents. As in git, a file inside an ignored
+// directory can't be re-included.
+type Matcher struct {
+	roots  []string
+	global []pattern
+
+	mu    sync.Mutex
+	files map[string][]pattern
+}
+
+// New creates a matcher for paths under roots with the given global patterns
+func New(roots []string, globalPatterns []string) *Matcher {
+	m := &Matcher{
+		global: parseLines(globalPatterns),
+		files:  make(map[string][]pattern),
+	}
+
+	for _, root := range roots {
+		if absRoot, err := filepath.Abs(root); err == nil {
+			m.roots = append(m.roots, absRoot)
+		}
+	}
+	return m
+}
+
+// Root returns the most specific root containing path
+func (m *Matcher) Root(path string) (string, bool) {
+	if m == nil {
+		return "", false
+	}
+
+	best := ""
+	for _, root := range m.roots {
+		if config.Within(root, path) && len(root) > len(best) {
+			best = root
+		}
+	}
+	return best, best != ""
+}
+
+// Ignored reports whether path, or any directory between it and its root,
+// is ignored. Paths outside every root are never ignored. A nil matcher
+// ignores nothing.
+func (m *Matcher) Ignored(path string, isDir bool) bool {
+	root, ok := m.Root(path)
+	if !ok {
+		return false
+	}
+
+	rel, err := filepath.Rel(root, path)
+	if err != nil || rel == "." {
+		return false
+	}
+
+	parts := strings.Split(filepath.ToSlash(rel), "/")
+	for i := range parts {
+		current := filepath.Join(root, filepath.Join(parts[:i+1]...))
+		if m.matches(root, current, isDir || i < len(parts)-1) {
+			return true
+		}
+	}
+	return false
+}
+
+// matches applies the global patterns and every ignore file from root down
+// to the parent of path; the last matching pattern decides
+func (m *Matcher) matches(root, path string, isDir bool) bool {
+	ignored := false
+	apply := func(patterns []pattern, base string) {
+		rel, err := filepath.Rel(base, path)
+		if err != nil {
+			return
+		}
+		rel = filepath.ToSlash(rel)
+		for _, p := range patterns {
+			if p.match(rel, isDir) {
+				ignored = !p.negate
+			}
+		}
+	}
+
+	apply(m.global, root)
+
+	dir := root
+	apply(m.load(dir), dir)
+
+	if rel, err := filepath.Rel(root, filepath.Dir(path)); err == nil && rel != "." {
+		for _, part := range strings.Split(filepath.ToSlash(rel), "/") {
+			dir = filepath.Join(dir, part)
+			apply(m.load(dir), dir)
+		}
+	}
+
+	return ignored
+}
+
+// load returns the parsed ignore file of dir, reading it on first use
+func (m *Matcher) load(dir string) []pattern {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if patterns, ok := m.files[dir]; ok {
+		return patterns
+	}
+
+	var lines []string
+	if file, err := os.Open(filepath.Join(dir, FileName)); err == nil {
+		scanner := bufio.NewScanner(file)
+		for scanner.Scan() {
+			lines = append(lines, scanner.Text())
+		}
+		file.Close()
+	}
+
+	patterns := parseLines(lines)
+	m.files[dir] = patterns
+	return patterns
+}
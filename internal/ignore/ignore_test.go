@@ -0,0 +1,163 @@
+package ignore
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func writeIgnoreFile(t *testing.T, dir, content string) {
+	t.Helper()
+
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		t.Fatalf("Failed to create directory: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, FileName), []byte(content), 0644); err != nil {
+		t.Fatalf("Failed to write ignore file: %v", err)
+	}
+}
+
+func TestPatternMatch(t *testing.T) {
+	tests := []struct {
+		pattern  string
+		path     string
+		isDir    bool
+		expected bool
+	}{
+		{pattern: "*.log", path: "debug.log", expected: true},
+		{pattern: "*.log", path: "logs/debug.log", expected: true},
+		{pattern: "*.log", path: "debug.txt", expected: false},
+		{pattern: "build/", path: "build", isDir: true, expected: true},
+		{pattern: "build/", path: "build", isDir: false, expected: false},
+		{pattern: "/todo.txt", path: "todo.txt", expected: true},
+		{pattern: "/todo.txt", path: "notes/todo.txt", expected: false},
+		{pattern: "docs/*.md", path: "docs/readme.md", expected: true},
+		{pattern: "docs/*.md", path: "docs/sub/readme.md", expected: false},
+		{pattern: "**/secrets", path: "a/b/secrets", expected: true},
+		{pattern: "**/secrets", path: "secrets", expected: true},
+		{pattern: "a/**/b", path: "a/b", expected: true},
+		{pattern: "a/**/b", path: "a/x/y/b", expected: true},
+		{pattern: "out/**", path: "out/file.bin", expected: true},
+		{pattern: "out/**", path: "out", isDir: true, expected: false},
+		{pattern: "file?.txt", path: "file1.txt", expected: true},
+		{pattern: "\\#hash", path: "#hash", expected: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.pattern+" "+tt.path, func(t *testing.T) {
+			p, ok := parsePattern(tt.pattern)
+			if !ok {
+				t.Fatalf("Failed to parse pattern %q", tt.pattern)
+			}
+			if got := p.match(tt.path, tt.isDir); got != tt.expected {
+				t.Errorf("Expected match=%v, got %v", tt.expected, got)
+			}
+		})
+	}
+}
+
+func TestParsePatternSkipsCommentsAndBlanks(t *testing.T) {
+	for _, line := range []string{"", "   ", "# comment", "/"} {
+		if _, ok := parsePattern(line); ok {
+			t.Errorf("Expected %q to be skipped", line)
+		}
+	}
+
+	p, ok := parsePattern("!keep.log  ")
+	if !ok || !p.negate || p.segments[0] != "keep.log" {
+		t.Errorf("Unexpected negated pattern: %+v", p)
+	}
+}
+
+func TestMatcherGlobalPatterns(t *testing.T) {
+	root := t.TempDir()
+	m := New([]string{root}, []string{"node_modules/", "*.tmp"})
+
+	tests := []struct {
+		path     string
+		isDir    bool
+		expected bool
+	}{
+		{path: "node_modules", isDir: true, expected: true},
+		{path: "node_modules/pkg/index.js", expected: true},
+		{path: "src/node_modules/pkg/index.js", expected: true},
+		{path: "src/cache.tmp", expected: true},
+		{path: "src/main.go", expected: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			if got := m.Ignored(filepath.Join(root, tt.path), tt.isDir); got != tt.expected {
+				t.Errorf("Expected ignored=%v, got %v", tt.expected, got)
+			}
+		})
+	}
+
+	// Paths outside every root and the root itself are never ignored
+	if m.Ignored("/elsewhere/file.tmp", false) {
+		t.Error("Expected path outside root not to be ignored")
+	}
+	if m.Ignored(root, true) {
+		t.Error("Expected root not to be ignored")
+	}
+}
+
+func TestMatcherNestedFiles(t *testing.T) {
+	root := t.TempDir()
+	writeIgnoreFile(t, root, "*.log\nbuild/\n")
+	writeIgnoreFile(t, filepath.Join(root, "app"), "!important.log\n/local.txt\n")
+
+	m := New([]string{root}, nil)
+
+	tests := []struct {
+		path     string
+		isDir    bool
+		expected bool
+	}{
+		{path: "debug.log", expected: true},
+		{path: "app/debug.log", expected: true},
+		{path: "app/important.log", expected: false},
+		{path: "important.log", expected: true},
+		{path: "app/local.txt", expected: true},
+		{path: "app/sub/local.txt", expected: false},
+		{path: "local.txt", expected: false},
+		{path: "build/output.bin", expected: true},
+		{path: "app/main.go", expected: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			if got := m.Ignored(filepath.Join(root, tt.path), tt.isDir); got != tt.expected {
+				t.Errorf("Expected ignored=%v, got %v", tt.expected, got)
+			}
+		})
+	}
+}
+
+func TestMatcherCannotReincludeInsideIgnoredDir(t *testing.T) {
+	root := t.TempDir()
+	writeIgnoreFile(t, root, "vendor/\n!vendor/keep.txt\n")
+
+	m := New([]string{root}, nil)
+	if !m.Ignored(filepath.Join(root, "vendor", "keep.txt"), false) {
+		t.Error("Expected file inside ignored directory to stay ignored")
+	}
+}
+
+func TestMatcherRoot(t *testing.T) {
+	m := New([]string{"/data", "/data/docs"}, nil)
+
+	root, ok := m.Root("/data/docs/notes.txt")
+	if !ok || root != "/data/docs" {
+		t.Errorf("Expected most specific root /data/docs, got %q", root)
+	}
+
+	if _, ok := m.Root("/data_other/notes.txt"); ok {
+		t.Error("Expected sibling directory not to be under /data")
+	}
+
+	var nilMatcher *Matcher
+	if nilMatcher.Ignored("/data/file", false) {
+		t.Error("Expected nil matcher to ignore nothing")
+	}
+}
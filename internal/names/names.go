@@ -0,0 +1,150 @@
+// Package names maps between local paths and the names files are stored
+// under on the server.
+package names
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/ThiagoAVicente/sfs-cli/internal/api"
+	"github.com/ThiagoAVicente/sfs-cli/internal/config"
+	"github.com/ThiagoAVicente/sfs-cli/internal/history"
+	"github.com/ThiagoAVicente/sfs-cli/internal/state"
+)
+
+// Where a Mapping comes from
+const (
+	// SourceState is a file the daemon synced, from the sync state
+	SourceState = "sync state"
+	// SourceUpload is a file uploaded from the command line, with sfs upload
+	// or sfs sync, from the job history
+	SourceUpload = "upload"
+	// SourceDaemon is a file the daemon uploaded, from the job history
+	SourceDaemon = "daemon"
+	// SourceDerived is a local path that hasn't been seen uploaded; its name
+	// is what an upload would use
+	SourceDerived = "derived"
+	// SourceUnknown is a server-side name whose local path isn't known
+	SourceUnknown = "unknown"
+)
+
+// Mapping pairs a local path with the name its file is stored under on the
+// server
+type Mapping struct {
+	// Path is the absolute local path, or "" if it isn't known
+	Path   string `json:"path"`
+	Name   string `json:"name"`
+	Source string `json:"source"`
+}
+
+// Map maps between local paths and server-side names.
+//
+// Uploads store a file under api.RemoteName(path), which flattens the path
+// and can't be undone by itself, so Map remembers the paths that were
+// uploaded: those in the sync state and job history, and any recorded with
+// Add. It is safe for concurrent use.
+type Map struct {
+	mu     sync.Mutex
+	byName map[string]Mapping
+}
+
+// New returns an empty mapping
+func New() *Map {
+	return &Map{byName: make(map[string]Mapping)}
+}
+
+// Load returns a mapping of the uploads among jobs and the files in the sync
+// state. The state takes precedence, then the newest job. If the state can't
+// be read, the mapping holds the jobs alone and the error is returned with it.
+func Load(jobs []history.Job) (*Map, error) {
+	m := New()
+	for _, job := range jobs {
+		if job.Op != history.OpUpload {
+			continue
+		}
+		source := SourceUpload
+		if job.Source == history.SourceDaemon {
+			source = SourceDaemon
+		}
+		m.Add(job.Path, job.Name, source)
+	}
+
+	store, err := state.OpenDefault()
+	if err != nil {
+		return m, err
+	}
+	for _, entry := range store.List() {
+		m.Add(entry.Path, entry.RemoteName, SourceState)
+	}
+	return m, nil
+}
+
+// Add records that the file at path was stored as name, as known from
+// source, replacing what was known about name
+func (m *Map) Add(path, name, source string) {
+	if path == "" || name == "" {
+		return
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.byName[name] = Mapping{Path: path, Name: name, Source: source}
+}
+
+// Name returns the mapping of a local path, which needn't exist any more
+func (m *Map) Name(path string) (Mapping, error) {
+	absPath, err := filepath.Abs(config.ExpandHome(path))
+	if err != nil {
+		return Mapping{}, fmt.Errorf("failed to get absolute path: %w", err)
+	}
+
+	name := api.RemoteName(absPath)
+	if known, ok := m.lookup(name); ok && known.Path == absPath {
+		return known, nil
+	}
+	return Mapping{Path: absPath, Name: name, Source: SourceDerived}, nil
+}
+
+// Path returns the mapping of a server-side name. Its Path is empty if the
+// file wasn't uploaded from a known local path.
+func (m *Map) Path(name string) Mapping {
+	if known, ok := m.lookup(name); ok {
+		return known
+	}
+	return Mapping{Name: name, Source: SourceUnknown}
+}
+
+// Resolve returns the mapping of arg, which is either a local path or a
+// server-side name. arg is taken as a path if it looks like one (it has a
+// directory separator or starts with ~), else as a name if the name is
+// known, else as a path if such a file exists, else as a name.
+func (m *Map) Resolve(arg string) (Mapping, error) {
+	if looksLikePath(arg) {
+		return m.Name(arg)
+	}
+	if known, ok := m.lookup(arg); ok {
+		return known, nil
+	}
+	if _, err := os.Stat(arg); err == nil {
+		return m.Name(arg)
+	}
+	return m.Path(arg), nil
+}
+
+// lookup returns the recorded mapping of name
+func (m *Map) lookup(name string) (Mapping, bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	known, ok := m.byName[name]
+	return known, ok
+}
+
+// looksLikePath reports whether arg can only be a local path, since
+// server-side names have no directory separators
+func looksLikePath(arg string) bool {
+	return arg == "." || arg == ".." || strings.HasPrefix(arg, "~") ||
+		strings.ContainsRune(arg, '/') || strings.ContainsRune(arg, filepath.Separator)
+}
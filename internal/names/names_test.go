@@ -0,0 +1,69 @@
+package names
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/ThiagoAVicente/sfs-cli/internal/api"
+	"github.com/ThiagoAVicente/sfs-cli/internal/history"
+	"github.com/ThiagoAVicente/sfs-cli/internal/state"
+)
+
+func TestMap(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+
+	dir := t.TempDir()
+	t.Chdir(dir)
+	synced := filepath.Join(dir, "docs", "notes.txt")
+	local := filepath.Join(dir, "local.txt")
+	os.WriteFile(local, []byte("local"), 0644)
+
+	store, err := state.OpenDefault()
+	if err != nil {
+		t.Fatalf("Failed to open state: %v", err)
+	}
+	store.Put(state.Entry{Path: synced, RemoteName: api.RemoteName(synced)})
+
+	names, err := Load([]history.Job{
+		// The sync state knows better than an older upload
+		{ID: "job-1", Op: history.OpUpload, Path: "/elsewhere/notes.txt", Name: api.RemoteName(synced), Source: history.SourceCLI},
+		// The newest upload of a name wins
+		{ID: "job-2", Op: history.OpUpload, Path: "/srv/a/b_c.txt", Name: "srv_a_b_c.txt", Source: history.SourceCLI},
+		{ID: "job-3", Op: history.OpUpload, Path: "/srv/a_b/c.txt", Name: "srv_a_b_c.txt", Source: history.SourceCLI},
+		{ID: "job-4", Op: history.OpUpload, Path: "/srv/daemon.txt", Name: "srv_daemon.txt", Source: history.SourceDaemon},
+		{ID: "job-5", Op: history.OpDelete, Path: "/srv/gone.txt", Name: "srv_gone.txt", Source: history.SourceCLI},
+	})
+	if err != nil {
+		t.Fatalf("Failed to load names: %v", err)
+	}
+
+	tests := []struct {
+		arg  string
+		want Mapping
+	}{
+		{arg: "docs/notes.txt", want: Mapping{Path: synced, Name: api.RemoteName(synced), Source: SourceState}},
+		{arg: api.RemoteName(synced), want: Mapping{Path: synced, Name: api.RemoteName(synced), Source: SourceState}},
+		{arg: "srv_a_b_c.txt", want: Mapping{Path: "/srv/a_b/c.txt", Name: "srv_a_b_c.txt", Source: SourceUpload}},
+		{arg: "srv_daemon.txt", want: Mapping{Path: "/srv/daemon.txt", Name: "srv_daemon.txt", Source: SourceDaemon}},
+		{arg: "srv_gone.txt", want: Mapping{Name: "srv_gone.txt", Source: SourceUnknown}},
+		// Known from neither, but the name of an existing local file
+		{arg: "local.txt", want: Mapping{Path: local, Name: api.RemoteName(local), Source: SourceDerived}},
+		{arg: "./missing.txt", want: Mapping{Path: filepath.Join(dir, "missing.txt"), Name: api.RemoteName(filepath.Join(dir, "missing.txt")), Source: SourceDerived}},
+		{arg: "other_file.txt", want: Mapping{Name: "other_file.txt", Source: SourceUnknown}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.arg, func(t *testing.T) {
+			got, err := names.Resolve(tt.arg)
+			if err != nil || got != tt.want {
+				t.Errorf("Expected %+v, got %+v, %v", tt.want, got, err)
+			}
+		})
+	}
+
+	// A path that flattens to a known name isn't mistaken for the file
+	// recorded under it
+	if got, _ := names.Name("/srv/a/b_c.txt"); got.Source != SourceDerived || got.Name != "srv_a_b_c.txt" {
+		t.Errorf("Expected a derived mapping for a colliding path, got %+v", got)
+	}
+}
@@ -0,0 +1,112 @@
+package pool
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+)
+
+// ErrNotStarted is reported for items that were never processed because the
+// context was cancelled first
+var ErrNotStarted = errors.New("cancelled before starting")
+
+// Limiter spaces out operations so no more than a given number start per
+// second. It is safe to share between pools and goroutines. A nil Limiter
+// doesn't limit anything.
+type Limiter struct {
+	mu       sync.Mutex
+	interval time.Duration
+	next     time.Time
+}
+
+// NewLimiter returns a limiter allowing perSecond operations per second, or
+// nil if perSecond isn't positive
+func NewLimiter(perSecond float64) *Limiter {
+	if perSecond <= 0 {
+		return nil
+	}
+	return &Limiter{interval: time.Duration(float64(time.Second) / perSecond)}
+}
+
+// Wait blocks until the next operation may start or ctx is done
+func (l *Limiter) Wait(ctx context.Context) error {
+	if l == nil {
+		return ctx.Err()
+	}
+
+	l.mu.Lock()
+	now := time.Now()
+	slot := l.next
+	if slot.Before(now) {
+		slot = now
+	}
+	l.next = slot.Add(l.interval)
+	l.mu.Unlock()
+
+	delay := time.Until(slot)
+	if delay <= 0 {
+		return ctx.Err()
+	}
+
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Options configures a Run
+type Options struct {
+	// Workers is the number of items processed at once, at least 1
+	Workers int
+	// Limiter, if set, throttles how fast items are started
+	Limiter *Limiter
+}
+
+// Run calls fn for every item using a bounded number of concurrent workers
+// and returns the error of each item, in the same order as items.
+//
+// Cancelling ctx stops new items from starting but lets those already
+// running finish; items that never started get ErrNotStarted.
+func Run[T any](ctx context.Context, opts Options, items []T, fn func(T) error) []error {
+	errs := make([]error, len(items))
+	for i := range errs {
+		errs[i] = ErrNotStarted
+	}
+
+	indexes := make(chan int)
+	var wg sync.WaitGroup
+	for range min(max(opts.Workers, 1), len(items)) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range indexes {
+				// The dispatcher may race a cancellation, so check again
+				if ctx.Err() != nil {
+					continue
+				}
+				errs[i] = fn(items[i])
+			}
+		}()
+	}
+
+dispatch:
+	for i := range items {
+		if opts.Limiter.Wait(ctx) != nil {
+			break
+		}
+		select {
+		case indexes <- i:
+		case <-ctx.Done():
+			break dispatch
+		}
+	}
+	close(indexes)
+	wg.Wait()
+
+	return errs
+}
@@ -0,0 +1,123 @@
+package pool
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestRunCollectsErrorsInOrder(t *testing.T) {
+	items := []int{1, 2, 3, 4, 5, 6}
+	errOdd := errors.New("odd")
+
+	errs := Run(context.Background(), Options{Workers: 3}, items, func(n int) error {
+		if n%2 == 1 {
+			return errOdd
+		}
+		return nil
+	})
+
+	if len(errs) != len(items) {
+		t.Fatalf("Expected %d results, got %d", len(items), len(errs))
+	}
+	for i, n := range items {
+		if expectErr := n%2 == 1; (errs[i] != nil) != expectErr {
+			t.Errorf("Item %d: unexpected error %v", n, errs[i])
+		}
+	}
+}
+
+func TestRunBoundsConcurrency(t *testing.T) {
+	var running, peak atomic.Int32
+
+	items := make([]int, 20)
+	Run(context.Background(), Options{Workers: 3}, items, func(int) error {
+		n := running.Add(1)
+		for {
+			p := peak.Load()
+			if n <= p || peak.CompareAndSwap(p, n) {
+				break
+			}
+		}
+		time.Sleep(5 * time.Millisecond)
+		running.Add(-1)
+		return nil
+	})
+
+	if p := peak.Load(); p > 3 || p < 2 {
+		t.Errorf("Expected at most 3 concurrent items, peak was %d", p)
+	}
+}
+
+func TestRunCancellationLetsRunningItemsFinish(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	started := make(chan struct{}, 10)
+	release := make(chan struct{})
+
+	var finished atomic.Int32
+	items := make([]int, 10)
+
+	done := make(chan []error)
+	go func() {
+		done <- Run(ctx, Options{Workers: 2}, items, func(int) error {
+			started <- struct{}{}
+			<-release
+			finished.Add(1)
+			return nil
+		})
+	}()
+
+	<-started
+	<-started
+	cancel()
+	close(release)
+
+	errs := <-done
+	notStarted := 0
+	for _, err := range errs {
+		if errors.Is(err, ErrNotStarted) {
+			notStarted++
+		}
+	}
+
+	if f := finished.Load(); f != 2 {
+		t.Errorf("Expected the 2 running items to finish, got %d", f)
+	}
+	if notStarted != 8 {
+		t.Errorf("Expected 8 items not started, got %d", notStarted)
+	}
+}
+
+func TestLimiter(t *testing.T) {
+	limiter := NewLimiter(100)
+
+	start := time.Now()
+	for range 5 {
+		if err := limiter.Wait(context.Background()); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+	}
+
+	// The first operation starts immediately, the other four 10ms apart
+	if elapsed := time.Since(start); elapsed < 35*time.Millisecond {
+		t.Errorf("Expected rate limiting to take at least 35ms, took %s", elapsed)
+	}
+
+	if NewLimiter(0) != nil {
+		t.Error("Expected no limiter for a zero rate")
+	}
+}
+
+func TestLimiterCancel(t *testing.T) {
+	limiter := NewLimiter(0.1)
+	limiter.Wait(context.Background())
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+
+	if err := limiter.Wait(ctx); err == nil {
+		t.Error("Expected error when context is done before the next slot")
+	}
+}
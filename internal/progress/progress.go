@@ -0,0 +1,117 @@
+package progress
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ThiagoAVicente/sfs-cli/internal/collect"
+	"golang.org/x/term"
+)
+
+const (
+	barWidth      = 30
+	redrawEvery   = 100 * time.Millisecond
+	clearLineCode = "\r\033[K"
+)
+
+// Bar is a single-line progress bar counting files and bytes. All methods
+// are safe for concurrent use and do nothing on a nil Bar.
+type Bar struct {
+	mu         sync.Mutex
+	out        io.Writer
+	totalFiles int
+	totalBytes int64
+	files      int
+	bytes      int64
+	drawn      bool
+	lastDraw   time.Time
+}
+
+// New returns a bar drawn on out for the given totals
+func New(out io.Writer, totalFiles int, totalBytes int64) *Bar {
+	return &Bar{out: out, totalFiles: totalFiles, totalBytes: totalBytes}
+}
+
+// NewTerminal returns a bar drawn on stderr, or nil if stderr isn't a
+// terminal so redirected output stays clean
+func NewTerminal(totalFiles int, totalBytes int64) *Bar {
+	if !term.IsTerminal(int(os.Stderr.Fd())) {
+		return nil
+	}
+	return New(os.Stderr, totalFiles, totalBytes)
+}
+
+// Add records one more finished file of the given size
+func (b *Bar) Add(size int64) {
+	if b == nil {
+		return
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.files++
+	b.bytes += size
+	if b.files == b.totalFiles || time.Since(b.lastDraw) >= redrawEvery {
+		b.draw()
+	}
+}
+
+// Printf writes a message to w above the bar
+func (b *Bar) Printf(w io.Writer, format string, args ...any) {
+	if b == nil {
+		fmt.Fprintf(w, format, args...)
+		return
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.clear()
+	fmt.Fprintf(w, format, args...)
+	b.draw()
+}
+
+// Finish removes the bar from the terminal
+func (b *Bar) Finish() {
+	if b == nil {
+		return
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.clear()
+}
+
+// String renders the current state of the bar
+func (b *Bar) String() string {
+	filled := barWidth
+	if b.totalFiles > 0 {
+		filled = barWidth * b.files / b.totalFiles
+	}
+
+	return fmt.Sprintf("[%s%s] %d/%d files  %s/%s",
+		strings.Repeat("=", filled), strings.Repeat(" ", barWidth-filled),
+		b.files, b.totalFiles,
+		collect.FormatSize(b.bytes), collect.FormatSize(b.totalBytes))
+}
+
+// draw redraws the bar in place. Callers must hold mu.
+func (b *Bar) draw() {
+	fmt.Fprint(b.out, "\r"+b.String())
+	b.drawn = true
+	b.lastDraw = time.Now()
+}
+
+// clear erases the bar if it is showing. Callers must hold mu.
+func (b *Bar) clear() {
+	if b.drawn {
+		fmt.Fprint(b.out, clearLineCode)
+		b.drawn = false
+	}
+}
@@ -0,0 +1,56 @@
+package progress
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestBarString(t *testing.T) {
+	bar := New(&bytes.Buffer{}, 4, 4<<20)
+	bar.Add(1 << 20)
+	bar.Add(1 << 20)
+
+	got := bar.String()
+	if !strings.Contains(got, "2/4 files") {
+		t.Errorf("Expected file count in %q", got)
+	}
+	if !strings.Contains(got, "2MB/4MB") {
+		t.Errorf("Expected byte count in %q", got)
+	}
+	if !strings.HasPrefix(got, "["+strings.Repeat("=", barWidth/2)+" ") {
+		t.Errorf("Expected half-filled bar, got %q", got)
+	}
+}
+
+func TestBarPrintf(t *testing.T) {
+	var out, messages bytes.Buffer
+	bar := New(&out, 1, 10)
+	bar.Add(10)
+
+	bar.Printf(&messages, "hello %s\n", "world")
+	if messages.String() != "hello world\n" {
+		t.Errorf("Unexpected message output %q", messages.String())
+	}
+	if !strings.Contains(out.String(), clearLineCode) {
+		t.Error("Expected the bar to be cleared before printing")
+	}
+
+	bar.Finish()
+	if !strings.HasSuffix(out.String(), clearLineCode) {
+		t.Error("Expected Finish to clear the bar")
+	}
+}
+
+func TestNilBar(t *testing.T) {
+	var bar *Bar
+	var messages bytes.Buffer
+
+	bar.Add(1)
+	bar.Printf(&messages, "still printed\n")
+	bar.Finish()
+
+	if messages.String() != "still printed\n" {
+		t.Errorf("Expected nil bar to print messages, got %q", messages.String())
+	}
+}
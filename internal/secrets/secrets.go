@@ -0,0 +1,310 @@
+// Package secrets stores API keys encrypted with a passphrase.
+//
+// Each secret is sealed with AES-256-GCM under a key derived from the
+// passphrase with PBKDF2-SHA256, using a random salt per file and a random
+// nonce per secret. Secret names are kept in the clear so commands can tell
+// whether a profile has an encrypted key without unlocking the file.
+package secrets
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/pbkdf2"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/ThiagoAVicente/sfs-cli/internal/config"
+	"golang.org/x/term"
+)
+
+// FileName is the name of the secrets file, next to the config file
+const FileName = "secrets.json"
+
+const (
+	// PassphraseEnv is the environment variable holding the passphrase
+	PassphraseEnv = "SFS_SECRETS_PASSPHRASE"
+
+	// PassphraseFileKey is the setting naming a file holding the passphrase,
+	// so the daemon can unlock the secrets without a prompt
+	PassphraseFileKey = "secrets_passphrase_file"
+)
+
+const (
+	fileVersion = 1
+	kdfName     = "pbkdf2-sha256"
+	saltSize    = 16
+	keySize     = 32
+)
+
+// iterations is the PBKDF2 work factor for new files
+var iterations = 600000
+
+// ErrWrongPassphrase is returned when a passphrase doesn't unlock the file
+var ErrWrongPassphrase = errors.New("wrong passphrase for the secrets file")
+
+// Store is an encrypted secrets file. It is not safe for concurrent use.
+type Store struct {
+	path string
+	data fileData
+}
+
+// fileData is the on-disk layout of the secrets file
+type fileData struct {
+	Version    int               `json:"version"`
+	KDF        string            `json:"kdf"`
+	Iterations int               `json:"iterations"`
+	Salt       []byte            `json:"salt"`
+	Secrets    map[string]sealed `json:"secrets"`
+}
+
+// sealed is a single encrypted secret
+type sealed struct {
+	Nonce      []byte `json:"nonce"`
+	Ciphertext []byte `json:"ciphertext"`
+}
+
+// DefaultPath returns the secrets file path next to the config file
+func DefaultPath() (string, error) {
+	configPath, err := config.GetConfigPath()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(filepath.Dir(configPath), FileName), nil
+}
+
+// OpenDefault opens the secrets file at DefaultPath
+func OpenDefault() (*Store, error) {
+	path, err := DefaultPath()
+	if err != nil {
+		return nil, err
+	}
+	return Open(path)
+}
+
+// Open reads the secrets file at path. A missing file is an empty store.
+func Open(path string) (*Store, error) {
+	s := &Store{path: path}
+
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return s, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read secrets file: %w", err)
+	}
+
+	if err := json.Unmarshal(data, &s.data); err != nil {
+		return nil, fmt.Errorf("failed to parse secrets file: %w", err)
+	}
+	if s.data.Version != fileVersion || s.data.KDF != kdfName {
+		return nil, fmt.Errorf("unsupported secrets file %s (version %d, kdf %s)", path, s.data.Version, s.data.KDF)
+	}
+	return s, nil
+}
+
+// Path returns where the store is saved
+func (s *Store) Path() string {
+	return s.path
+}
+
+// Empty reports whether the store holds no secrets yet
+func (s *Store) Empty() bool {
+	return len(s.data.Secrets) == 0
+}
+
+// Has reports whether a secret called name is stored
+func (s *Store) Has(name string) bool {
+	_, ok := s.data.Secrets[name]
+	return ok
+}
+
+// Names returns the names of the stored secrets, sorted
+func (s *Store) Names() []string {
+	names := make([]string, 0, len(s.data.Secrets))
+	for name := range s.data.Secrets {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Get decrypts the secret called name
+func (s *Store) Get(name, passphrase string) (string, error) {
+	secret, ok := s.data.Secrets[name]
+	if !ok {
+		return "", fmt.Errorf("no secret named %s in %s", name, s.path)
+	}
+
+	gcm, err := s.cipher(passphrase)
+	if err != nil {
+		return "", err
+	}
+	plaintext, err := gcm.Open(nil, secret.Nonce, secret.Ciphertext, []byte(name))
+	if err != nil {
+		return "", ErrWrongPassphrase
+	}
+	return string(plaintext), nil
+}
+
+// Set encrypts value as the secret called name and saves the store. Every
+// secret in a file shares one passphrase, so it must unlock the existing
+// ones.
+func (s *Store) Set(name, value, passphrase string) error {
+	if err := s.check(passphrase); err != nil {
+		return err
+	}
+	if s.Empty() {
+		// Start over with a fresh salt, which also allows a new passphrase
+		salt := make([]byte, saltSize)
+		rand.Read(salt)
+		s.data = fileData{
+			Version:    fileVersion,
+			KDF:        kdfName,
+			Iterations: iterations,
+			Salt:       salt,
+			Secrets:    make(map[string]sealed),
+		}
+	}
+
+	gcm, err := s.cipher(passphrase)
+	if err != nil {
+		return err
+	}
+	nonce := make([]byte, gcm.NonceSize())
+	rand.Read(nonce)
+	s.data.Secrets[name] = sealed{
+		Nonce:      nonce,
+		Ciphertext: gcm.Seal(nil, nonce, []byte(value), []byte(name)),
+	}
+	return s.save()
+}
+
+// Delete removes the secret called name and saves the store
+func (s *Store) Delete(name string) error {
+	if !s.Has(name) {
+		return nil
+	}
+	delete(s.data.Secrets, name)
+	return s.save()
+}
+
+// check verifies that passphrase unlocks the secrets already stored
+func (s *Store) check(passphrase string) error {
+	names := s.Names()
+	if len(names) == 0 {
+		return nil
+	}
+	_, err := s.Get(names[0], passphrase)
+	return err
+}
+
+// cipher derives the file key from passphrase
+func (s *Store) cipher(passphrase string) (cipher.AEAD, error) {
+	if passphrase == "" {
+		return nil, fmt.Errorf("the secrets passphrase can't be empty")
+	}
+	key, err := pbkdf2.Key(sha256.New, passphrase, s.data.Salt, s.data.Iterations, keySize)
+	if err != nil {
+		return nil, fmt.Errorf("failed to derive key: %w", err)
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create cipher: %w", err)
+	}
+	return cipher.NewGCM(block)
+}
+
+// save writes the store, readable only by the owner, replacing the old file
+// in one step so a crash can't leave it half written
+func (s *Store) save() error {
+	data, err := json.MarshalIndent(s.data, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode secrets: %w", err)
+	}
+	if err := os.MkdirAll(filepath.Dir(s.path), 0755); err != nil {
+		return fmt.Errorf("failed to create secrets directory: %w", err)
+	}
+
+	tmp := s.path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0600); err != nil {
+		return fmt.Errorf("failed to write secrets file: %w", err)
+	}
+	if err := os.Rename(tmp, s.path); err != nil {
+		os.Remove(tmp)
+		return fmt.Errorf("failed to write secrets file: %w", err)
+	}
+	return nil
+}
+
+// Passphrase returns the passphrase from SFS_SECRETS_PASSPHRASE, else from
+// the file named by the secrets_passphrase_file setting, else by prompting
+// on the terminal. It fails if there is no terminal to prompt on.
+func Passphrase() (string, error) {
+	passphrase, err := storedPassphrase()
+	if err != nil || passphrase != "" {
+		return passphrase, err
+	}
+	return ReadPassphrase("Secrets passphrase: ")
+}
+
+// NewPassphrase returns the passphrase for a new secrets file, from the
+// same places as Passphrase but prompting twice to catch typos
+func NewPassphrase() (string, error) {
+	passphrase, err := storedPassphrase()
+	if err != nil || passphrase != "" {
+		return passphrase, err
+	}
+
+	passphrase, err = ReadPassphrase("New secrets passphrase: ")
+	if err != nil {
+		return "", err
+	}
+	confirm, err := ReadPassphrase("Repeat passphrase: ")
+	if err != nil {
+		return "", err
+	}
+	if passphrase != confirm {
+		return "", fmt.Errorf("passphrases don't match")
+	}
+	return passphrase, nil
+}
+
+// ReadPassphrase prompts for a passphrase on the terminal without echoing it
+func ReadPassphrase(prompt string) (string, error) {
+	if !term.IsTerminal(int(os.Stdin.Fd())) {
+		return "", fmt.Errorf("the API key is encrypted: set %s or %s to unlock it", PassphraseEnv, PassphraseFileKey)
+	}
+
+	fmt.Fprint(os.Stderr, prompt)
+	passphrase, err := term.ReadPassword(int(os.Stdin.Fd()))
+	fmt.Fprintln(os.Stderr)
+	if err != nil {
+		return "", fmt.Errorf("failed to read passphrase: %w", err)
+	}
+	return string(passphrase), nil
+}
+
+// storedPassphrase returns the passphrase from SFS_SECRETS_PASSPHRASE or
+// secrets_passphrase_file, or "" if neither is set
+func storedPassphrase() (string, error) {
+	if passphrase := os.Getenv(PassphraseEnv); passphrase != "" {
+		return passphrase, nil
+	}
+
+	path := config.GetValue(PassphraseFileKey)
+	if path == "" {
+		return "", nil
+	}
+	data, err := os.ReadFile(config.ExpandHome(path))
+	if err != nil {
+		return "", fmt.Errorf("failed to read %s: %w", PassphraseFileKey, err)
+	}
+	return strings.TrimRight(string(data), "\r\n"), nil
+}
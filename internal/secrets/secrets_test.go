@@ -0,0 +1,102 @@
+package secrets
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/ThiagoAVicente/sfs-cli/internal/config"
+	"github.com/spf13/viper"
+)
+
+func TestStore(t *testing.T) {
+	// Keep key derivation fast
+	defer func(n int) { iterations = n }(iterations)
+	iterations = 1000
+
+	path := filepath.Join(t.TempDir(), "sfs", FileName)
+	store, err := Open(path)
+	if err != nil {
+		t.Fatalf("Failed to open store: %v", err)
+	}
+	if !store.Empty() {
+		t.Error("Expected a missing file to be an empty store")
+	}
+
+	if err := store.Set("default", "prod-key", "correct horse"); err != nil {
+		t.Fatalf("Failed to set secret: %v", err)
+	}
+	if err := store.Set("staging", "staging-key", "wrong"); !errors.Is(err, ErrWrongPassphrase) {
+		t.Errorf("Expected a different passphrase to be rejected, got %v", err)
+	}
+	if err := store.Set("staging", "staging-key", "correct horse"); err != nil {
+		t.Fatalf("Failed to set secret: %v", err)
+	}
+
+	// The file is private and holds no plain-text keys
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatalf("Failed to stat secrets file: %v", err)
+	}
+	if info.Mode().Perm() != 0600 {
+		t.Errorf("Expected permissions 0600, got %o", info.Mode().Perm())
+	}
+	data, _ := os.ReadFile(path)
+	if strings.Contains(string(data), "prod-key") || strings.Contains(string(data), "staging-key") {
+		t.Errorf("Expected keys to be encrypted, got %s", data)
+	}
+
+	store, err = Open(path)
+	if err != nil {
+		t.Fatalf("Failed to reopen store: %v", err)
+	}
+	if names := store.Names(); len(names) != 2 || names[0] != "default" || names[1] != "staging" {
+		t.Errorf("Expected both secrets, got %v", names)
+	}
+	if key, err := store.Get("staging", "correct horse"); err != nil || key != "staging-key" {
+		t.Errorf("Expected staging-key, got %q, %v", key, err)
+	}
+	if _, err := store.Get("default", "wrong"); !errors.Is(err, ErrWrongPassphrase) {
+		t.Errorf("Expected a wrong passphrase error, got %v", err)
+	}
+	if _, err := store.Get("default", ""); err == nil {
+		t.Error("Expected an empty passphrase to be rejected")
+	}
+
+	// Secrets are bound to their names, so they can't be swapped around
+	store.data.Secrets["default"], store.data.Secrets["staging"] = store.data.Secrets["staging"], store.data.Secrets["default"]
+	if _, err := store.Get("default", "correct horse"); !errors.Is(err, ErrWrongPassphrase) {
+		t.Errorf("Expected a swapped secret to fail to decrypt, got %v", err)
+	}
+
+	store, _ = Open(path)
+	store.Delete("default")
+	store.Delete("staging")
+	if err := store.Set("default", "new-key", "new passphrase"); err != nil {
+		t.Errorf("Expected an emptied store to accept a new passphrase, got %v", err)
+	}
+}
+
+func TestPassphrase(t *testing.T) {
+	viper.Reset()
+	home := os.Getenv("HOME")
+	os.Setenv("HOME", t.TempDir())
+	defer os.Setenv("HOME", home)
+	if err := config.InitConfig(); err != nil {
+		t.Fatalf("Failed to init config: %v", err)
+	}
+
+	file := filepath.Join(t.TempDir(), "passphrase")
+	os.WriteFile(file, []byte("from file\n"), 0600)
+	config.Set(PassphraseFileKey, file)
+	if passphrase, err := Passphrase(); err != nil || passphrase != "from file" {
+		t.Errorf("Expected the passphrase file to be read, got %q, %v", passphrase, err)
+	}
+
+	t.Setenv(PassphraseEnv, "from env")
+	if passphrase, err := Passphrase(); err != nil || passphrase != "from env" {
+		t.Errorf("Expected %s to win, got %q, %v", PassphraseEnv, passphrase, err)
+	}
+}
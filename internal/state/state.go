@@ -0,0 +1,405 @@
+package state
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ThiagoAVicente/sfs-cli/internal/config"
+	"github.com/ThiagoAVicente/sfs-cli/internal/filelock"
+)
+
+// FileName is the name of the state file inside the config directory
+const FileName = "state.jsonl"
+
+// Job statuses recorded in an entry
+const (
+	// JobSubmitted is recorded until the outcome of the job is known
+	JobSubmitted = "submitted"
+	// JobComplete means the file was indexed
+	JobComplete = "complete"
+	// JobFailed means the server couldn't index the file
+	JobFailed = "failed"
+)
+
+// Entry records what was last synced for a local file.
+//
+// Size, ModTime and Hash describe the contents last uploaded successfully;
+// Error is set when the most recent attempt failed before a job was created.
+type Entry struct {
+	Path       string    `json:"path"`
+	RemoteName string    `json:"remote_name"`
+	Size       int64     `json:"size"`
+	ModTime    time.Time `json:"mod_time"`
+	Hash       string    `json:"hash"`
+	JobID      string    `json:"job_id,omitempty"`
+	JobStatus  string    `json:"job_status,omitempty"`
+	Error      string    `json:"error,omitempty"`
+	SyncedAt   time.Time `json:"synced_at"`
+	Deleted    bool      `json:"deleted,omitempty"`
+}
+
+// Synced reports whether the last attempt to sync the entry succeeded
+func (e Entry) Synced() bool {
+	return e.Error == "" && e.JobStatus != JobFailed
+}
+
+// Matches reports whether the file at path, described by info, has the
+// contents recorded in the entry. The hash is only computed when the size or
+// modification time differ.
+func (e Entry) Matches(path string, info fs.FileInfo) bool {
+	if e.Hash == "" {
+		return false
+	}
+	if e.Unchanged(info) {
+		return true
+	}
+
+	hash, err := HashFile(path)
+	return err == nil && hash == e.Hash
+}
+
+// Unchanged reports whether info has the same size and modification time
+// as the recorded entry
+func (e Entry) Unchanged(info fs.FileInfo) bool {
+	return e.Size == info.Size() && e.ModTime.Equal(info.ModTime())
+}
+
+// compactMinLines is how long the state file may grow before AutoCompact
+// rewrites it
+const compactMinLines = 1000
+
+// Store is an append-only JSON-lines record of synced files.
+//
+// Every change is appended as a line, so the CLI can open the store while
+// the daemon writes to it. Only Compact rewrites the file, to one line per
+// entry; the daemon does so when it starts and, with AutoCompact, whenever
+// the file has grown well past its number of entries.
+type Store struct {
+	mu      sync.Mutex
+	path    string
+	entries map[string]Entry
+	// lines counts the lines in the file
+	lines       int
+	autoCompact bool
+}
+
+// DefaultPath returns the state file path inside the config directory
+func DefaultPath() (string, error) {
+	configDir, err := config.GetConfigDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(configDir, FileName), nil
+}
+
+// OpenDefault opens the store at DefaultPath
+func OpenDefault() (*Store, error) {
+	path, err := DefaultPath()
+	if err != nil {
+		return nil, err
+	}
+	return Open(path)
+}
+
+// Open loads the store at path. The file isn't changed, and is only created
+// once an entry is recorded.
+func Open(path string) (*Store, error) {
+	entries, lines, err := load(path)
+	if err != nil {
+		return nil, err
+	}
+	return &Store{path: path, entries: entries, lines: lines}, nil
+}
+
+// load replays the state file at path, returning the live entries and the
+// number of lines read
+func load(path string) (map[string]Entry, int, error) {
+	entries := make(map[string]Entry)
+
+	file, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return entries, 0, nil
+	}
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to open state: %w", err)
+	}
+	defer file.Close()
+
+	lines := 0
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		lines++
+		var entry Entry
+		if err := json.Unmarshal(scanner.Bytes(), &entry); err != nil {
+			// A torn final line from a crash is not worth failing over
+			continue
+		}
+		if entry.Deleted {
+			delete(entries, entry.Path)
+		} else {
+			entries[entry.Path] = entry
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, 0, fmt.Errorf("failed to read state: %w", err)
+	}
+	return entries, lines, nil
+}
+
+// AutoCompact makes the store compact the file whenever it holds more than
+// twice as many lines as there are entries
+func (s *Store) AutoCompact() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.autoCompact = true
+}
+
+// Compact rewrites the state file with one line per entry. The file is read
+// again under a lock that keeps other processes from appending meanwhile,
+// so nothing they recorded since the store was opened is lost, and the store
+// picks up their changes.
+func (s *Store) Compact() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.compact()
+}
+
+// Get returns the entry for path
+func (s *Store) Get(path string) (Entry, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	entry, ok := s.entries[path]
+	return entry, ok
+}
+
+// FindRemote returns the entry uploaded under the given server-side name
+func (s *Store) FindRemote(name string) (Entry, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, entry := range s.entries {
+		if entry.RemoteName == name {
+			return entry, true
+		}
+	}
+	return Entry{}, false
+}
+
+// Put records entry, replacing any previous entry for the same path
+func (s *Store) Put(entry Entry) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	entry.Deleted = false
+	if err := s.append(entry); err != nil {
+		return err
+	}
+	s.entries[entry.Path] = entry
+	s.maybeCompact()
+	return nil
+}
+
+// FinishJob records the outcome of an indexing job on the entry it was
+// submitted for, if any
+func (s *Store) FinishJob(jobID string, failed bool) error {
+	if jobID == "" {
+		return nil
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, entry := range s.entries {
+		if entry.JobID != jobID {
+			continue
+		}
+		entry.JobStatus = JobComplete
+		if failed {
+			entry.JobStatus = JobFailed
+		}
+		if err := s.append(entry); err != nil {
+			return err
+		}
+		s.entries[entry.Path] = entry
+		s.maybeCompact()
+		return nil
+	}
+	return nil
+}
+
+// Delete forgets the entry for path
+func (s *Store) Delete(path string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.entries[path]; !ok {
+		return nil
+	}
+
+	if err := s.append(Entry{Path: path, Deleted: true}); err != nil {
+		return err
+	}
+	delete(s.entries, path)
+	s.maybeCompact()
+	return nil
+}
+
+// maybeCompact compacts the file if AutoCompact is on and it has grown large
+// enough. Callers must hold mu.
+func (s *Store) maybeCompact() {
+	if !s.autoCompact || s.lines < compactMinLines || s.lines <= 2*len(s.entries) {
+		return
+	}
+	// The change is already recorded and a failed compaction leaves the file
+	// as it was, so it is simply tried again on a later change
+	s.compact()
+}
+
+// List returns all entries sorted by path
+func (s *Store) List() []Entry {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	entries := make([]Entry, 0, len(s.entries))
+	for _, entry := range s.entries {
+		entries = append(entries, entry)
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].Path < entries[j].Path
+	})
+	return entries
+}
+
+// Under returns the entries for files inside dir, sorted by path
+func (s *Store) Under(dir string) []Entry {
+	prefix := filepath.Clean(dir) + string(filepath.Separator)
+
+	var entries []Entry
+	for _, entry := range s.List() {
+		if strings.HasPrefix(entry.Path, prefix) {
+			entries = append(entries, entry)
+		}
+	}
+	return entries
+}
+
+// append writes a single entry line to the end of the state file. Callers
+// must hold mu.
+func (s *Store) append(entry Entry) error {
+	line, err := json.Marshal(entry)
+	if err != nil {
+		return fmt.Errorf("failed to encode state: %w", err)
+	}
+
+	if err := os.MkdirAll(filepath.Dir(s.path), 0755); err != nil {
+		return fmt.Errorf("failed to create state directory: %w", err)
+	}
+	unlock, err := filelock.Lock(s.path + ".lock")
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	file, err := os.OpenFile(s.path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+	if err != nil {
+		return fmt.Errorf("failed to open state: %w", err)
+	}
+	defer file.Close()
+
+	if _, err := file.Write(append(line, '\n')); err != nil {
+		return fmt.Errorf("failed to write state: %w", err)
+	}
+	s.lines++
+	return nil
+}
+
+// compact rewrites the state file with one line per live entry, as read
+// again under the lock. Callers must hold mu.
+func (s *Store) compact() error {
+	if err := os.MkdirAll(filepath.Dir(s.path), 0755); err != nil {
+		return fmt.Errorf("failed to create state directory: %w", err)
+	}
+	unlock, err := filelock.Lock(s.path + ".lock")
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	entries, _, err := load(s.path)
+	if err != nil {
+		return err
+	}
+
+	tmpPath := s.path + ".tmp"
+	file, err := os.OpenFile(tmpPath, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0600)
+	if err != nil {
+		return fmt.Errorf("failed to create state: %w", err)
+	}
+
+	writer := bufio.NewWriter(file)
+	encoder := json.NewEncoder(writer)
+	for _, entry := range entries {
+		if err := encoder.Encode(entry); err != nil {
+			file.Close()
+			return fmt.Errorf("failed to write state: %w", err)
+		}
+	}
+
+	if err := writer.Flush(); err != nil {
+		file.Close()
+		return fmt.Errorf("failed to write state: %w", err)
+	}
+	if err := file.Close(); err != nil {
+		return fmt.Errorf("failed to write state: %w", err)
+	}
+
+	if err := os.Rename(tmpPath, s.path); err != nil {
+		return fmt.Errorf("failed to replace state: %w", err)
+	}
+	s.entries, s.lines = entries, len(entries)
+	return nil
+}
+
+// HashFile returns the hex-encoded SHA-256 of the file at path
+func HashFile(path string) (string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+
+	hash := sha256.New()
+	if _, err := io.Copy(hash, file); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
+
+// NewEntry builds an entry for the file at path, hashing its contents
+func NewEntry(path, remoteName string, info fs.FileInfo) (Entry, error) {
+	hash, err := HashFile(path)
+	if err != nil {
+		return Entry{}, fmt.Errorf("failed to hash file: %w", err)
+	}
+
+	return Entry{
+		Path:       path,
+		RemoteName: remoteName,
+		Size:       info.Size(),
+		ModTime:    info.ModTime(),
+		Hash:       hash,
+	}, nil
+}
@@ -0,0 +1,257 @@
+package state
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestPutAndGet(t *testing.T) {
+	store, err := Open(filepath.Join(t.TempDir(), FileName))
+	if err != nil {
+		t.Fatalf("Failed to open store: %v", err)
+	}
+
+	entry := Entry{Path: "/tmp/a.txt", Size: 4, ModTime: time.Now().UTC(), Hash: "abc"}
+	if err := store.Put(entry); err != nil {
+		t.Fatalf("Failed to put entry: %v", err)
+	}
+
+	got, ok := store.Get("/tmp/a.txt")
+	if !ok {
+		t.Fatal("Expected entry to exist")
+	}
+	if got.Hash != "abc" || got.Size != 4 {
+		t.Errorf("Unexpected entry: %+v", got)
+	}
+
+	if _, ok := store.Get("/tmp/missing.txt"); ok {
+		t.Error("Expected missing entry not to exist")
+	}
+}
+
+func TestPersistence(t *testing.T) {
+	path := filepath.Join(t.TempDir(), FileName)
+
+	store, err := Open(path)
+	if err != nil {
+		t.Fatalf("Failed to open store: %v", err)
+	}
+
+	store.Put(Entry{Path: "/tmp/a.txt", Hash: "one"})
+	store.Put(Entry{Path: "/tmp/a.txt", Hash: "two"})
+	store.Put(Entry{Path: "/tmp/b.txt", Hash: "three"})
+	store.Delete("/tmp/b.txt")
+
+	// Reopen to replay the log, which is left as it is
+	store, err = Open(path)
+	if err != nil {
+		t.Fatalf("Failed to reopen store: %v", err)
+	}
+	if data, _ := os.ReadFile(path); strings.Count(string(data), "\n") != 4 {
+		t.Errorf("Expected opening the store to leave the file alone, got %q", data)
+	}
+	if err := store.Compact(); err != nil {
+		t.Fatalf("Failed to compact: %v", err)
+	}
+
+	entries := store.List()
+	if len(entries) != 1 {
+		t.Fatalf("Expected 1 entry, got %d", len(entries))
+	}
+	if entries[0].Hash != "two" {
+		t.Errorf("Expected latest entry to win, got hash %s", entries[0].Hash)
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("Failed to read state file: %v", err)
+	}
+	if lines := strings.Count(string(data), "\n"); lines != 1 {
+		t.Errorf("Expected compacted file to have 1 line, got %d", lines)
+	}
+
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatalf("Failed to stat state file: %v", err)
+	}
+	if mode := info.Mode().Perm(); mode != 0600 {
+		t.Errorf("Expected file permissions 0600, got %04o", mode)
+	}
+}
+
+func TestCompactKeepsOtherWriters(t *testing.T) {
+	path := filepath.Join(t.TempDir(), FileName)
+
+	// The daemon and the CLI each have the store open
+	daemon, err := Open(path)
+	if err != nil {
+		t.Fatalf("Failed to open store: %v", err)
+	}
+	cli, err := Open(path)
+	if err != nil {
+		t.Fatalf("Failed to open store: %v", err)
+	}
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Errorf("Expected opening the store not to create the file, got %v", err)
+	}
+
+	daemon.Put(Entry{Path: "/tmp/a.txt", Hash: "one"})
+	cli.Put(Entry{Path: "/tmp/b.txt", Hash: "two"})
+
+	if err := daemon.Compact(); err != nil {
+		t.Fatalf("Failed to compact: %v", err)
+	}
+	if _, ok := daemon.Get("/tmp/b.txt"); !ok {
+		t.Error("Expected compaction to pick up the entry the other store recorded")
+	}
+
+	reopened, err := Open(path)
+	if err != nil {
+		t.Fatalf("Failed to reopen store: %v", err)
+	}
+	if entries := reopened.List(); len(entries) != 2 {
+		t.Errorf("Expected both entries to survive compaction, got %+v", entries)
+	}
+}
+
+func TestAutoCompact(t *testing.T) {
+	path := filepath.Join(t.TempDir(), FileName)
+	store, err := Open(path)
+	if err != nil {
+		t.Fatalf("Failed to open store: %v", err)
+	}
+	store.AutoCompact()
+
+	for i := range compactMinLines + 1 {
+		store.Put(Entry{Path: "/tmp/a.txt", Hash: fmt.Sprint(i)})
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("Failed to read state file: %v", err)
+	}
+	if lines := strings.Count(string(data), "\n"); lines >= compactMinLines {
+		t.Errorf("Expected the file to be compacted, got %d lines", lines)
+	}
+	if entry, _ := store.Get("/tmp/a.txt"); entry.Hash != fmt.Sprint(compactMinLines) {
+		t.Errorf("Expected the latest entry to survive, got %+v", entry)
+	}
+}
+
+func TestUnder(t *testing.T) {
+	store, err := Open(filepath.Join(t.TempDir(), FileName))
+	if err != nil {
+		t.Fatalf("Failed to open store: %v", err)
+	}
+
+	store.Put(Entry{Path: "/data/docs/a.txt"})
+	store.Put(Entry{Path: "/data/docs/sub/b.txt"})
+	store.Put(Entry{Path: "/data/docs_other/c.txt"})
+
+	entries := store.Under("/data/docs")
+	if len(entries) != 2 {
+		t.Fatalf("Expected 2 entries under /data/docs, got %d", len(entries))
+	}
+	if entries[0].Path != "/data/docs/a.txt" || entries[1].Path != "/data/docs/sub/b.txt" {
+		t.Errorf("Unexpected entries: %+v", entries)
+	}
+}
+
+func TestNewEntryAndUnchanged(t *testing.T) {
+	testFile := filepath.Join(t.TempDir(), "test.txt")
+	if err := os.WriteFile(testFile, []byte("test content"), 0644); err != nil {
+		t.Fatalf("Failed to create test file: %v", err)
+	}
+
+	info, err := os.Stat(testFile)
+	if err != nil {
+		t.Fatalf("Failed to stat test file: %v", err)
+	}
+
+	entry, err := NewEntry(testFile, "test.txt", info)
+	if err != nil {
+		t.Fatalf("Failed to create entry: %v", err)
+	}
+
+	// sha256("test content")
+	expected := "6ae8a75555209fd6c44157c0aed8016e763ff435a19cf186f76863140143ff72"
+	if entry.Hash != expected {
+		t.Errorf("Expected hash %s, got %s", expected, entry.Hash)
+	}
+
+	if !entry.Unchanged(info) {
+		t.Error("Expected entry to match its own file info")
+	}
+
+	later := time.Now().Add(time.Hour)
+	if err := os.Chtimes(testFile, later, later); err != nil {
+		t.Fatalf("Failed to touch test file: %v", err)
+	}
+	info, _ = os.Stat(testFile)
+	if entry.Unchanged(info) {
+		t.Error("Expected touched file to be reported as changed")
+	}
+
+	// Touched but identical contents still match
+	if !entry.Matches(testFile, info) {
+		t.Error("Expected touched file with same contents to match")
+	}
+
+	if err := os.WriteFile(testFile, []byte("new content!"), 0644); err != nil {
+		t.Fatalf("Failed to rewrite test file: %v", err)
+	}
+	info, _ = os.Stat(testFile)
+	if entry.Matches(testFile, info) {
+		t.Error("Expected rewritten file not to match")
+	}
+}
+
+func TestSynced(t *testing.T) {
+	tests := []struct {
+		name     string
+		entry    Entry
+		expected bool
+	}{
+		{name: "submitted", entry: Entry{JobStatus: JobSubmitted}, expected: true},
+		{name: "upload error", entry: Entry{Error: "connection refused"}, expected: false},
+		{name: "job failed", entry: Entry{JobStatus: JobFailed}, expected: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.entry.Synced(); got != tt.expected {
+				t.Errorf("Expected Synced()=%v, got %v", tt.expected, got)
+			}
+		})
+	}
+}
+
+func TestFinishJob(t *testing.T) {
+	store, err := Open(filepath.Join(t.TempDir(), FileName))
+	if err != nil {
+		t.Fatalf("Failed to open store: %v", err)
+	}
+	store.Put(Entry{Path: "/tmp/a.txt", Hash: "one", JobID: "job-1", JobStatus: JobSubmitted})
+	store.Put(Entry{Path: "/tmp/b.txt", Hash: "two", JobID: "job-2", JobStatus: JobSubmitted})
+
+	if err := store.FinishJob("job-1", false); err != nil {
+		t.Fatalf("Failed to finish job: %v", err)
+	}
+	if err := store.FinishJob("job-2", true); err != nil {
+		t.Fatalf("Failed to finish job: %v", err)
+	}
+	if err := store.FinishJob("job-unknown", true); err != nil {
+		t.Errorf("Expected an unknown job to be ignored, got %v", err)
+	}
+
+	if entry, _ := store.Get("/tmp/a.txt"); entry.JobStatus != JobComplete || !entry.Synced() {
+		t.Errorf("Expected job-1 to be complete, got %+v", entry)
+	}
+	if entry, _ := store.Get("/tmp/b.txt"); entry.JobStatus != JobFailed || entry.Synced() {
+		t.Errorf("Expected job-2 to be failed, got %+v", entry)
+	}
+}